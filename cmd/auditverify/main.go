@@ -0,0 +1,62 @@
+// Command auditverify checks the hash chain of audit trails written by audit.FileSink.
+//
+//	auditverify [-rotated] [-after seq:hash] [-last hash] file...
+//
+// Files are verified as one trail, oldest first. With -rotated each argument is the path
+// of a FileSink and its rotated files are verified along with it. Unless -after names
+// the entry preceding the files, e.g. once old rotated files were deleted, the files
+// must start the trail. -last is the anchored hash of the last entry, which detects
+// entries cut off at the end.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/idproxy/gateway/pkg/audit"
+)
+
+func main() {
+	rotated := flag.Bool("rotated", false, "include the rotated files of each path")
+	after := flag.String("after", "", "seq:hash of the entry preceding the files")
+	lastHash := flag.String("last", "", "expected hash of the last entry")
+	flag.Parse()
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: auditverify [-rotated] [-after seq:hash] [-last hash] file...")
+		os.Exit(2)
+	}
+
+	var prev *audit.Entry
+	if *after != "" {
+		seq, hash, _ := strings.Cut(*after, ":")
+		n, err := strconv.ParseUint(seq, 10, 64)
+		if err != nil || hash == "" {
+			fmt.Fprintln(os.Stderr, "-after must be seq:hash")
+			os.Exit(2)
+		}
+		prev = &audit.Entry{Seq: n, Hash: hash}
+	}
+
+	var paths []string
+	for _, path := range flag.Args() {
+		if *rotated {
+			paths = append(paths, audit.RotatedFiles(path)...)
+		} else {
+			paths = append(paths, path)
+		}
+	}
+
+	last, n, err := audit.VerifyFilesFrom(prev, paths...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "FAIL after %d entries: %v\n", n, err)
+		os.Exit(1)
+	}
+	if *lastHash != "" && (last == nil || last.Hash != *lastHash) {
+		fmt.Fprintf(os.Stderr, "FAIL after %d entries: last entry does not match %s, entries were cut off or rewritten\n", n, *lastHash)
+		os.Exit(1)
+	}
+	fmt.Printf("OK: %d entries\n", n)
+}
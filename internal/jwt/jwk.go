@@ -0,0 +1,116 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"math/big"
+)
+
+// ErrKeyNotFound is returned when no key in the set matches the requested key id.
+var ErrKeyNotFound = errors.New("jwt: signing key not found")
+
+// JSONWebKey is a public key as defined in RFC 7517. Only RSA and EC keys are supported.
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// EC
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// KeySet is a JWK set as served by the jwks_uri of an OpenID provider.
+type KeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// PublicKey returns the *rsa.PublicKey or *ecdsa.PublicKey represented by the key.
+func (k JSONWebKey) PublicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errors.New("jwt: unsupported curve " + k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	}
+	return nil, errors.New("jwt: unsupported key type " + k.Kty)
+}
+
+// Lookup returns the public key matching kid. When kid is empty and the set holds a
+// single key, that key is returned.
+func (s *KeySet) Lookup(kid string) (any, error) {
+	if kid == "" && len(s.Keys) == 1 {
+		return s.Keys[0].PublicKey()
+	}
+	for _, k := range s.Keys {
+		if k.Kid == kid && (k.Use == "" || k.Use == "sig") {
+			return k.PublicKey()
+		}
+	}
+	return nil, ErrKeyNotFound
+}
+
+// NewJSONWebKey returns the JWK representation of an RSA or EC public key.
+func NewJSONWebKey(kid string, pub any) (JSONWebKey, error) {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		return JSONWebKey{
+			Kty: "RSA",
+			Kid: kid,
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+		}, nil
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		x, y := make([]byte, size), make([]byte, size)
+		k.X.FillBytes(x)
+		k.Y.FillBytes(y)
+		return JSONWebKey{
+			Kty: "EC",
+			Kid: kid,
+			Use: "sig",
+			Crv: k.Curve.Params().Name,
+			X:   base64.RawURLEncoding.EncodeToString(x),
+			Y:   base64.RawURLEncoding.EncodeToString(y),
+		}, nil
+	}
+	return JSONWebKey{}, errors.New("jwt: unsupported public key type")
+}
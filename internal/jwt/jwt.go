@@ -0,0 +1,216 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/idproxy/gateway/internal/json"
+)
+
+var (
+	// ErrMalformed is returned when a token is not a compact serialized JWS.
+	ErrMalformed = errors.New("jwt: malformed token")
+	// ErrUnsupportedAlg is returned when the token uses an unknown or disallowed algorithm.
+	ErrUnsupportedAlg = errors.New("jwt: unsupported signing algorithm")
+	// ErrInvalidSignature is returned when the signature does not match the signing input.
+	ErrInvalidSignature = errors.New("jwt: invalid signature")
+	// ErrInvalidKey is returned when the key type does not match the algorithm.
+	ErrInvalidKey = errors.New("jwt: invalid key for algorithm")
+)
+
+// Header is the JOSE header of a token.
+type Header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid,omitempty"`
+	Typ string `json:"typ,omitempty"`
+}
+
+// Token is a parsed, not yet verified, compact serialized JWS.
+type Token struct {
+	Header Header
+	Claims map[string]any
+
+	signingInput string
+	signature    []byte
+}
+
+// Parse decodes the header and the claims of a token. The signature is not verified,
+// use Verify for that.
+func Parse(token string) (*Token, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+	t := &Token{signingInput: parts[0] + "." + parts[1]}
+
+	raw, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	if err := json.Unmarshal(raw, &t.Header); err != nil {
+		return nil, ErrMalformed
+	}
+	raw, err = base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	if err := json.Unmarshal(raw, &t.Claims); err != nil {
+		return nil, ErrMalformed
+	}
+	if t.signature, err = base64.RawURLEncoding.DecodeString(parts[2]); err != nil {
+		return nil, ErrMalformed
+	}
+	return t, nil
+}
+
+// Verify checks the signature of the token with the given key. The key is a
+// *rsa.PublicKey, an *ecdsa.PublicKey or a []byte secret depending on the algorithm.
+func (t *Token) Verify(key any) error {
+	return verify(t.Header.Alg, key, t.signingInput, t.signature)
+}
+
+// Sign serializes the claims and signs them with the given algorithm and key. The key
+// is a *rsa.PrivateKey, an *ecdsa.PrivateKey or a []byte secret depending on the algorithm.
+func Sign(alg, kid string, key any, claims any) (string, error) {
+	header, err := json.Marshal(Header{Alg: alg, Kid: kid, Typ: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	sig, err := sign(alg, key, signingInput)
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+func hashFor(alg string) (crypto.Hash, error) {
+	if len(alg) != 5 {
+		return 0, ErrUnsupportedAlg
+	}
+	switch alg[2:] {
+	case "256":
+		return crypto.SHA256, nil
+	case "384":
+		return crypto.SHA384, nil
+	case "512":
+		return crypto.SHA512, nil
+	}
+	return 0, ErrUnsupportedAlg
+}
+
+func digest(h crypto.Hash, signingInput string) []byte {
+	hh := h.New()
+	hh.Write([]byte(signingInput))
+	return hh.Sum(nil)
+}
+
+func sign(alg string, key any, signingInput string) ([]byte, error) {
+	h, err := hashFor(alg)
+	if err != nil {
+		return nil, err
+	}
+	switch alg[:2] {
+	case "HS":
+		secret, ok := key.([]byte)
+		if !ok {
+			return nil, ErrInvalidKey
+		}
+		mac := hmac.New(h.New, secret)
+		mac.Write([]byte(signingInput))
+		return mac.Sum(nil), nil
+	case "RS":
+		k, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, ErrInvalidKey
+		}
+		return rsa.SignPKCS1v15(rand.Reader, k, h, digest(h, signingInput))
+	case "PS":
+		k, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, ErrInvalidKey
+		}
+		return rsa.SignPSS(rand.Reader, k, h, digest(h, signingInput), &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	case "ES":
+		k, ok := key.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, ErrInvalidKey
+		}
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest(h, signingInput))
+		if err != nil {
+			return nil, err
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		sig := make([]byte, 2*size)
+		r.FillBytes(sig[:size])
+		s.FillBytes(sig[size:])
+		return sig, nil
+	}
+	return nil, ErrUnsupportedAlg
+}
+
+func verify(alg string, key any, signingInput string, sig []byte) error {
+	h, err := hashFor(alg)
+	if err != nil {
+		return err
+	}
+	switch alg[:2] {
+	case "HS":
+		secret, ok := key.([]byte)
+		if !ok {
+			return ErrInvalidKey
+		}
+		mac := hmac.New(h.New, secret)
+		mac.Write([]byte(signingInput))
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return ErrInvalidSignature
+		}
+		return nil
+	case "RS":
+		k, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return ErrInvalidKey
+		}
+		if err := rsa.VerifyPKCS1v15(k, h, digest(h, signingInput), sig); err != nil {
+			return ErrInvalidSignature
+		}
+		return nil
+	case "PS":
+		k, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return ErrInvalidKey
+		}
+		if err := rsa.VerifyPSS(k, h, digest(h, signingInput), sig, nil); err != nil {
+			return ErrInvalidSignature
+		}
+		return nil
+	case "ES":
+		k, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return ErrInvalidKey
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return ErrInvalidSignature
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(k, digest(h, signingInput), r, s) {
+			return ErrInvalidSignature
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrUnsupportedAlg, alg)
+}
@@ -0,0 +1,156 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/idproxy/gateway/internal/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testKeys(t *testing.T) (*rsa.PrivateKey, *ecdsa.PrivateKey) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return rsaKey, ecKey
+}
+
+// unsigned builds a token with the given header and claims and signature.
+func unsigned(t *testing.T, header Header, claims map[string]any, sig []byte) string {
+	h, err := json.Marshal(header)
+	require.NoError(t, err)
+	c, err := json.Marshal(claims)
+	require.NoError(t, err)
+	return base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c) + "." +
+		base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestSignVerify(t *testing.T) {
+	rsaKey, ecKey := testKeys(t)
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	tests := []struct {
+		alg  string
+		priv any
+		pub  any
+	}{
+		{"HS256", secret, secret},
+		{"HS512", secret, secret},
+		{"RS256", rsaKey, &rsaKey.PublicKey},
+		{"PS384", rsaKey, &rsaKey.PublicKey},
+		{"ES256", ecKey, &ecKey.PublicKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.alg, func(t *testing.T) {
+			raw, err := Sign(tt.alg, "k1", tt.priv, map[string]any{"sub": "alice"})
+			require.NoError(t, err)
+			tok, err := Parse(raw)
+			require.NoError(t, err)
+			assert.Equal(t, Header{Alg: tt.alg, Kid: "k1", Typ: "JWT"}, tok.Header)
+			assert.Equal(t, "alice", tok.Claims["sub"])
+			assert.NoError(t, tok.Verify(tt.pub))
+
+			// The signature covers the claims.
+			parts := strings.Split(raw, ".")
+			forged := unsigned(t, tok.Header, map[string]any{"sub": "mallory"}, nil)
+			tok, err = Parse(strings.Join([]string{parts[0], strings.Split(forged, ".")[1], parts[2]}, "."))
+			require.NoError(t, err)
+			assert.ErrorIs(t, tok.Verify(tt.pub), ErrInvalidSignature)
+		})
+	}
+}
+
+func TestVerifyRejectsNone(t *testing.T) {
+	rsaKey, _ := testKeys(t)
+	for _, alg := range []string{"none", "None", "", "HS1", "RS999"} {
+		tok, err := Parse(unsigned(t, Header{Alg: alg}, map[string]any{"sub": "mallory"}, nil))
+		require.NoError(t, err)
+		assert.ErrorIs(t, tok.Verify(&rsaKey.PublicKey), ErrUnsupportedAlg, "alg %q", alg)
+		assert.ErrorIs(t, tok.Verify([]byte("secret")), ErrUnsupportedAlg, "alg %q", alg)
+	}
+}
+
+func TestVerifyRejectsAlgorithmConfusion(t *testing.T) {
+	rsaKey, ecKey := testKeys(t)
+
+	// An HMAC over the public key, which an attacker knows, must not verify against an
+	// RSA key.
+	der, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	require.NoError(t, err)
+	raw, err := Sign("HS256", "", der, map[string]any{"sub": "mallory"})
+	require.NoError(t, err)
+	tok, err := Parse(raw)
+	require.NoError(t, err)
+	assert.ErrorIs(t, tok.Verify(&rsaKey.PublicKey), ErrInvalidKey)
+
+	raw, err = Sign("ES256", "", ecKey, map[string]any{"sub": "mallory"})
+	require.NoError(t, err)
+	tok, err = Parse(raw)
+	require.NoError(t, err)
+	assert.ErrorIs(t, tok.Verify(&rsaKey.PublicKey), ErrInvalidKey)
+
+	raw, err = Sign("RS256", "", rsaKey, map[string]any{"sub": "mallory"})
+	require.NoError(t, err)
+	tok, err = Parse(raw)
+	require.NoError(t, err)
+	assert.ErrorIs(t, tok.Verify(&ecKey.PublicKey), ErrInvalidKey)
+	assert.ErrorIs(t, tok.Verify([]byte("secret")), ErrInvalidKey)
+
+	_, err = Sign("RS256", "", []byte("secret"), map[string]any{})
+	assert.ErrorIs(t, err, ErrInvalidKey)
+}
+
+func TestParseRejectsMalformed(t *testing.T) {
+	for _, raw := range []string{"", "a.b", "a.b.c.d", "!!.e30.", "e30.!!.", "e30.e30.!!", "bnVsbA.W10.", "e30.W10."} {
+		_, err := Parse(raw)
+		assert.ErrorIs(t, err, ErrMalformed, raw)
+	}
+}
+
+func TestKeySetLookup(t *testing.T) {
+	rsaKey, ecKey := testKeys(t)
+	rsaJWK, err := NewJSONWebKey("rsa", &rsaKey.PublicKey)
+	require.NoError(t, err)
+	ecJWK, err := NewJSONWebKey("ec", &ecKey.PublicKey)
+	require.NoError(t, err)
+
+	set := &KeySet{Keys: []JSONWebKey{rsaJWK, ecJWK}}
+	key, err := set.Lookup("rsa")
+	require.NoError(t, err)
+	assert.True(t, rsaKey.PublicKey.Equal(key))
+	key, err = set.Lookup("ec")
+	require.NoError(t, err)
+	assert.True(t, ecKey.PublicKey.Equal(key))
+
+	_, err = set.Lookup("unknown")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	// Without a kid the key is only implied when the set holds a single key.
+	_, err = set.Lookup("")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	key, err = (&KeySet{Keys: []JSONWebKey{rsaJWK}}).Lookup("")
+	require.NoError(t, err)
+	assert.True(t, rsaKey.PublicKey.Equal(key))
+
+	// Encryption keys are not used to verify signatures.
+	encJWK := rsaJWK
+	encJWK.Use = "enc"
+	_, err = (&KeySet{Keys: []JSONWebKey{encJWK, ecJWK}}).Lookup("rsa")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+
+	// A token signed with another key under a known kid does not verify.
+	other, _ := testKeys(t)
+	raw, err := Sign("RS256", "rsa", other, map[string]any{"sub": "mallory"})
+	require.NoError(t, err)
+	tok, err := Parse(raw)
+	require.NoError(t, err)
+	key, err = set.Lookup(tok.Header.Kid)
+	require.NoError(t, err)
+	assert.ErrorIs(t, tok.Verify(key), ErrInvalidSignature)
+}
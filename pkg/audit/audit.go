@@ -0,0 +1,243 @@
+// Package audit records a tamper-evident trail of security relevant events, separate
+// from access logs. Every entry carries the hash of the previous one, so removing,
+// reordering or changing entries breaks the chain, which Verify detects.
+//
+// The chain is an unkeyed SHA-256 chain: whoever can write the trail can also rewrite
+// it from any point on, or cut off its end, and recompute a valid chain. Such edits are
+// only detected by comparing the hash of the last entry with one anchored outside the
+// trail, e.g. periodically exported to another system.
+package audit
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+// EventType classifies audit events.
+type EventType string
+
+const (
+	// LoginSuccess is recorded when a user signs in.
+	LoginSuccess EventType = "login.success"
+	// LoginFailure is recorded when credentials or a login flow are rejected.
+	LoginFailure EventType = "login.failure"
+	// Logout is recorded when a user signs out.
+	Logout EventType = "logout"
+	// TokenIssued is recorded when the gateway issues a token or session.
+	TokenIssued EventType = "token.issued"
+	// AccessDenied is recorded when an authorization policy denies a request.
+	AccessDenied EventType = "access.denied"
+	// AdminChange is recorded for administrative changes, e.g. of configuration.
+	AdminChange EventType = "admin.change"
+)
+
+// Event is what happened, as recorded by handlers and middlewares.
+type Event struct {
+	Type EventType `json:"type"`
+	// Actor is the subject acting, empty if unknown, e.g. for a failed login.
+	Actor string `json:"actor,omitempty"`
+	// Method is how the actor authenticated, e.g. "oidc" or "basic".
+	Method string `json:"method,omitempty"`
+	// Resource is what the event is about, e.g. a route or a setting.
+	Resource  string         `json:"resource,omitempty"`
+	Reason    string         `json:"reason,omitempty"`
+	ClientIP  string         `json:"clientIp,omitempty"`
+	RequestID string         `json:"requestId,omitempty"`
+	// Details are stored in their JSON form: structs become maps and numbers
+	// json.Number, so that an entry hashes the same once read back.
+	Details map[string]any `json:"details,omitempty"`
+}
+
+// Entry is an Event as stored, chained to the previous entry.
+type Entry struct {
+	Seq      uint64    `json:"seq"`
+	Time     time.Time `json:"time"`
+	Event    Event     `json:"event"`
+	PrevHash string    `json:"prevHash"`
+	Hash     string    `json:"hash"`
+}
+
+// ComputeHash returns the hash of an entry: SHA-256 over the JSON of the entry without
+// its Hash. Entries are hashed with encoding/json, whose output is stable, rather than
+// the configurable internal/json, so that chains verify across builds. Entries read back
+// must be decoded with numbers as json.Number, see DecodeEntry.
+func (e *Entry) ComputeHash() (string, error) {
+	unhashed := *e
+	unhashed.Hash = ""
+	b, err := json.Marshal(&unhashed)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// DecodeEntry decodes the JSON of an entry the way ComputeHash expects it, keeping the
+// numbers in Details as json.Number so that they hash as written.
+func DecodeEntry(b []byte, e *Entry) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	return dec.Decode(e)
+}
+
+// canonicalDetails returns details in the form DecodeEntry reads them back in.
+func canonicalDetails(details map[string]any) (map[string]any, error) {
+	if details == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(details)
+	if err != nil {
+		return nil, err
+	}
+	var canonical map[string]any
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&canonical); err != nil {
+		return nil, err
+	}
+	return canonical, nil
+}
+
+// Sink stores audit entries. Sinks are called in order of Seq by one goroutine at a time.
+type Sink interface {
+	Write(e *Entry) error
+	Close() error
+}
+
+// Resumer is implemented by sinks that persist entries, so that a Logger continues the
+// chain where it stopped.
+type Resumer interface {
+	// Last returns the last stored entry, nil if there is none.
+	Last() (*Entry, error)
+}
+
+var (
+	// ErrClosed is returned when recording to a closed Logger.
+	ErrClosed = errors.New("audit: logger closed")
+	// ErrBroken is returned when recording to a Logger of which a sink failed.
+	ErrBroken = errors.New("audit: logger broken by a failed write, it must be reopened")
+)
+
+// Logger hash-chains events and writes them to its sinks.
+type Logger struct {
+	mu       sync.Mutex
+	sinks    []Sink
+	seq      uint64
+	lastHash string
+	closed   bool
+	broken   bool
+	now      func() time.Time
+}
+
+// New returns a Logger writing to the sinks. The chain continues from the last entry of
+// the first sink implementing Resumer.
+func New(sinks ...Sink) (*Logger, error) {
+	l := &Logger{sinks: sinks, now: time.Now}
+	for _, s := range sinks {
+		if r, ok := s.(Resumer); ok {
+			last, err := r.Last()
+			if err != nil {
+				return nil, err
+			}
+			if last != nil {
+				l.seq, l.lastHash = last.Seq, last.Hash
+			}
+			break
+		}
+	}
+	return l, nil
+}
+
+// Record appends an event to the trail. The entry is written to every sink, the first
+// error is returned. A failed write may still have stored the entry, so rather than
+// reusing its sequence number the Logger fails closed: later calls return ErrBroken
+// until a new Logger is created with New, which resumes after the last stored entry.
+func (l *Logger) Record(e Event) (*Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil, ErrClosed
+	}
+	if l.broken {
+		return nil, ErrBroken
+	}
+	details, err := canonicalDetails(e.Details)
+	if err != nil {
+		return nil, err
+	}
+	e.Details = details
+	entry := &Entry{
+		Seq:      l.seq + 1,
+		Time:     l.now().UTC(),
+		Event:    e,
+		PrevHash: l.lastHash,
+	}
+	hash, err := entry.ComputeHash()
+	if err != nil {
+		return nil, err
+	}
+	entry.Hash = hash
+
+	var firstErr error
+	for _, s := range l.sinks {
+		if err := s.Write(entry); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		l.broken = true
+		return entry, firstErr
+	}
+	l.seq, l.lastHash = entry.Seq, entry.Hash
+	return entry, nil
+}
+
+// Close closes the sinks.
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	var firstErr error
+	for _, s := range l.sinks {
+		if err := s.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// MemorySink keeps entries in memory, e.g. for tests.
+type MemorySink struct {
+	mu      sync.Mutex
+	entries []Entry
+}
+
+var _ Sink = (*MemorySink)(nil)
+
+// Write implements Sink.
+func (s *MemorySink) Write(e *Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, *e)
+	return nil
+}
+
+// Close implements Sink.
+func (s *MemorySink) Close() error {
+	return nil
+}
+
+// Entries returns the entries written so far.
+func (s *MemorySink) Entries() []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Entry(nil), s.entries...)
+}
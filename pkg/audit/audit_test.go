@@ -0,0 +1,268 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoggerChain(t *testing.T) {
+	sink := &MemorySink{}
+	l, err := New(sink)
+	require.NoError(t, err)
+
+	for _, typ := range []EventType{LoginFailure, LoginSuccess, TokenIssued} {
+		_, err := l.Record(Event{Type: typ, Actor: "alice"})
+		require.NoError(t, err)
+	}
+	entries := sink.Entries()
+	require.Len(t, entries, 3)
+	assert.Empty(t, entries[0].PrevHash)
+	for i, e := range entries {
+		assert.EqualValues(t, i+1, e.Seq)
+		if i > 0 {
+			assert.Equal(t, entries[i-1].Hash, e.PrevHash)
+		}
+	}
+
+	require.NoError(t, l.Close())
+	_, err = l.Record(Event{Type: Logout})
+	assert.ErrorIs(t, err, ErrClosed)
+}
+
+// flakySink fails the next write when fail is set.
+type flakySink struct {
+	MemorySink
+	fail bool
+}
+
+func (s *flakySink) Write(e *Entry) error {
+	if s.fail {
+		s.fail = false
+		return errors.New("disk full")
+	}
+	return s.MemorySink.Write(e)
+}
+
+func TestLoggerFailsClosed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	file, err := NewFileSink(FileSinkConfig{Path: path})
+	require.NoError(t, err)
+	flaky := &flakySink{}
+	l, err := New(file, flaky)
+	require.NoError(t, err)
+
+	_, err = l.Record(Event{Type: LoginSuccess, Actor: "alice"})
+	require.NoError(t, err)
+	// the file stores the entry, the other sink does not
+	flaky.fail = true
+	_, err = l.Record(Event{Type: LoginSuccess, Actor: "bob"})
+	assert.Error(t, err)
+	_, err = l.Record(Event{Type: Logout, Actor: "alice"})
+	assert.ErrorIs(t, err, ErrBroken)
+
+	// a new logger resumes after the last stored entry instead of reusing its number
+	l, err = New(file, flaky)
+	require.NoError(t, err)
+	entry, err := l.Record(Event{Type: Logout, Actor: "alice"})
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, entry.Seq)
+	require.NoError(t, l.Close())
+
+	n, err := VerifyFiles(path)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+}
+
+func encodeEntries(t *testing.T, entries []Entry) *bytes.Buffer {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for i := range entries {
+		require.NoError(t, enc.Encode(&entries[i]))
+	}
+	return &buf
+}
+
+func TestVerify(t *testing.T) {
+	sink := &MemorySink{}
+	l, _ := New(sink)
+	for i := 0; i < 4; i++ {
+		_, _ = l.Record(Event{Type: AccessDenied, Resource: "GET /admin"})
+	}
+	entries := sink.Entries()
+
+	last, err := Verify(encodeEntries(t, entries), nil)
+	require.NoError(t, err)
+	assert.EqualValues(t, 4, last.Seq)
+
+	tampered := append([]Entry(nil), entries...)
+	tampered[1].Event.Actor = "mallory"
+	_, err = Verify(encodeEntries(t, tampered), nil)
+	var verr *VerifyError
+	require.ErrorAs(t, err, &verr)
+	assert.EqualValues(t, 2, verr.Seq)
+	assert.Contains(t, verr.Reason, "modified")
+
+	removed := append(append([]Entry(nil), entries[:2]...), entries[3:]...)
+	_, err = Verify(encodeEntries(t, removed), nil)
+	require.ErrorAs(t, err, &verr)
+	assert.Contains(t, verr.Reason, "missing")
+
+	// Entries after a known point must continue from it.
+	_, err = Verify(encodeEntries(t, entries[2:]), &entries[0])
+	require.ErrorAs(t, err, &verr)
+	last, err = Verify(encodeEntries(t, entries[2:]), &Entry{Seq: entries[1].Seq, Hash: entries[1].Hash})
+	require.NoError(t, err)
+	assert.EqualValues(t, 4, last.Seq)
+
+	// Without a known point the trail must start at the first entry.
+	_, err = Verify(encodeEntries(t, entries[1:]), nil)
+	require.ErrorAs(t, err, &verr)
+	assert.EqualValues(t, 2, verr.Seq)
+	assert.Contains(t, verr.Reason, "start of the trail")
+
+	// Cutting off the end leaves a valid chain, only the anchored hash tells.
+	last, err = Verify(encodeEntries(t, entries[:3]), nil)
+	require.NoError(t, err)
+	assert.NotEqual(t, entries[3].Hash, last.Hash)
+}
+
+func TestFileSinkRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	conf := FileSinkConfig{Path: path, MaxBytes: 600, MaxBackups: 2}
+	sink, err := NewFileSink(conf)
+	require.NoError(t, err)
+	l, err := New(sink)
+	require.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		_, err := l.Record(Event{Type: LoginSuccess, Actor: "alice", Method: "oidc"})
+		require.NoError(t, err)
+	}
+	require.NoError(t, l.Close())
+
+	// The chain continues after a restart.
+	sink, err = NewFileSink(conf)
+	require.NoError(t, err)
+	l, err = New(sink)
+	require.NoError(t, err)
+	entry, err := l.Record(Event{Type: Logout, Actor: "alice"})
+	require.NoError(t, err)
+	assert.EqualValues(t, 6, entry.Seq)
+	require.NoError(t, l.Close())
+
+	files := RotatedFiles(path)
+	assert.Equal(t, []string{path + ".2", path + ".1", path}, files)
+	n, err := VerifyFiles(files...)
+	require.NoError(t, err)
+	assert.Greater(t, n, 1)
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, []byte(strings.Replace(string(b), "alice", "bob", 1)), 0o600))
+	_, err = VerifyFiles(files...)
+	var verr *VerifyError
+	require.ErrorAs(t, err, &verr)
+	assert.Equal(t, path, verr.File)
+}
+
+func TestVerifyFilesFrom(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink, err := NewFileSink(FileSinkConfig{Path: path, MaxBytes: 300, MaxBackups: 1})
+	require.NoError(t, err)
+	l, err := New(sink)
+	require.NoError(t, err)
+	var entries []*Entry
+	for i := 0; i < 6; i++ {
+		e, err := l.Record(Event{Type: LoginSuccess, Actor: "alice"})
+		require.NoError(t, err)
+		entries = append(entries, e)
+	}
+	require.NoError(t, l.Close())
+
+	// the oldest files were deleted
+	files := RotatedFiles(path)
+	_, err = VerifyFiles(files...)
+	var verr *VerifyError
+	require.ErrorAs(t, err, &verr)
+	assert.Equal(t, files[0], verr.File)
+
+	b, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	var first Entry
+	require.NoError(t, json.Unmarshal(b[:bytes.IndexByte(b, '\n')], &first))
+	require.Greater(t, first.Seq, uint64(1))
+	anchor := entries[first.Seq-2]
+
+	last, n, err := VerifyFilesFrom(&Entry{Seq: anchor.Seq, Hash: anchor.Hash}, files...)
+	require.NoError(t, err)
+	assert.Equal(t, entries[5].Hash, last.Hash)
+	assert.EqualValues(t, 6-anchor.Seq, n)
+}
+
+// shortWriteFile writes half of the next line and fails when fail is set.
+type shortWriteFile struct {
+	*os.File
+	fail bool
+}
+
+func (f *shortWriteFile) Write(b []byte) (int, error) {
+	if f.fail {
+		f.fail = false
+		n, _ := f.File.Write(b[:len(b)/2])
+		return n, errors.New("disk full")
+	}
+	return f.File.Write(b)
+}
+
+func TestFileSinkDropsShortWrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink, err := NewFileSink(FileSinkConfig{Path: path})
+	require.NoError(t, err)
+	file := &shortWriteFile{File: sink.file.(*os.File)}
+	sink.file = file
+	l, err := New(sink)
+	require.NoError(t, err)
+
+	_, err = l.Record(Event{Type: LoginSuccess, Actor: "alice"})
+	require.NoError(t, err)
+	file.fail = true
+	_, err = l.Record(Event{Type: LoginSuccess, Actor: "bob"})
+	assert.Error(t, err)
+
+	l, err = New(sink)
+	require.NoError(t, err)
+	entry, err := l.Record(Event{Type: Logout, Actor: "alice"})
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, entry.Seq)
+	require.NoError(t, l.Close())
+
+	n, err := VerifyFiles(path)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+}
+
+func TestVerifyDetails(t *testing.T) {
+	type change struct {
+		Setting string `json:"setting"`
+		Old     int64  `json:"old"`
+		New     int64  `json:"new"`
+	}
+	sink := &MemorySink{}
+	l, _ := New(sink)
+	_, err := l.Record(Event{Type: AdminChange, Details: map[string]any{
+		"change": change{Setting: "max_body", Old: 1 << 60, New: 1<<60 + 1},
+		"ratio":  0.5,
+	}})
+	require.NoError(t, err)
+
+	last, err := Verify(encodeEntries(t, sink.Entries()), nil)
+	require.NoError(t, err)
+	assert.Equal(t, json.Number("1152921504606846977"), last.Event.Details["change"].(map[string]any)["new"])
+}
@@ -0,0 +1,219 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// FileSinkConfig defines the config for FileSink.
+type FileSinkConfig struct {
+	// Path is the file entries are appended to as JSON lines.
+	Path string
+
+	// MaxBytes is the size after which the file is rotated to Path.1, Path.1 to Path.2
+	// and so on.
+	// Optional. Default value is 100 MiB.
+	MaxBytes int64
+
+	// MaxBackups is the number of rotated files kept, the oldest is deleted. The
+	// remaining files then no longer start the trail, see VerifyFilesFrom.
+	// Optional. Default value is 10.
+	MaxBackups int
+
+	// Sync calls fsync after every entry.
+	// Optional. Default value is false.
+	Sync bool
+}
+
+// FileSink appends entries to a file as JSON lines and rotates it by size. The chain
+// continues across rotated files.
+type FileSink struct {
+	config FileSinkConfig
+
+	mu   sync.Mutex
+	file auditFile
+	size int64
+}
+
+// auditFile is the part of *os.File used by FileSink.
+type auditFile interface {
+	io.WriteCloser
+	Sync() error
+	Truncate(size int64) error
+}
+
+var (
+	_ Sink    = (*FileSink)(nil)
+	_ Resumer = (*FileSink)(nil)
+)
+
+// NewFileSink opens or creates the file of the sink.
+func NewFileSink(conf FileSinkConfig) (*FileSink, error) {
+	if conf.Path == "" {
+		return nil, errors.New("audit: file sink needs a path")
+	}
+	if conf.MaxBytes <= 0 {
+		conf.MaxBytes = 100 << 20
+	}
+	if conf.MaxBackups <= 0 {
+		conf.MaxBackups = 10
+	}
+	s := &FileSink{config: conf}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileSink) open() error {
+	f, err := os.OpenFile(s.config.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.file, s.size = f, info.Size()
+	return nil
+}
+
+// Write implements Sink.
+func (s *FileSink) Write(e *Entry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return ErrClosed
+	}
+	if s.size > 0 && s.size+int64(len(line)) > s.config.MaxBytes {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := s.file.Write(line)
+	if err != nil {
+		// drop what was written of the line, a truncated entry would make the trail
+		// unverifiable
+		if n > 0 {
+			if terr := s.file.Truncate(s.size); terr != nil {
+				s.size += int64(n)
+				return errors.Join(err, terr)
+			}
+		}
+		return err
+	}
+	s.size += int64(n)
+	if s.config.Sync {
+		return s.file.Sync()
+	}
+	return nil
+}
+
+func (s *FileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	s.file = nil
+	path := s.config.Path
+	_ = os.Remove(fmt.Sprintf("%s.%d", path, s.config.MaxBackups))
+	for i := s.config.MaxBackups - 1; i >= 1; i-- {
+		old := fmt.Sprintf("%s.%d", path, i)
+		if _, err := os.Stat(old); err == nil {
+			if err := os.Rename(old, fmt.Sprintf("%s.%d", path, i+1)); err != nil {
+				return err
+			}
+		}
+	}
+	if err := os.Rename(path, path+".1"); err != nil {
+		return err
+	}
+	return s.open()
+}
+
+// Close implements Sink.
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// Last implements Resumer. It reads the last entry of the file, or of the newest rotated
+// file if the file is empty.
+func (s *FileSink) Last() (*Entry, error) {
+	for _, path := range []string{s.config.Path, s.config.Path + ".1"} {
+		entry, err := lastEntry(path)
+		if err != nil || entry != nil {
+			return entry, err
+		}
+	}
+	return nil, nil
+}
+
+func lastEntry(path string) (*Entry, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var last []byte
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			last = line
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if last == nil {
+		return nil, nil
+	}
+	var e Entry
+	if err := DecodeEntry(last, &e); err != nil {
+		return nil, fmt.Errorf("audit: reading last entry of %s: %w", path, err)
+	}
+	return &e, nil
+}
+
+// RotatedFiles returns the files of a FileSink writing to path that exist, oldest first,
+// as VerifyFiles expects them.
+func RotatedFiles(path string) []string {
+	var paths []string
+	for i := 1; ; i++ {
+		if _, err := os.Stat(fmt.Sprintf("%s.%d", path, i)); err != nil {
+			break
+		}
+		paths = append(paths, fmt.Sprintf("%s.%d", path, i))
+	}
+	for i, j := 0, len(paths)-1; i < j; i, j = i+1, j-1 {
+		paths[i], paths[j] = paths[j], paths[i]
+	}
+	if _, err := os.Stat(path); err == nil {
+		paths = append(paths, path)
+	}
+	return paths
+}
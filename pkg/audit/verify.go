@@ -0,0 +1,102 @@
+package audit
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+)
+
+// VerifyError describes where an audit trail is broken.
+type VerifyError struct {
+	File   string
+	Line   int
+	Seq    uint64
+	Reason string
+}
+
+func (e *VerifyError) Error() string {
+	if e.File != "" {
+		return fmt.Sprintf("audit: %s:%d: entry %d: %s", e.File, e.Line, e.Seq, e.Reason)
+	}
+	return fmt.Sprintf("audit: line %d: entry %d: %s", e.Line, e.Seq, e.Reason)
+}
+
+// Verify checks the JSON lines of r. prev is the last entry before r, nil if r starts
+// the trail. It returns the last entry read, whose hash must be compared with an
+// anchored one to detect that entries were cut off at the end.
+func Verify(r io.Reader, prev *Entry) (*Entry, error) {
+	last, _, err := verify(r, prev)
+	return last, err
+}
+
+func verify(r io.Reader, prev *Entry) (*Entry, int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 16<<20)
+	line, n := 0, 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e Entry
+		if err := DecodeEntry(scanner.Bytes(), &e); err != nil {
+			return prev, n, &VerifyError{Line: line, Reason: "malformed entry: " + err.Error()}
+		}
+		hash, err := e.ComputeHash()
+		if err != nil {
+			return prev, n, &VerifyError{Line: line, Seq: e.Seq, Reason: err.Error()}
+		}
+		if hash != e.Hash {
+			return prev, n, &VerifyError{Line: line, Seq: e.Seq, Reason: "hash mismatch, entry was modified"}
+		}
+		if prev != nil {
+			if e.Seq != prev.Seq+1 {
+				return prev, n, &VerifyError{Line: line, Seq: e.Seq, Reason: fmt.Sprintf("expected entry %d, entries are missing or reordered", prev.Seq+1)}
+			}
+			if e.PrevHash != prev.Hash {
+				return prev, n, &VerifyError{Line: line, Seq: e.Seq, Reason: "previous hash mismatch, chain is broken"}
+			}
+		} else if e.Seq != 1 {
+			return prev, n, &VerifyError{Line: line, Seq: e.Seq, Reason: "expected entry 1, the start of the trail is missing"}
+		} else if e.PrevHash != "" {
+			return prev, n, &VerifyError{Line: line, Seq: e.Seq, Reason: "first entry has a previous hash"}
+		}
+		prev = &e
+		n++
+	}
+	return prev, n, scanner.Err()
+}
+
+// VerifyFiles checks files forming one trail from its first entry, oldest first, e.g. the
+// rotated files of a FileSink followed by the current file. It returns the number of
+// entries verified.
+func VerifyFiles(paths ...string) (int, error) {
+	_, n, err := VerifyFilesFrom(nil, paths...)
+	return n, err
+}
+
+// VerifyFilesFrom checks files continuing the trail after prev, e.g. once the oldest
+// rotated files of a FileSink were deleted. Only Seq and Hash of prev are used, so it
+// may be built from an anchored hash. With a nil prev the files must start the trail.
+// It returns the last entry verified and the number of entries verified.
+func VerifyFilesFrom(prev *Entry, paths ...string) (*Entry, int, error) {
+	count := 0
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return prev, count, err
+		}
+		last, n, err := verify(f, prev)
+		f.Close()
+		count += n
+		if err != nil {
+			if ve, ok := err.(*VerifyError); ok {
+				ve.File = path
+			}
+			return last, count, err
+		}
+		prev = last
+	}
+	return prev, count, nil
+}
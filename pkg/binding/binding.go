@@ -14,4 +14,6 @@ const (
 	MIMEMSGPACK2          = "application/msgpack"
 	MIMEYAML              = "application/x-yaml"
 	MIMETOML              = "application/toml"
+	MIMEProblemJSON       = "application/problem+json"
+	MIMEProblemXML        = "application/problem+xml"
 )
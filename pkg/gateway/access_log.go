@@ -0,0 +1,157 @@
+package gateway
+
+import (
+	"context"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// UpstreamLatencyKey is the key handlers proxying a request store the latency of the
+// upstream under in Context.Keys, as a time.Duration, for the access log.
+const UpstreamLatencyKey = "gateway/upstream_latency"
+
+// LogFormat is the format of the access log written by LoggerWithConfig.
+type LogFormat int
+
+const (
+	// LogFormatText writes the lines of LoggerConfig.Formatter.
+	LogFormatText LogFormat = iota
+	// LogFormatJSON writes one JSON object per request through log/slog.
+	LogFormatJSON
+	// LogFormatLogfmt writes one line of key=value pairs per request through log/slog.
+	LogFormatLogfmt
+)
+
+// LogField selects optional fields of the structured access log.
+type LogField uint
+
+const (
+	// LogFieldRoute adds the matched route template.
+	LogFieldRoute LogField = 1 << iota
+	// LogFieldPrincipal adds the subject and authentication method of the principal.
+	LogFieldPrincipal
+	// LogFieldRequestID adds the request and trace IDs.
+	LogFieldRequestID
+	// LogFieldBytes adds the request and response sizes.
+	LogFieldBytes
+	// LogFieldUpstreamLatency adds the latency stored under UpstreamLatencyKey.
+	LogFieldUpstreamLatency
+	// LogFieldUserAgent adds the User-Agent header.
+	LogFieldUserAgent
+)
+
+// DefaultLogFields are the fields of the structured access log by default.
+const DefaultLogFields = LogFieldRoute | LogFieldPrincipal | LogFieldRequestID | LogFieldBytes |
+	LogFieldUpstreamLatency | LogFieldUserAgent
+
+// DefaultRedactedQueryParams are the query parameters redacted in access logs by default,
+// mostly OAuth2 and OIDC credentials.
+var DefaultRedactedQueryParams = []string{
+	"access_token", "id_token", "refresh_token", "token", "code", "state",
+	"client_secret", "password", "api_key", "apikey",
+}
+
+// sampled reports whether a request is logged. Failed requests are always logged.
+func sampled(c *Context, rate float64) bool {
+	if rate >= 1 || c.Writer.Status() >= http.StatusInternalServerError || len(c.Errors) > 0 {
+		return true
+	}
+	return rand.Float64() < rate
+}
+
+// redactQuery replaces the values of sensitive query parameters, keeping the rest of
+// the query as sent.
+func redactQuery(raw string, params []string) string {
+	if len(params) == 0 {
+		return raw
+	}
+	parts := strings.Split(raw, "&")
+	for i, part := range parts {
+		key, _, _ := strings.Cut(part, "=")
+		if name, err := url.QueryUnescape(key); err == nil {
+			key = name
+		}
+		for _, p := range params {
+			if strings.EqualFold(key, p) {
+				parts[i] = part[:strings.IndexByte(part+"=", '=')] + "=REDACTED"
+				break
+			}
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// logAccess writes a structured access log record. 5xx responses are logged at error
+// level, 4xx at warn level.
+func logAccess(logger *slog.Logger, conf *LoggerConfig, c *Context, param LogFormatterParams) {
+	level := slog.LevelInfo
+	switch {
+	case param.StatusCode >= http.StatusInternalServerError:
+		level = slog.LevelError
+	case param.StatusCode >= http.StatusBadRequest:
+		level = slog.LevelWarn
+	}
+
+	attrs := []slog.Attr{
+		slog.String("method", param.Method),
+		slog.String("path", param.Path),
+		slog.Int("status", param.StatusCode),
+		slog.Float64("latency_ms", float64(param.Latency.Microseconds())/1000),
+		slog.String("client_ip", param.ClientIP),
+	}
+	fields := conf.Fields
+	if fields&LogFieldRoute != 0 && param.Route != "" {
+		attrs = append(attrs, slog.String("route", param.Route))
+	}
+	if fields&LogFieldRequestID != 0 {
+		if param.RequestID != "" {
+			attrs = append(attrs, slog.String("request_id", param.RequestID))
+		}
+		if param.TraceID != "" {
+			attrs = append(attrs, slog.String("trace_id", param.TraceID))
+		}
+	}
+	if fields&LogFieldPrincipal != 0 && param.Principal != nil {
+		attrs = append(attrs, slog.String("user", param.Principal.Subject), slog.String("auth_method", param.Principal.Method))
+	}
+	if fields&LogFieldBytes != 0 {
+		if param.RequestSize >= 0 {
+			attrs = append(attrs, slog.Int64("bytes_in", param.RequestSize))
+		}
+		if param.BodySize >= 0 {
+			attrs = append(attrs, slog.Int("bytes_out", param.BodySize))
+		}
+	}
+	if fields&LogFieldUpstreamLatency != 0 && param.UpstreamLatency > 0 {
+		attrs = append(attrs, slog.Float64("upstream_latency_ms", float64(param.UpstreamLatency.Microseconds())/1000))
+	}
+	if fields&LogFieldUserAgent != 0 {
+		if ua := c.Request.UserAgent(); ua != "" {
+			attrs = append(attrs, slog.String("user_agent", ua))
+		}
+	}
+	if group := headerAttrs(c.Request.Header, conf.RequestHeaders); group != nil {
+		attrs = append(attrs, slog.Attr{Key: "request_headers", Value: slog.GroupValue(group...)})
+	}
+	if group := headerAttrs(c.Writer.Header(), conf.ResponseHeaders); group != nil {
+		attrs = append(attrs, slog.Attr{Key: "response_headers", Value: slog.GroupValue(group...)})
+	}
+	if param.ErrorMessage != "" {
+		attrs = append(attrs, slog.String("error", strings.TrimSpace(param.ErrorMessage)))
+	}
+
+	logger.LogAttrs(context.Background(), level, "request", attrs...)
+}
+
+func headerAttrs(h http.Header, names []string) []slog.Attr {
+	var attrs []slog.Attr
+	for _, name := range names {
+		if values := h.Values(name); len(values) > 0 {
+			attrs = append(attrs, slog.String(strings.ToLower(name), strings.Join(values, ", ")))
+		}
+	}
+	return attrs
+}
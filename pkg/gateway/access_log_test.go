@@ -0,0 +1,92 @@
+package gateway
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/idproxy/gateway/internal/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactQuery(t *testing.T) {
+	assert.Equal(t, "code=REDACTED&state=REDACTED&rd=%2Fapp", redactQuery("code=abc&state=xyz&rd=%2Fapp", DefaultRedactedQueryParams))
+	assert.Equal(t, "Access_Token=REDACTED&a", redactQuery("Access_Token=abc&a", DefaultRedactedQueryParams))
+	assert.Equal(t, "token=REDACTED", redactQuery("token", DefaultRedactedQueryParams))
+	assert.Equal(t, "code=abc", redactQuery("code=abc", []string{}))
+}
+
+func TestLoggerJSON(t *testing.T) {
+	var out bytes.Buffer
+	r := New()
+	r.Use(LoggerWithConfig(LoggerConfig{
+		Output:          &out,
+		Format:          LogFormatJSON,
+		RequestHeaders:  []string{"X-Tenant"},
+		ResponseHeaders: []string{"Content-Type"},
+	}), RequestID(RequestIDConfig{}))
+	r.GET("/users/:id", func(c *Context) {
+		c.SetPrincipal(&Principal{Subject: "alice", Method: "basic"})
+		c.Set(UpstreamLatencyKey, 1500*time.Microsecond)
+		c.String(http.StatusOK, "ok")
+	})
+
+	w := performRequestWithHeader(r, http.MethodGet, "/users/1?code=secret&x=1", http.Header{
+		"X-Tenant":   {"acme"},
+		"User-Agent": {"test"},
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal(out.Bytes(), &entry))
+	assert.Equal(t, "INFO", entry["level"])
+	assert.Equal(t, "request", entry["msg"])
+	assert.Equal(t, "GET", entry["method"])
+	assert.Equal(t, "/users/1?code=REDACTED&x=1", entry["path"])
+	assert.Equal(t, "/users/:id", entry["route"])
+	assert.EqualValues(t, 200, entry["status"])
+	assert.Equal(t, "alice", entry["user"])
+	assert.Equal(t, "basic", entry["auth_method"])
+	assert.Equal(t, w.Header().Get("X-Request-ID"), entry["request_id"])
+	assert.NotEmpty(t, entry["trace_id"])
+	assert.EqualValues(t, 2, entry["bytes_out"])
+	assert.EqualValues(t, 1.5, entry["upstream_latency_ms"])
+	assert.Equal(t, "test", entry["user_agent"])
+	assert.Equal(t, map[string]any{"x-tenant": "acme"}, entry["request_headers"])
+	assert.Equal(t, map[string]any{"content-type": "text/plain; charset=utf-8"}, entry["response_headers"])
+	assert.NotContains(t, out.String(), "secret")
+}
+
+func TestLoggerLogfmtSampling(t *testing.T) {
+	var out bytes.Buffer
+	r := New()
+	r.Use(LoggerWithConfig(LoggerConfig{Output: &out, Format: LogFormatLogfmt, SampleRate: 1e-12, Fields: LogFieldRoute}))
+	r.GET("/ok", func(c *Context) {})
+	r.GET("/fail", func(c *Context) {
+		c.Status(http.StatusBadGateway)
+	})
+
+	performRequest(r, http.MethodGet, "/ok")
+	assert.Zero(t, out.Len())
+
+	performRequest(r, http.MethodGet, "/fail")
+	line := out.String()
+	assert.True(t, strings.HasPrefix(line, "time="), line)
+	assert.Contains(t, line, "level=ERROR msg=request method=GET path=/fail status=502")
+	assert.Contains(t, line, "route=/fail")
+	assert.NotContains(t, line, "bytes_out")
+}
+
+func TestLoggerText(t *testing.T) {
+	var out bytes.Buffer
+	r := New()
+	r.Use(LoggerWithConfig(LoggerConfig{Output: &out}))
+	r.GET("/", func(c *Context) {})
+
+	performRequest(r, http.MethodGet, "/?token=abc")
+	assert.True(t, strings.HasPrefix(out.String(), "[GW] "), out.String())
+	assert.Contains(t, out.String(), `"/?token=REDACTED"`)
+}
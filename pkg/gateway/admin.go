@@ -0,0 +1,156 @@
+package gateway
+
+import (
+	"errors"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+)
+
+var errNoBuildInfo = errors.New("admin: binary has no build info")
+
+// poolStats counts the use of the Context pool.
+type poolStats struct {
+	allocated atomic.Uint64
+	acquired  atomic.Uint64
+	inUse     atomic.Int64
+}
+
+// PoolStats describes the use of the Context pool of a gateway.
+type PoolStats struct {
+	// Acquired is the number of Contexts taken from the pool.
+	Acquired uint64 `json:"acquired"`
+	// Allocated is the number of Contexts the pool had to allocate.
+	Allocated uint64 `json:"allocated"`
+	// InUse is the number of Contexts currently serving requests.
+	InUse int64 `json:"in_use"`
+}
+
+func (r *Gateway) acquireContext() *Context {
+	r.poolStats.acquired.Add(1)
+	r.poolStats.inUse.Add(1)
+	return r.pool.Get().(*Context)
+}
+
+func (r *Gateway) releaseContext(c *Context) {
+	r.poolStats.inUse.Add(-1)
+	r.pool.Put(c)
+}
+
+// PoolStats returns the statistics of the Context pool.
+func (r *Gateway) PoolStats() PoolStats {
+	return PoolStats{
+		Acquired:  r.poolStats.acquired.Load(),
+		Allocated: r.poolStats.allocated.Load(),
+		InUse:     r.poolStats.inUse.Load(),
+	}
+}
+
+// AdminConfig defines the config for RouterGroup.Admin.
+type AdminConfig struct {
+	// Auth are the middlewares authenticating and authorizing admin requests, e.g.
+	// BasicAuth or an authentication middleware followed by Authorize.
+	// Required.
+	Auth HandlersChain
+
+	// DisablePprof removes the /debug/pprof routes.
+	// Optional. Default value is false.
+	DisablePprof bool
+}
+
+// adminRoute is an entry of the route table of the admin routes.
+type adminRoute struct {
+	Method      string `json:"method"`
+	Path        string `json:"path"`
+	Handler     string `json:"handler"`
+	Middlewares int    `json:"middlewares"`
+}
+
+// Admin returns a new router group for runtime introspection, guarded by conf.Auth:
+//
+//   - GET /routes lists the routes with their handler and number of middlewares,
+//   - GET /runtime reports the router limits, pool statistics and Go runtime,
+//   - GET /build reports the build info of the binary,
+//   - /debug/pprof/ serves the net/http/pprof profiles.
+//
+// The admin routes are not registered unless Admin is called.
+func (r *RouterGroup) Admin(relativePath string, conf AdminConfig) *RouterGroup {
+	assert1(len(conf.Auth) > 0, "admin routes must be protected by an auth middleware")
+	group := r.Group(relativePath, conf.Auth...)
+	g := r.gateway
+
+	group.GET("/routes", func(c *Context) {
+		c.JSON(http.StatusOK, g.routeTable())
+	})
+	group.GET("/runtime", func(c *Context) {
+		var mem runtime.MemStats
+		runtime.ReadMemStats(&mem)
+		c.JSON(http.StatusOK, map[string]any{
+			"max_params":   g.maxParams,
+			"max_sections": g.maxSections,
+			"pool":         g.PoolStats(),
+			"goroutines":   runtime.NumGoroutine(),
+			"gomaxprocs":   runtime.GOMAXPROCS(0),
+			"heap_alloc":   mem.HeapAlloc,
+			"heap_objects": mem.HeapObjects,
+			"num_gc":       mem.NumGC,
+			"last_gc":      time.Unix(0, int64(mem.LastGC)).UTC(),
+		})
+	})
+	group.GET("/build", func(c *Context) {
+		info, ok := debug.ReadBuildInfo()
+		if !ok {
+			_ = c.AbortWithError(http.StatusNotFound, &Error{Err: errNoBuildInfo, Type: ErrorTypePublic})
+			return
+		}
+		settings := make(map[string]string, len(info.Settings))
+		for _, s := range info.Settings {
+			settings[s.Key] = s.Value
+		}
+		c.JSON(http.StatusOK, map[string]any{
+			"go_version": info.GoVersion,
+			"path":       info.Path,
+			"version":    info.Main.Version,
+			"settings":   settings,
+		})
+	})
+
+	if !conf.DisablePprof {
+		// pprof.Index only resolves profile names below /debug/pprof/ at the root, so the
+		// profiles are registered one by one.
+		pp := group.Group("/debug/pprof")
+		pp.GET("/", WrapF(pprof.Index))
+		pp.GET("/cmdline", WrapF(pprof.Cmdline))
+		pp.GET("/profile", WrapF(pprof.Profile))
+		pp.GET("/symbol", WrapF(pprof.Symbol))
+		pp.POST("/symbol", WrapF(pprof.Symbol))
+		pp.GET("/trace", WrapF(pprof.Trace))
+		for _, name := range []string{"allocs", "block", "goroutine", "heap", "mutex", "threadcreate"} {
+			pp.GET("/"+name, WrapH(pprof.Handler(name)))
+		}
+	}
+	return group
+}
+
+// routeTable returns the routes with the number of middlewares in front of their
+// handler, ordered like Routes.
+func (r *Gateway) routeTable() []adminRoute {
+	middlewares := make(map[[2]string]int)
+	r.walkRoutes(func(method, path string, handlers HandlersChain) {
+		middlewares[[2]string{method, path}] = len(handlers) - 1
+	})
+	routes := r.Routes()
+	table := make([]adminRoute, len(routes))
+	for i, route := range routes {
+		table[i] = adminRoute{
+			Method:      route.Method,
+			Path:        route.Path,
+			Handler:     route.Handler,
+			Middlewares: middlewares[[2]string{route.Method, route.Path}],
+		}
+	}
+	return table
+}
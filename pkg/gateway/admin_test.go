@@ -0,0 +1,76 @@
+package gateway
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/idproxy/gateway/internal/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAdminRoutes(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	r := New()
+	assert.Panics(t, func() { r.Admin("/admin", AdminConfig{}) })
+	r.Admin("/admin", AdminConfig{Auth: HandlersChain{BasicAuth(Accounts{"ops": string(hash)})}})
+	r.GET("/users/:id/keys/:key", func(c *Context) {})
+
+	assert.Equal(t, http.StatusUnauthorized, performRequest(r, http.MethodGet, "/admin/routes").Code)
+
+	req, _ := http.NewRequest(http.MethodGet, "/", nil)
+	req.SetBasicAuth("ops", "secret")
+	auth := req.Header
+
+	w := performRequestWithHeader(r, http.MethodGet, "/admin/routes", auth)
+	require.Equal(t, http.StatusOK, w.Code)
+	var routes []adminRoute
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &routes))
+	assert.Contains(t, routes, adminRoute{
+		Method:  http.MethodGet,
+		Path:    "/users/:id/keys/:key",
+		Handler: "github.com/idproxy/gateway/pkg/gateway.TestAdminRoutes.func2",
+	})
+	for _, route := range routes {
+		if route.Path == "/admin/routes" {
+			assert.Equal(t, 1, route.Middlewares)
+		}
+	}
+
+	w = performRequestWithHeader(r, http.MethodGet, "/admin/runtime", auth)
+	require.Equal(t, http.StatusOK, w.Code)
+	var stats map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.EqualValues(t, 2, stats["max_params"])
+	assert.EqualValues(t, 4, stats["max_sections"])
+	pool := stats["pool"].(map[string]any)
+	assert.EqualValues(t, 1, pool["in_use"])
+	assert.GreaterOrEqual(t, pool["acquired"], float64(3))
+
+	assert.Equal(t, http.StatusOK, performRequestWithHeader(r, http.MethodGet, "/admin/build", auth).Code)
+	w = performRequestWithHeader(r, http.MethodGet, "/admin/debug/pprof/", auth)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "goroutine")
+	w = performRequestWithHeader(r, http.MethodGet, "/admin/debug/pprof/goroutine?debug=1", auth)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "goroutine profile")
+	assert.Equal(t, http.StatusUnauthorized, performRequest(r, http.MethodGet, "/admin/debug/pprof/heap").Code)
+}
+
+func TestPoolStatsAfterAbortedRequest(t *testing.T) {
+	r := New()
+	r.Use(Recovery())
+	r.GET("/abort", func(c *Context) {
+		panic(http.ErrAbortHandler)
+	})
+
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		performRequest(r, http.MethodGet, "/abort")
+	})
+	stats := r.PoolStats()
+	assert.EqualValues(t, 1, stats.Acquired)
+	assert.Zero(t, stats.InUse)
+}
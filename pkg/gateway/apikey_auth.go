@@ -0,0 +1,88 @@
+package gateway
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// ErrAPIKeyExpired is recorded when a request carries an expired API key.
+var ErrAPIKeyExpired = errors.New("authentication: api key expired")
+
+// APIKey describes an API key. Only the hash of the key is kept, see HashAPIKey.
+type APIKey struct {
+	// ID identifies the key holder and becomes the principal subject.
+	ID string
+	// Hash is the hex encoded SHA-256 of the key.
+	Hash string
+	// Scopes granted to the key.
+	Scopes []string
+	// ExpiresAt is the time after which the key is rejected. The zero value never expires.
+	ExpiresAt time.Time
+}
+
+// APIKeyAuthConfig defines the config for APIKeyAuth middleware.
+type APIKeyAuthConfig struct {
+	// Keys are the accepted API keys.
+	Keys []APIKey
+
+	// Header is the request header carrying the key.
+	// Optional. Default value is "X-API-Key".
+	Header string
+
+	// QueryParam is the query parameter carrying the key when the header is absent.
+	// Keys in URLs end up in logs and browser histories, so it is disabled by default.
+	// Optional.
+	QueryParam string
+}
+
+// HashAPIKey returns the hash of key as stored in APIKey.Hash. API keys are random high
+// entropy secrets, so a fast unsalted hash is sufficient to keep them out of configs.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIKeyAuth returns a middleware authenticating requests by API key. The principal of
+// the key is stored in c.Keys, requests with a missing, unknown or expired key are
+// aborted with 401.
+func APIKeyAuth(conf APIKeyAuthConfig) HandlerFunc {
+	if conf.Header == "" {
+		conf.Header = "X-API-Key"
+	}
+	keys := make(map[[sha256.Size]byte]APIKey, len(conf.Keys))
+	for _, k := range conf.Keys {
+		var h [sha256.Size]byte
+		b, err := hex.DecodeString(k.Hash)
+		assert1(err == nil && len(b) == sha256.Size, "api key auth: invalid hash for key "+k.ID)
+		copy(h[:], b)
+		keys[h] = k
+	}
+
+	return func(c *Context) {
+		raw := c.GetHeader(conf.Header)
+		if raw == "" && conf.QueryParam != "" {
+			raw = c.Query(conf.QueryParam)
+		}
+		sum := sha256.Sum256([]byte(raw))
+		key, ok := keys[sum]
+		if raw == "" || !ok {
+			c.auditLoginFailure("apikey", "", ErrInvalidCredentials)
+			_ = c.AbortWithError(http.StatusUnauthorized, &Error{Err: ErrInvalidCredentials, Type: ErrorTypePublic})
+			return
+		}
+		if !key.ExpiresAt.IsZero() && time.Now().After(key.ExpiresAt) {
+			c.auditLoginFailure("apikey", key.ID, ErrAPIKeyExpired)
+			_ = c.AbortWithError(http.StatusUnauthorized, &Error{Err: ErrAPIKeyExpired, Type: ErrorTypePublic})
+			return
+		}
+		c.SetPrincipal(&Principal{
+			Subject:   key.ID,
+			Scopes:    key.Scopes,
+			Method:    "apikey",
+			ExpiresAt: key.ExpiresAt,
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package gateway
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIKeyAuth(t *testing.T) {
+	newGateway := func(conf APIKeyAuthConfig) *Gateway {
+		conf.Keys = []APIKey{
+			{ID: "ci", Hash: HashAPIKey("ci-key"), Scopes: []string{"deploy", "read"}},
+			{ID: "old", Hash: HashAPIKey("old-key"), ExpiresAt: time.Now().Add(-time.Minute)},
+		}
+		r := New()
+		r.Use(APIKeyAuth(conf))
+		r.GET("/me", func(c *Context) {
+			p, _ := c.Principal()
+			c.String(http.StatusOK, "%s %s %s", p.Subject, p.Method, strings.Join(p.Scopes, ","))
+		})
+		return r
+	}
+
+	r := newGateway(APIKeyAuthConfig{})
+	w := performRequestWithHeader(r, http.MethodGet, "/me", http.Header{"X-Api-Key": {"ci-key"}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ci apikey deploy,read", w.Body.String())
+
+	for name, header := range map[string]http.Header{
+		"unknown key": {"X-Api-Key": {"other-key"}},
+		"expired key": {"X-Api-Key": {"old-key"}},
+		"no key":      nil,
+	} {
+		w := performRequestWithHeader(r, http.MethodGet, "/me", header)
+		assert.Equal(t, http.StatusUnauthorized, w.Code, name)
+	}
+
+	// the query parameter is disabled by default
+	w = performRequest(r, http.MethodGet, "/me?api_key=ci-key")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	r = newGateway(APIKeyAuthConfig{Header: "Authorization-Key", QueryParam: "api_key"})
+	w = performRequestWithHeader(r, http.MethodGet, "/me", http.Header{"Authorization-Key": {"ci-key"}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = performRequest(r, http.MethodGet, "/me?api_key=ci-key")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ci apikey deploy,read", w.Body.String())
+	w = performRequest(r, http.MethodGet, "/me?api_key=old-key")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	// the header takes precedence over the query parameter
+	w = performRequestWithHeader(r, http.MethodGet, "/me?api_key=ci-key", http.Header{"Authorization-Key": {"other-key"}})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
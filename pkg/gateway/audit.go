@@ -0,0 +1,41 @@
+package gateway
+
+import "github.com/idproxy/gateway/pkg/audit"
+
+// Audit records a security relevant event in the audit trail of the gateway, see
+// Gateway.AuditLog. Missing request ID, client IP and actor are filled in from the
+// request, the actor and method from the principal if there is one. It does nothing if
+// the gateway has no audit log. Failures to record are added to c.Errors, they never
+// fail the request.
+func (c *Context) Audit(e audit.Event) {
+	if c.gateway == nil || c.gateway.AuditLog == nil {
+		return
+	}
+	if e.RequestID == "" {
+		e.RequestID = c.RequestID()
+	}
+	if e.ClientIP == "" {
+		e.ClientIP = c.ClientIP()
+	}
+	if p, ok := c.Principal(); ok {
+		if e.Actor == "" {
+			e.Actor = p.Subject
+		}
+		if e.Method == "" {
+			e.Method = p.Method
+		}
+	}
+	if e.Resource == "" && c.Request != nil {
+		e.Resource = c.Request.Method + " " + c.Request.URL.Path
+	}
+	if _, err := c.gateway.AuditLog.Record(e); err != nil {
+		debugPrint("[WARNING] audit: %v", err)
+		_ = c.Error(err)
+	}
+}
+
+// auditLoginFailure records a rejected authentication. actor is the identity claimed by
+// the request, if any.
+func (c *Context) auditLoginFailure(method, actor string, err error) {
+	c.Audit(audit.Event{Type: audit.LoginFailure, Method: method, Actor: actor, Reason: err.Error()})
+}
@@ -0,0 +1,44 @@
+package gateway
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/idproxy/gateway/pkg/audit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAuditAuthEvents(t *testing.T) {
+	sink := &audit.MemorySink{}
+	log, err := audit.New(sink)
+	require.NoError(t, err)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	r := New()
+	r.AuditLog = log
+	r.Use(RequestID(RequestIDConfig{}))
+	admin := r.Group("/admin", BasicAuth(Accounts{"alice": string(hash)})).Authorize(RequireRoles("admin"))
+	admin.GET("/", func(c *Context) {})
+
+	w := performRequest(r, http.MethodGet, "/admin/")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req, _ := http.NewRequest(http.MethodGet, "/admin/", nil)
+	req.SetBasicAuth("alice", "secret")
+	w = performRequestWithHeader(r, http.MethodGet, "/admin/", req.Header)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	entries := sink.Entries()
+	require.Len(t, entries, 2)
+	assert.Equal(t, audit.LoginFailure, entries[0].Event.Type)
+	assert.Equal(t, "basic", entries[0].Event.Method)
+	assert.Equal(t, audit.AccessDenied, entries[1].Event.Type)
+	assert.Equal(t, "alice", entries[1].Event.Actor)
+	assert.Equal(t, "GET /admin/", entries[1].Event.Resource)
+	assert.Equal(t, w.Header().Get("X-Request-ID"), entries[1].Event.RequestID)
+	assert.Equal(t, entries[0].Hash, entries[1].PrevHash)
+}
@@ -0,0 +1,376 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/idproxy/gateway/internal/json"
+	"github.com/idproxy/gateway/pkg/audit"
+)
+
+var (
+	// ErrUnauthenticated is recorded when a route with policies is requested without principal.
+	ErrUnauthenticated = errors.New("authorization: request is not authenticated")
+	// ErrForbidden is wrapped by every deny reason recorded by Authorize.
+	ErrForbidden = errors.New("authorization: access denied")
+)
+
+// Policy decides whether the principal of a request may access a route.
+type Policy interface {
+	// Evaluate returns nil when access is granted and the deny reason otherwise.
+	Evaluate(c *Context, p *Principal) error
+	// String describes the policy for auditing.
+	String() string
+}
+
+// RoutePolicy lists the policies guarding a route.
+type RoutePolicy struct {
+	Method   string
+	Path     string
+	Policies []Policy
+}
+
+// Authorize returns a middleware evaluating every policy against the principal stored
+// by the authentication middlewares. Each deny reason is recorded in c.Errors as a
+// public *Error with the policy description as Meta, and the request is aborted with
+// 403, or 401 if there is no principal at all.
+// Prefer RouterGroup.Authorize, which also records the policies per route.
+func Authorize(policies ...Policy) HandlerFunc {
+	return func(c *Context) {
+		p, ok := c.Principal()
+		if !ok || p.Expired(time.Now()) {
+			_ = c.AbortWithError(http.StatusUnauthorized, &Error{Err: ErrUnauthenticated, Type: ErrorTypePublic})
+			return
+		}
+		var reasons []string
+		for _, policy := range policies {
+			if err := policy.Evaluate(c, p); err != nil {
+				reasons = append(reasons, err.Error())
+				_ = c.Error(&Error{Err: err, Type: ErrorTypePublic, Meta: policy.String()})
+			}
+		}
+		if len(reasons) > 0 {
+			c.Audit(audit.Event{Type: audit.AccessDenied, Reason: strings.Join(reasons, "; ")})
+			c.AbortWithStatus(http.StatusForbidden)
+		}
+	}
+}
+
+// Authorize returns a new router group with the same base path whose routes are guarded
+// by the policies, in addition to the policies of this group. The policies of every
+// route are listed by Gateway.RoutePolicies.
+func (r *RouterGroup) Authorize(policies ...Policy) *RouterGroup {
+	group := r.Group("", Authorize(policies...))
+	group.policies = append(group.policies, policies...)
+	return group
+}
+
+// Policies returns the policies guarding the routes of the group.
+func (r *RouterGroup) Policies() []Policy {
+	return r.policies
+}
+
+// RoutePolicies returns the policies of every route registered through a group with
+// policies, ordered by path and method. Routes that are not listed have no policies.
+func (r *Gateway) RoutePolicies() []RoutePolicy {
+	out := make([]RoutePolicy, len(r.routePolicies))
+	copy(out, r.routePolicies)
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Path != out[j].Path {
+			return out[i].Path < out[j].Path
+		}
+		return out[i].Method < out[j].Method
+	})
+	return out
+}
+
+func denied(format string, a ...any) error {
+	return fmt.Errorf("%w: "+format, append([]any{ErrForbidden}, a...)...)
+}
+
+type policyFunc struct {
+	desc string
+	fn   func(c *Context, p *Principal) error
+}
+
+func (f policyFunc) Evaluate(c *Context, p *Principal) error { return f.fn(c, p) }
+func (f policyFunc) String() string                          { return f.desc }
+
+// NewPolicy returns a policy from a description and an evaluation function.
+func NewPolicy(desc string, fn func(c *Context, p *Principal) error) Policy {
+	return policyFunc{desc: desc, fn: fn}
+}
+
+// RequireScopes requires every one of the scopes.
+func RequireScopes(scopes ...string) Policy {
+	return NewPolicy("scopes(all: "+strings.Join(scopes, " ")+")", func(_ *Context, p *Principal) error {
+		for _, s := range scopes {
+			if !p.HasScope(s) {
+				return denied("missing scope %q", s)
+			}
+		}
+		return nil
+	})
+}
+
+// RequireRoles requires at least one of the roles.
+func RequireRoles(roles ...string) Policy {
+	return NewPolicy("roles(any: "+strings.Join(roles, " ")+")", func(_ *Context, p *Principal) error {
+		for _, r := range roles {
+			if p.HasRole(r) {
+				return nil
+			}
+		}
+		return denied("none of the roles %v", roles)
+	})
+}
+
+// RequireGroups requires membership in at least one of the groups.
+func RequireGroups(groups ...string) Policy {
+	return NewPolicy("groups(any: "+strings.Join(groups, " ")+")", func(_ *Context, p *Principal) error {
+		for _, g := range groups {
+			if p.HasGroup(g) {
+				return nil
+			}
+		}
+		return denied("not a member of any of the groups %v", groups)
+	})
+}
+
+// AllowCIDRs requires the client IP to be in one of the networks. It panics if a
+// network can not be parsed.
+func AllowCIDRs(cidrs ...string) Policy {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return NewPolicy("cidr("+strings.Join(cidrs, " ")+")", func(c *Context, _ *Principal) error {
+		ip := net.ParseIP(c.ClientIP())
+		for _, n := range nets {
+			if ip != nil && n.Contains(ip) {
+				return nil
+			}
+		}
+		return denied("client ip %q not allowed", c.ClientIP())
+	})
+}
+
+// TimeWindow allows access between start and end, given as "15:04" in loc, on the
+// given days or on every day if none are given. A window whose end is before its
+// start wraps around midnight.
+func TimeWindow(loc *time.Location, start, end string, days ...time.Weekday) Policy {
+	from, err := time.Parse("15:04", start)
+	if err != nil {
+		panic(err)
+	}
+	to, err := time.Parse("15:04", end)
+	if err != nil {
+		panic(err)
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	fromMin, toMin := from.Hour()*60+from.Minute(), to.Hour()*60+to.Minute()
+	desc := fmt.Sprintf("time(%s-%s %s", start, end, loc)
+	for _, d := range days {
+		desc += " " + d.String()[:3]
+	}
+	desc += ")"
+
+	return NewPolicy(desc, func(_ *Context, _ *Principal) error {
+		now := time.Now().In(loc)
+		if len(days) > 0 {
+			day := now.Weekday()
+			if fromMin > toMin && now.Hour()*60+now.Minute() < toMin {
+				// the window started the day before
+				day = (day + 6) % 7
+			}
+			found := false
+			for _, d := range days {
+				found = found || d == day
+			}
+			if !found {
+				return denied("outside of allowed days")
+			}
+		}
+		m := now.Hour()*60 + now.Minute()
+		if fromMin <= toMin && (m < fromMin || m >= toMin) ||
+			fromMin > toMin && m < fromMin && m >= toMin {
+			return denied("outside of allowed hours %s-%s", start, end)
+		}
+		return nil
+	})
+}
+
+// AnyOf grants access when at least one of the policies grants access.
+func AnyOf(policies ...Policy) Policy {
+	descs := make([]string, len(policies))
+	for i, p := range policies {
+		descs[i] = p.String()
+	}
+	return NewPolicy("any("+strings.Join(descs, ", ")+")", func(c *Context, p *Principal) error {
+		var reasons []string
+		for _, policy := range policies {
+			err := policy.Evaluate(c, p)
+			if err == nil {
+				return nil
+			}
+			reasons = append(reasons, strings.TrimPrefix(err.Error(), ErrForbidden.Error()+": "))
+		}
+		return denied("%s", strings.Join(reasons, "; "))
+	})
+}
+
+// claimOperators are the binary operators of claim expressions.
+var claimOperators = []string{"contains", "==", "!=", "in"}
+
+// RequireClaim returns a policy evaluating a claim expression against the claims of the
+// principal. It panics if the expression can not be parsed, see ParseClaimExpression.
+func RequireClaim(expr string) Policy {
+	p, err := ParseClaimExpression(expr)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// ParseClaimExpression parses a claim expression of the form `claim`, which requires
+// the claim to be present and not false, empty or null, or `claim op value` where op is
+// one of ==, !=, in or contains and value is a JSON literal, e.g.
+//
+//	email_verified == true
+//	tenant in ["acme", "initech"]
+//	address.country != "XX"
+//	groups contains "admins"
+//
+// Claims are looked up in Principal.Claims with dots descending into objects; the
+// standard names sub, iss, name, email, groups, roles, scope and amr fall back to the
+// Principal fields. Every operator requires the claim to be present, so
+// `tenant != "acme"` denies principals without a tenant claim.
+func ParseClaimExpression(expr string) (Policy, error) {
+	expr = strings.TrimSpace(expr)
+	claim, op, literal := expr, "", ""
+	at := len(expr)
+	for _, o := range claimOperators {
+		if i := strings.Index(expr, " "+o+" "); i > 0 && i < at {
+			at = i
+			claim, op, literal = strings.TrimSpace(expr[:i]), o, strings.TrimSpace(expr[i+len(o)+2:])
+		}
+	}
+	if claim == "" || strings.ContainsAny(claim, " \t\"") {
+		return nil, fmt.Errorf("authorization: invalid claim expression %q", expr)
+	}
+
+	var value any
+	if op != "" {
+		if err := json.Unmarshal([]byte(literal), &value); err != nil {
+			return nil, fmt.Errorf("authorization: invalid value in claim expression %q: %w", expr, err)
+		}
+		if _, ok := value.([]any); op == "in" && !ok {
+			return nil, fmt.Errorf("authorization: %q requires an array value", expr)
+		}
+	}
+
+	return NewPolicy("claim("+expr+")", func(_ *Context, p *Principal) error {
+		v, ok := lookupClaim(p, claim)
+		if ok {
+			v = normalizeClaim(v)
+		}
+		var granted bool
+		switch op {
+		case "":
+			granted = ok && v != nil && v != false && v != "" && !reflect.DeepEqual(v, []any{})
+		case "==":
+			granted = ok && reflect.DeepEqual(v, value)
+		case "!=":
+			granted = ok && !reflect.DeepEqual(v, value)
+		case "in":
+			for _, e := range value.([]any) {
+				granted = granted || ok && reflect.DeepEqual(v, e)
+			}
+		case "contains":
+			switch t := v.(type) {
+			case []any:
+				for _, e := range t {
+					granted = granted || reflect.DeepEqual(e, value)
+				}
+			case string:
+				s, isString := value.(string)
+				granted = isString && strings.Contains(t, s)
+			}
+		}
+		if !granted {
+			return denied("claim expression %q not satisfied", expr)
+		}
+		return nil
+	}), nil
+}
+
+func lookupClaim(p *Principal, path string) (any, bool) {
+	var cur any = p.Claims
+	for _, part := range strings.Split(path, ".") {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			cur = nil
+			break
+		}
+		if cur, ok = m[part]; !ok {
+			cur = nil
+			break
+		}
+	}
+	if cur != nil {
+		return cur, true
+	}
+
+	var v any
+	switch path {
+	case "sub":
+		v = p.Subject
+	case "iss":
+		v = p.Issuer
+	case "name":
+		v = p.Name
+	case "email":
+		v = p.Email
+	case "groups":
+		v = p.Groups
+	case "roles":
+		v = p.Roles
+	case "scope":
+		v = strings.Join(p.Scopes, " ")
+	case "amr":
+		v = p.Method
+	default:
+		return nil, false
+	}
+	return v, !reflect.ValueOf(v).IsZero()
+}
+
+// normalizeClaim converts a claim to the types produced by decoding JSON so it can be
+// compared with the literal of an expression.
+func normalizeClaim(v any) any {
+	switch v.(type) {
+	case string, bool, float64, nil:
+		return v
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var out any
+	if err := json.Unmarshal(b, &out); err != nil {
+		return v
+	}
+	return out
+}
@@ -0,0 +1,96 @@
+package gateway
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClaimExpressions(t *testing.T) {
+	p := &Principal{
+		Subject: "alice",
+		Groups:  []string{"admins"},
+		Claims: map[string]any{
+			"email_verified": true,
+			"tenant":         "acme",
+			"level":          3,
+			"address":        map[string]any{"country": "BE"},
+		},
+	}
+	tests := []struct {
+		expr    string
+		granted bool
+	}{
+		{`email_verified`, true},
+		{`email_verified == true`, true},
+		{`missing`, false},
+		{`tenant in ["acme", "initech"]`, true},
+		{`tenant in ["a == b"]`, false},
+		{`address.country != "XX"`, true},
+		{`address.country != "BE"`, false},
+		{`missing != "XX"`, false},
+		{`address.missing != "XX"`, false},
+		{`name != "mallory"`, false},
+		{`address.country == "XX"`, false},
+		{`level == 3`, true},
+		{`groups contains "admins"`, true},
+		{`sub == "bob"`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			policy, err := ParseClaimExpression(tt.expr)
+			require.NoError(t, err)
+			err = policy.Evaluate(nil, p)
+			assert.Equal(t, tt.granted, err == nil, "%v", err)
+			if err != nil {
+				assert.True(t, errors.Is(err, ErrForbidden))
+			}
+		})
+	}
+
+	for _, expr := range []string{`tenant in "acme"`, `bad claim == 1`, `tenant == acme`} {
+		_, err := ParseClaimExpression(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestAuthorizeRouterGroup(t *testing.T) {
+	var errs errorMsgs
+	r := New()
+	r.Use(func(c *Context) {
+		if user := c.GetHeader("X-User"); user != "" {
+			c.SetPrincipal(&Principal{Subject: user, Roles: []string{user}})
+		}
+		c.Next()
+		errs = c.Errors
+	})
+	admin := r.Group("/admin").Authorize(RequireRoles("admin"))
+	admin.GET("/users", func(c *Context) { c.String(http.StatusOK, "ok") })
+	admin.Authorize(AllowCIDRs("10.0.0.0/8")).DELETE("/users", func(c *Context) {})
+	r.GET("/public", func(c *Context) {})
+
+	req := func(user string) int {
+		rq := httptest.NewRequest(http.MethodGet, "/admin/users", nil)
+		rq.Header.Set("X-User", user)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, rq)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusUnauthorized, req(""))
+	assert.Equal(t, http.StatusForbidden, req("guest"))
+	require.Len(t, errs, 1)
+	assert.Equal(t, "roles(any: admin)", errs[0].Meta)
+	assert.True(t, errs[0].IsType(ErrorTypePublic))
+	assert.Equal(t, http.StatusOK, req("admin"))
+
+	policies := r.RoutePolicies()
+	require.Len(t, policies, 2)
+	assert.Equal(t, "DELETE", policies[0].Method)
+	assert.Len(t, policies[0].Policies, 2)
+	assert.Equal(t, "GET", policies[1].Method)
+	assert.Equal(t, "/admin/users", policies[1].Path)
+}
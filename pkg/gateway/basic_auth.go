@@ -0,0 +1,126 @@
+package gateway
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrInvalidCredentials is recorded when a request carries unknown or wrong credentials.
+var ErrInvalidCredentials = errors.New("authentication: invalid credentials")
+
+// dummyBcryptHash is verified for unknown users so that the response time does not
+// reveal whether a user exists.
+var dummyBcryptHash = []byte("$2a$10$7EqJtq98hPqEX7fNZaFWoOhi5BWX4Z5Q1DSLyqwhpLp9JzqE1Dz3y")
+
+// Accounts maps user names to password hashes as found in an htpasswd file. bcrypt
+// ($2a$, $2b$, $2y$) and argon2id ($argon2id$) hashes are supported.
+type Accounts map[string]string
+
+// ParseHtpasswd reads accounts in htpasswd format, one "user:hash" per line. Blank lines
+// and lines starting with # are ignored.
+func ParseHtpasswd(r io.Reader) (Accounts, error) {
+	accounts := Accounts{}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		user, hash, ok := strings.Cut(line, ":")
+		if !ok || user == "" {
+			return nil, fmt.Errorf("htpasswd: line %d: missing user name", n)
+		}
+		if !strings.HasPrefix(hash, "$2") && !strings.HasPrefix(hash, "$argon2id$") {
+			return nil, fmt.Errorf("htpasswd: line %d: unsupported hash for user %q, use bcrypt or argon2id", n, user)
+		}
+		accounts[user] = hash
+	}
+	return accounts, scanner.Err()
+}
+
+// LoadHtpasswd reads accounts from an htpasswd file.
+func LoadHtpasswd(path string) (Accounts, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseHtpasswd(f)
+}
+
+// BasicAuth returns a Basic HTTP Authorization middleware. It takes as argument the
+// accounts and stores the principal of authenticated users in c.Keys. Requests with
+// missing or wrong credentials are aborted with 401 and a Basic challenge.
+func BasicAuth(accounts Accounts) HandlerFunc {
+	return BasicAuthForRealm(accounts, "")
+}
+
+// BasicAuthForRealm returns a Basic HTTP Authorization middleware for the given realm.
+// If the realm is empty, "Authorization Required" will be used by default.
+// (see http://tools.ietf.org/html/rfc2617#section-1.2)
+func BasicAuthForRealm(accounts Accounts, realm string) HandlerFunc {
+	if realm == "" {
+		realm = "Authorization Required"
+	}
+	realm = "Basic realm=" + strconv.Quote(realm)
+
+	return func(c *Context) {
+		user, password, ok := c.Request.BasicAuth()
+		if !ok || !accounts.verify(user, password) {
+			c.auditLoginFailure("basic", user, ErrInvalidCredentials)
+			c.Header("WWW-Authenticate", realm)
+			_ = c.AbortWithError(http.StatusUnauthorized, &Error{Err: ErrInvalidCredentials, Type: ErrorTypePublic})
+			return
+		}
+		c.SetPrincipal(&Principal{Subject: user, Name: user, Method: "basic"})
+	}
+}
+
+// verify checks the password of user in constant time with respect to the password and
+// to whether the user exists.
+func (a Accounts) verify(user, password string) bool {
+	hash, ok := a[user]
+	if !ok {
+		_ = bcrypt.CompareHashAndPassword(dummyBcryptHash, []byte(password))
+		return false
+	}
+	if strings.HasPrefix(hash, "$argon2id$") {
+		return verifyArgon2id(hash, password)
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// verifyArgon2id verifies a password against a hash in the PHC string format
+// $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>.
+func verifyArgon2id(encoded, password string) bool {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" || parts[2] != "v=19" {
+		return false
+	}
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(want) == 0 {
+		return false
+	}
+	got := argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(want)))
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
@@ -0,0 +1,80 @@
+package gateway
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func testArgon2idHash(password string) string {
+	salt := []byte("0123456789abcdef")
+	key := argon2.IDKey([]byte(password), salt, 1, 64*1024, 2, 32)
+	return fmt.Sprintf("$argon2id$v=19$m=%d,t=%d,p=%d$%s$%s", 64*1024, 1, 2,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+func TestParseHtpasswd(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("alice-secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+	argon2idHash := testArgon2idHash("bob-secret")
+
+	accounts, err := ParseHtpasswd(strings.NewReader(
+		"# users\n\nalice:" + string(bcryptHash) + "\n  bob:" + argon2idHash + "  \n"))
+	require.NoError(t, err)
+	assert.Equal(t, Accounts{"alice": string(bcryptHash), "bob": argon2idHash}, accounts)
+
+	assert.True(t, accounts.verify("alice", "alice-secret"))
+	assert.False(t, accounts.verify("alice", "bob-secret"))
+	assert.True(t, accounts.verify("bob", "bob-secret"))
+	assert.False(t, accounts.verify("bob", "alice-secret"))
+	assert.False(t, accounts.verify("carol", "alice-secret"))
+
+	_, err = ParseHtpasswd(strings.NewReader("alice:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\n"))
+	assert.ErrorContains(t, err, "line 1: unsupported hash")
+	_, err = ParseHtpasswd(strings.NewReader("# users\n:" + string(bcryptHash) + "\n"))
+	assert.ErrorContains(t, err, "line 2: missing user name")
+}
+
+func TestBasicAuth(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+	r := New()
+	r.Use(BasicAuthForRealm(Accounts{"alice": string(hash)}, "gateway"))
+	r.GET("/me", func(c *Context) {
+		p, _ := c.Principal()
+		c.String(http.StatusOK, "%s %s", p.Subject, p.Method)
+	})
+
+	basic := func(user, password string) http.Header {
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		req.SetBasicAuth(user, password)
+		return req.Header
+	}
+
+	w := performRequestWithHeader(r, http.MethodGet, "/me", basic("alice", "secret"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "alice basic", w.Body.String())
+
+	for name, header := range map[string]http.Header{
+		"wrong password": basic("alice", "wrong"),
+		"unknown user":   basic("bob", "secret"),
+		"no credentials": nil,
+	} {
+		w := performRequestWithHeader(r, http.MethodGet, "/me", header)
+		assert.Equal(t, http.StatusUnauthorized, w.Code, name)
+		assert.Equal(t, `Basic realm="gateway"`, w.Header().Get("WWW-Authenticate"), name)
+	}
+
+	r = New()
+	r.Use(BasicAuth(Accounts{"alice": string(hash)}))
+	r.GET("/me", func(c *Context) {})
+	w = performRequest(r, http.MethodGet, "/me")
+	assert.Equal(t, `Basic realm="Authorization Required"`, w.Header().Get("WWW-Authenticate"))
+}
@@ -0,0 +1,533 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// responseBuffer holds back the body of a response so that a middleware can inspect it
+// once the chain returned. Bodies over limit, flushed or hijacked responses are streamed
+// to the client instead.
+type responseBuffer struct {
+	ResponseWriter
+
+	buf       bytes.Buffer
+	limit     int
+	size      int
+	streaming bool
+}
+
+var _ ResponseWriter = (*responseBuffer)(nil)
+
+func newResponseBuffer(w ResponseWriter, limit int) *responseBuffer {
+	return &responseBuffer{ResponseWriter: w, limit: limit, size: noWritten}
+}
+
+func (w *responseBuffer) Write(data []byte) (int, error) {
+	if w.size < 0 {
+		w.size = 0
+	}
+	w.size += len(data)
+	if w.streaming {
+		return w.ResponseWriter.Write(data)
+	}
+	w.buf.Write(data)
+	if w.limit > 0 && w.buf.Len() > w.limit {
+		if err := w.stream(); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+func (w *responseBuffer) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *responseBuffer) Size() int {
+	return w.size
+}
+
+func (w *responseBuffer) Written() bool {
+	return w.size != noWritten
+}
+
+func (w *responseBuffer) WriteHeaderNow() {
+	if w.streaming {
+		w.ResponseWriter.WriteHeaderNow()
+	} else if w.size < 0 {
+		w.size = 0
+	}
+}
+
+func (w *responseBuffer) Flush() {
+	_ = w.stream()
+	w.ResponseWriter.Flush()
+}
+
+func (w *responseBuffer) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.streaming = true
+	return w.ResponseWriter.Hijack()
+}
+
+// stream sends what is buffered and passes further writes through.
+func (w *responseBuffer) stream() error {
+	if w.streaming {
+		return nil
+	}
+	w.streaming = true
+	if w.buf.Len() > 0 {
+		_, err := w.ResponseWriter.Write(w.buf.Bytes())
+		w.buf.Reset()
+		return err
+	}
+	if w.size >= 0 {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+	return nil
+}
+
+// notModified drops the buffered body and sends a 304.
+func (w *responseBuffer) notModified() {
+	w.buf.Reset()
+	w.streaming = true
+	h := w.Header()
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+	w.ResponseWriter.WriteHeader(http.StatusNotModified)
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+// hopByHopHeaders describe a connection rather than a response, they are never stored
+// for replay.
+var hopByHopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Connection",
+	"Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// writtenHeader returns the headers of after that differ from before, i.e. those the
+// handlers wrote after a middleware took the before snapshot, without hop-by-hop
+// headers. Headers set earlier in the chain, such as X-Request-ID, traceparent or
+// RateLimit-*, describe the request rather than the response and must not be replayed.
+func writtenHeader(before, after http.Header) http.Header {
+	written := make(http.Header, len(after))
+	for k, v := range after {
+		if old, ok := before[k]; ok && strings.Join(old, "\x00") == strings.Join(v, "\x00") {
+			continue
+		}
+		written[k] = append([]string(nil), v...)
+	}
+	for _, k := range hopByHopHeaders {
+		written.Del(k)
+	}
+	return written
+}
+
+// replayHeader copies stored headers to h, keeping the headers already set for the
+// current request.
+func replayHeader(h, stored http.Header) {
+	for k, v := range stored {
+		if _, ok := h[k]; !ok {
+			h[k] = append([]string(nil), v...)
+		}
+	}
+}
+
+// ETagConfig defines the config for ETag middleware.
+type ETagConfig struct {
+	// Weak generates weak validators, W/"...", for bodies that are semantically but not
+	// byte-for-byte equivalent, e.g. when a proxy may re-encode them.
+	// Optional. Default value is false, which generates strong validators.
+	Weak bool
+}
+
+// ETag returns a middleware adding an ETag computed from the body to successful GET and
+// HEAD responses that do not set one, and answering conditional requests with 304 Not
+// Modified when If-None-Match, or If-Modified-Since against Last-Modified, matches.
+func ETag(conf ETagConfig) HandlerFunc {
+	return func(c *Context) {
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			return
+		}
+		rb := newResponseBuffer(c.Writer, 0)
+		c.Writer = rb
+		defer func() {
+			c.Writer = rb.ResponseWriter
+		}()
+		c.Next()
+
+		if !rb.streaming && rb.Status() == http.StatusOK {
+			h := rb.Header()
+			if h.Get("ETag") == "" && rb.buf.Len() > 0 {
+				h.Set("ETag", makeETag(rb.buf.Bytes(), conf.Weak))
+			}
+			if notModified(c.Request, h) {
+				rb.notModified()
+				return
+			}
+		}
+		if err := rb.stream(); err != nil {
+			_ = c.Error(err)
+		}
+	}
+}
+
+func makeETag(body []byte, weak bool) string {
+	sum := sha256.Sum256(body)
+	etag := `"` + base64.RawURLEncoding.EncodeToString(sum[:18]) + `"`
+	if weak {
+		return "W/" + etag
+	}
+	return etag
+}
+
+// notModified evaluates the conditional headers of a GET or HEAD request against the
+// validators of a response. If-Modified-Since is ignored when If-None-Match is present.
+func notModified(req *http.Request, h http.Header) bool {
+	if inm := req.Header.Get("If-None-Match"); inm != "" {
+		etag := h.Get("ETag")
+		if etag == "" {
+			return false
+		}
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimSpace(candidate)
+			// If-None-Match uses the weak comparison
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+	ims, lastModified := req.Header.Get("If-Modified-Since"), h.Get("Last-Modified")
+	if ims == "" || lastModified == "" {
+		return false
+	}
+	since, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(lastModified)
+	if err != nil {
+		return false
+	}
+	return !modified.After(since)
+}
+
+// parseCacheControl returns the directives of a Cache-Control header with lower case names.
+func parseCacheControl(header string) map[string]string {
+	directives := make(map[string]string)
+	for _, part := range strings.Split(header, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		if name == "" {
+			continue
+		}
+		directives[strings.ToLower(name)] = strings.Trim(value, `"`)
+	}
+	return directives
+}
+
+// CacheConfig defines the config for ResponseCache.
+type CacheConfig struct {
+	// DefaultTTL is how long responses without explicit freshness, i.e. without
+	// Cache-Control max-age or s-maxage and without Expires, are cached.
+	// Optional. Default value is 0, such responses are not cached.
+	DefaultTTL time.Duration
+
+	// MaxEntries bounds the number of cached responses, the least recently used are
+	// evicted first.
+	// Optional. Default value is 1000.
+	MaxEntries int
+
+	// MaxBodyBytes is the largest body cached, larger responses are streamed.
+	// Optional. Default value is 1 MiB.
+	MaxBodyBytes int
+
+	// CredentialHeaders are the request headers carrying credentials. Responses to
+	// requests with one of them, or with an authenticated principal, are only stored and
+	// served when marked public or s-maxage, since authentication middlewares usually run
+	// after the cache.
+	// Optional. Default value is Authorization, Cookie and X-API-Key.
+	CredentialHeaders []string
+
+	// CredentialQueryParams are the query parameters carrying credentials, e.g.
+	// APIKeyAuthConfig.QueryParam, handled like CredentialHeaders.
+	// Optional.
+	CredentialQueryParams []string
+}
+
+type cacheEntry struct {
+	primary    string
+	varyValues []string
+	vary       []string
+	status     int
+	header     http.Header
+	body       []byte
+	stored     time.Time
+	expires    time.Time
+	shared     bool
+	elem       *list.Element
+}
+
+func (e *cacheEntry) matches(req *http.Request) bool {
+	for i, name := range e.vary {
+		if strings.Join(req.Header.Values(name), ",") != e.varyValues[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// ResponseCache is a shared in-memory cache of GET and HEAD responses, keyed by method,
+// host, path and query plus the request headers named in Vary. It follows the
+// Cache-Control directives of requests and responses the way a shared cache does:
+// responses marked private or no-store or setting cookies are not stored, and responses
+// to requests carrying credentials are neither stored nor served unless public or
+// s-maxage.
+type ResponseCache struct {
+	config CacheConfig
+
+	mu       sync.Mutex
+	variants map[string][]*cacheEntry
+	lru      *list.List
+}
+
+// NewResponseCache returns an empty cache for the given config.
+func NewResponseCache(conf CacheConfig) *ResponseCache {
+	if conf.MaxEntries <= 0 {
+		conf.MaxEntries = 1000
+	}
+	if conf.MaxBodyBytes <= 0 {
+		conf.MaxBodyBytes = 1 << 20
+	}
+	if conf.CredentialHeaders == nil {
+		conf.CredentialHeaders = credentialHeaders
+	}
+	return &ResponseCache{config: conf, variants: make(map[string][]*cacheEntry), lru: list.New()}
+}
+
+// Cache returns a middleware backed by a new ResponseCache.
+func Cache(conf CacheConfig) HandlerFunc {
+	return NewResponseCache(conf).Handler()
+}
+
+// Handler returns the middleware serving and storing responses. Hits carry an Age header
+// and are answered with 304 when the request validators match.
+func (rc *ResponseCache) Handler() HandlerFunc {
+	return func(c *Context) {
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			return
+		}
+		directives := parseCacheControl(c.GetHeader("Cache-Control"))
+		if _, ok := directives["no-store"]; ok {
+			return
+		}
+		primary := c.Request.Method + " " + c.Request.Host + c.Request.URL.RequestURI()
+		now := time.Now()
+		_, revalidate := directives["no-cache"]
+		if !revalidate && directives["max-age"] != "0" {
+			if e := rc.lookup(primary, c.Request, now, rc.credentialed(c)); e != nil {
+				rc.serve(c, e, now)
+				return
+			}
+		}
+
+		before := c.Writer.Header().Clone()
+		rb := newResponseBuffer(c.Writer, rc.config.MaxBodyBytes)
+		c.Writer = rb
+		defer func() {
+			c.Writer = rb.ResponseWriter
+		}()
+		c.Next()
+
+		if !rb.streaming {
+			if e := rc.entry(c, rb, primary, before, now); e != nil {
+				rc.store(e)
+			}
+		}
+		if err := rb.stream(); err != nil {
+			_ = c.Error(err)
+		}
+	}
+}
+
+// Purge drops all cached responses.
+func (rc *ResponseCache) Purge() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.variants = make(map[string][]*cacheEntry)
+	rc.lru.Init()
+}
+
+// Len returns the number of cached responses.
+func (rc *ResponseCache) Len() int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.lru.Len()
+}
+
+func (rc *ResponseCache) serve(c *Context, e *cacheEntry, now time.Time) {
+	h := c.Writer.Header()
+	replayHeader(h, e.header)
+	h.Set("Age", strconv.Itoa(int(now.Sub(e.stored).Seconds())))
+	c.Abort()
+	if e.status == http.StatusOK && notModified(c.Request, h) {
+		h.Del("Content-Type")
+		h.Del("Content-Length")
+		c.Status(http.StatusNotModified)
+		c.Writer.WriteHeaderNow()
+		return
+	}
+	c.Status(e.status)
+	if _, err := c.Writer.Write(e.body); err != nil {
+		_ = c.Error(err)
+	}
+}
+
+// entry returns the cache entry of a response, nil if it must not be stored. before are
+// the response headers set before the handlers ran, which are not stored.
+func (rc *ResponseCache) entry(c *Context, rb *responseBuffer, primary string, before http.Header, now time.Time) *cacheEntry {
+	switch rb.Status() {
+	case http.StatusOK, http.StatusNonAuthoritativeInfo, http.StatusMovedPermanently,
+		http.StatusNotFound, http.StatusGone:
+	default:
+		return nil
+	}
+	h := rb.Header()
+	if h.Get("Set-Cookie") != "" {
+		return nil
+	}
+	directives := parseCacheControl(strings.Join(h.Values("Cache-Control"), ","))
+	for _, d := range []string{"no-store", "private", "no-cache"} {
+		if _, ok := directives[d]; ok {
+			return nil
+		}
+	}
+	_, public := directives["public"]
+	_, shared := directives["s-maxage"]
+	if !public && !shared && rc.credentialed(c) {
+		return nil
+	}
+
+	ttl := rc.config.DefaultTTL
+	if v, ok := directives["s-maxage"]; ok {
+		ttl = parseSeconds(v)
+	} else if v, ok := directives["max-age"]; ok {
+		ttl = parseSeconds(v)
+	} else if v := h.Get("Expires"); v != "" {
+		ttl = 0
+		if t, err := http.ParseTime(v); err == nil {
+			ttl = t.Sub(now)
+		}
+	}
+	if ttl <= 0 {
+		return nil
+	}
+
+	e := &cacheEntry{
+		primary: primary,
+		status:  rb.Status(),
+		header:  writtenHeader(before, h),
+		body:    append([]byte(nil), rb.buf.Bytes()...),
+		stored:  now,
+		expires: now.Add(ttl),
+		shared:  public || shared,
+	}
+	for _, v := range h.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name == "*" {
+				return nil
+			} else if name != "" {
+				e.vary = append(e.vary, name)
+				e.varyValues = append(e.varyValues, strings.Join(c.Request.Header.Values(name), ","))
+			}
+		}
+	}
+	return e
+}
+
+// credentialed returns true if the request carries credentials or was authenticated.
+func (rc *ResponseCache) credentialed(c *Context) bool {
+	if _, ok := c.Principal(); ok {
+		return true
+	}
+	for _, name := range rc.config.CredentialHeaders {
+		if c.GetHeader(name) != "" {
+			return true
+		}
+	}
+	for _, name := range rc.config.CredentialQueryParams {
+		if c.Query(name) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func parseSeconds(v string) time.Duration {
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return time.Duration(n) * time.Second
+}
+
+// lookup returns a fresh entry matching req. With sharedOnly, entries that may only be
+// served to anonymous requests are skipped.
+func (rc *ResponseCache) lookup(primary string, req *http.Request, now time.Time, sharedOnly bool) *cacheEntry {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	for _, e := range rc.variants[primary] {
+		if !e.matches(req) || (sharedOnly && !e.shared) {
+			continue
+		}
+		if !now.Before(e.expires) {
+			rc.removeLocked(e)
+			return nil
+		}
+		rc.lru.MoveToFront(e.elem)
+		return e
+	}
+	return nil
+}
+
+func (rc *ResponseCache) store(e *cacheEntry) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	for _, old := range rc.variants[e.primary] {
+		if strings.Join(old.vary, ",") == strings.Join(e.vary, ",") &&
+			strings.Join(old.varyValues, "\x00") == strings.Join(e.varyValues, "\x00") {
+			rc.removeLocked(old)
+			break
+		}
+	}
+	e.elem = rc.lru.PushFront(e)
+	rc.variants[e.primary] = append(rc.variants[e.primary], e)
+	for rc.lru.Len() > rc.config.MaxEntries {
+		rc.removeLocked(rc.lru.Back().Value.(*cacheEntry))
+	}
+}
+
+func (rc *ResponseCache) removeLocked(e *cacheEntry) {
+	rc.lru.Remove(e.elem)
+	variants := rc.variants[e.primary]
+	for i, v := range variants {
+		if v == e {
+			variants = append(variants[:i], variants[i+1:]...)
+			break
+		}
+	}
+	if len(variants) == 0 {
+		delete(rc.variants, e.primary)
+	} else {
+		rc.variants[e.primary] = variants
+	}
+}
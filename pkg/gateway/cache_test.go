@@ -0,0 +1,207 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func performRequestWithHeader(r http.Handler, method, path string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestETag(t *testing.T) {
+	lastModified := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	r := New()
+	r.Use(ETag(ETagConfig{}))
+	r.GET("/userinfo", func(c *Context) {
+		c.JSON(http.StatusOK, map[string]string{"sub": "alice"})
+	})
+	r.GET("/static", func(c *Context) {
+		c.Header("Last-Modified", lastModified.Format(http.TimeFormat))
+		c.String(http.StatusOK, "static")
+	})
+	r.GET("/missing", func(c *Context) {
+		c.String(http.StatusNotFound, "missing")
+	})
+
+	w := performRequest(r, http.MethodGet, "/userinfo")
+	assert.Equal(t, http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	assert.Regexp(t, `^"[A-Za-z0-9_-]+"$`, etag)
+	assert.Equal(t, etag, makeETag(w.Body.Bytes(), false))
+
+	w = performRequestWithHeader(r, http.MethodGet, "/userinfo", http.Header{"If-None-Match": {`"other", W/` + etag}})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Equal(t, etag, w.Header().Get("ETag"))
+	assert.Empty(t, w.Header().Get("Content-Type"))
+	assert.Zero(t, w.Body.Len())
+
+	w = performRequestWithHeader(r, http.MethodGet, "/userinfo", http.Header{"If-None-Match": {`"other"`}})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = performRequestWithHeader(r, http.MethodGet, "/static", http.Header{"If-Modified-Since": {lastModified.Add(time.Hour).Format(http.TimeFormat)}})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	w = performRequestWithHeader(r, http.MethodGet, "/static", http.Header{"If-Modified-Since": {lastModified.Add(-time.Hour).Format(http.TimeFormat)}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "static", w.Body.String())
+
+	w = performRequest(r, http.MethodGet, "/missing")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Empty(t, w.Header().Get("ETag"))
+}
+
+func TestResponseCache(t *testing.T) {
+	calls := 0
+	cache := NewResponseCache(CacheConfig{})
+	r := New()
+	r.Use(cache.Handler(), ETag(ETagConfig{Weak: true}))
+	r.GET("/userinfo", func(c *Context) {
+		calls++
+		c.Header("Cache-Control", "max-age=60")
+		c.Header("Vary", "Accept-Language")
+		c.String(http.StatusOK, "hello %s", c.GetHeader("Accept-Language"))
+	})
+	r.GET("/private", func(c *Context) {
+		calls++
+		c.Header("Cache-Control", "private, max-age=60")
+		c.String(http.StatusOK, "private")
+	})
+
+	en := http.Header{"Accept-Language": {"en"}}
+	w := performRequestWithHeader(r, http.MethodGet, "/userinfo", en)
+	assert.Equal(t, "hello en", w.Body.String())
+	w = performRequestWithHeader(r, http.MethodGet, "/userinfo", en)
+	assert.Equal(t, "hello en", w.Body.String())
+	assert.Equal(t, "0", w.Header().Get("Age"))
+	assert.Equal(t, 1, calls)
+
+	// another variant
+	w = performRequestWithHeader(r, http.MethodGet, "/userinfo", http.Header{"Accept-Language": {"de"}})
+	assert.Equal(t, "hello de", w.Body.String())
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, 2, cache.Len())
+
+	// conditional hit
+	etag := w.Header().Get("ETag")
+	w = performRequestWithHeader(r, http.MethodGet, "/userinfo", http.Header{"Accept-Language": {"de"}, "If-None-Match": {etag}})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Equal(t, 2, calls)
+
+	// the client asks to revalidate
+	performRequestWithHeader(r, http.MethodGet, "/userinfo", http.Header{"Accept-Language": {"en"}, "Cache-Control": {"no-cache"}})
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, 2, cache.Len())
+
+	// not stored in a shared cache
+	performRequestWithHeader(r, http.MethodGet, "/userinfo", http.Header{"Accept-Language": {"fr"}, "Authorization": {"Bearer x"}})
+	performRequest(r, http.MethodGet, "/private")
+	performRequest(r, http.MethodGet, "/private")
+	assert.Equal(t, 6, calls)
+	assert.Equal(t, 2, cache.Len())
+
+	cache.Purge()
+	assert.Zero(t, cache.Len())
+}
+
+func TestResponseCacheCredentials(t *testing.T) {
+	calls := 0
+	cache := NewResponseCache(CacheConfig{CredentialQueryParams: []string{"api_key"}})
+	r := New()
+	r.Use(cache.Handler())
+	r.GET("/news", func(c *Context) {
+		calls++
+		c.Header("Cache-Control", "public, max-age=60")
+		c.String(http.StatusOK, "news")
+	})
+	api := r.Group("/api", APIKeyAuth(APIKeyAuthConfig{
+		Keys: []APIKey{
+			{ID: "alice", Hash: HashAPIKey("alice-key")},
+			{ID: "bob", Hash: HashAPIKey("bob-key")},
+		},
+		QueryParam: "api_key",
+	}))
+	api.GET("/me", func(c *Context) {
+		calls++
+		p, _ := c.Principal()
+		c.Header("Cache-Control", "max-age=60")
+		c.String(http.StatusOK, "hello %s", p.Subject)
+	})
+	web := r.Group("/web", Sessions(SessionsConfig{Keys: [][]byte{testSessionKey}}))
+	web.GET("/login", func(c *Context) {
+		s := c.Session()
+		s.Set("user", c.Query("user"))
+		_ = s.Save()
+		c.String(http.StatusOK, "saved")
+	})
+	web.GET("/me", func(c *Context) {
+		calls++
+		user, ok := c.Session().Get("user")
+		if !ok {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		c.Header("Cache-Control", "max-age=60")
+		c.String(http.StatusOK, "hello %v", user)
+	})
+
+	w := performRequestWithHeader(r, http.MethodGet, "/api/me", http.Header{"X-Api-Key": {"alice-key"}})
+	assert.Equal(t, "hello alice", w.Body.String())
+	w = performRequestWithHeader(r, http.MethodGet, "/api/me", http.Header{"X-Api-Key": {"bob-key"}})
+	assert.Equal(t, "hello bob", w.Body.String())
+	w = performRequest(r, http.MethodGet, "/api/me?api_key=bob-key")
+	assert.Equal(t, "hello bob", w.Body.String())
+	w = performRequest(r, http.MethodGet, "/api/me")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, 3, calls)
+
+	alice := findCookie(performRequest(r, http.MethodGet, "/web/login?user=alice"), "gateway_sid")
+	bob := findCookie(performRequest(r, http.MethodGet, "/web/login?user=bob"), "gateway_sid")
+	w = performRequest(r, http.MethodGet, "/web/me", alice)
+	assert.Equal(t, "hello alice", w.Body.String())
+	w = performRequest(r, http.MethodGet, "/web/me", bob)
+	assert.Equal(t, "hello bob", w.Body.String())
+	w = performRequest(r, http.MethodGet, "/web/me")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, 6, calls)
+	assert.Zero(t, cache.Len())
+
+	// public responses are shared with requests carrying credentials
+	performRequest(r, http.MethodGet, "/news")
+	w = performRequestWithHeader(r, http.MethodGet, "/news", http.Header{"X-Api-Key": {"alice-key"}})
+	assert.Equal(t, "news", w.Body.String())
+	assert.Equal(t, 7, calls)
+	assert.Equal(t, 1, cache.Len())
+}
+
+func TestResponseCacheKeepsRequestHeaders(t *testing.T) {
+	calls := 0
+	r := New()
+	r.Use(RequestID(RequestIDConfig{}), Cache(CacheConfig{}))
+	r.GET("/userinfo", func(c *Context) {
+		calls++
+		c.Header("Cache-Control", "max-age=60")
+		c.Header("X-Upstream", "users")
+		c.String(http.StatusOK, "hello")
+	})
+
+	first := performRequest(r, http.MethodGet, "/userinfo")
+	second := performRequest(r, http.MethodGet, "/userinfo")
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, "hello", second.Body.String())
+	assert.Equal(t, "users", second.Header().Get("X-Upstream"))
+	assert.NotEmpty(t, second.Header().Get("X-Request-ID"))
+	assert.NotEqual(t, first.Header().Get("X-Request-ID"), second.Header().Get("X-Request-ID"))
+	assert.NotEmpty(t, second.Header().Get("traceparent"))
+	assert.NotEqual(t, first.Header().Get("traceparent"), second.Header().Get("traceparent"))
+	assert.Len(t, second.Header().Values("X-Request-ID"), 1)
+}
@@ -0,0 +1,404 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/idproxy/gateway/pkg/binding"
+)
+
+// ErrEncodingNotAcceptable is recorded when a request refuses the identity coding and
+// accepts none of the codecs of Compress.
+var ErrEncodingNotAcceptable = errors.New("compression: no acceptable content coding")
+
+// CompressionWriter is an encoder of a content coding. It is reset and reused for
+// many responses.
+type CompressionWriter interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// CompressionCodec is a content coding Compress can negotiate, e.g. gzip.
+type CompressionCodec struct {
+	// Name is the content coding token used in Accept-Encoding and Content-Encoding.
+	Name string
+	// NewWriter returns an encoder for the compression level.
+	NewWriter func(w io.Writer, level int) (CompressionWriter, error)
+}
+
+// GzipCodec is the gzip content coding.
+var GzipCodec = CompressionCodec{
+	Name: "gzip",
+	NewWriter: func(w io.Writer, level int) (CompressionWriter, error) {
+		return gzip.NewWriterLevel(w, level)
+	},
+}
+
+// DeflateCodec is the deflate content coding.
+var DeflateCodec = CompressionCodec{
+	Name: "deflate",
+	NewWriter: func(w io.Writer, level int) (CompressionWriter, error) {
+		return flate.NewWriter(w, level)
+	},
+}
+
+// DefaultCompressionTypes are the content types compressed by default. Entries ending in
+// "/*" match a whole type.
+var DefaultCompressionTypes = []string{
+	"text/*",
+	binding.MIMEJSON,
+	binding.MIMEXML,
+	binding.MIMEYAML,
+	binding.MIMETOML,
+	"application/javascript",
+	"application/problem+json",
+	"application/problem+xml",
+	"image/svg+xml",
+}
+
+// CompressionConfig defines the config for Compress middleware.
+type CompressionConfig struct {
+	// Codecs are the content codings offered, in order of preference when the client
+	// accepts several with the same q-value. The standard library has no brotli or zstd
+	// encoder, pure-Go implementations of them can be added as a CompressionCodec.
+	// Optional. Default value is GzipCodec and DeflateCodec.
+	Codecs []CompressionCodec
+
+	// Level is the compression level passed to every codec.
+	// Optional. Default value is gzip.DefaultCompression.
+	Level int
+
+	// MinLength is the minimum body size in bytes worth compressing.
+	// Optional. Default value is 1024.
+	MinLength int
+
+	// ContentTypes are the content types compressed.
+	// Optional. Default value is DefaultCompressionTypes.
+	ContentTypes []string
+}
+
+type compressionCodec struct {
+	name string
+	pool sync.Pool
+}
+
+// Compress returns a middleware compressing responses with the content coding negotiated
+// from Accept-Encoding. Responses are buffered until MinLength bytes are written, so
+// smaller responses are sent uncompressed, and compressible responses carry
+// Vary: Accept-Encoding whether compressed or not. Content-Length is dropped and a strong
+// ETag is made weak when a response is compressed.
+//
+// A request refusing the identity coding, e.g. with "identity;q=0" or "*;q=0", gets
+// every response compressed, and is aborted with 406 when no codec is acceptable.
+//
+// Inside the chain ResponseWriter.Size reports the bytes written by handlers, before
+// compression; once the chain returns it reports the bytes sent to the client.
+func Compress(conf CompressionConfig) HandlerFunc {
+	if len(conf.Codecs) == 0 {
+		conf.Codecs = []CompressionCodec{GzipCodec, DeflateCodec}
+	}
+	if conf.Level == 0 {
+		conf.Level = gzip.DefaultCompression
+	}
+	if conf.MinLength <= 0 {
+		conf.MinLength = 1024
+	}
+	if len(conf.ContentTypes) == 0 {
+		conf.ContentTypes = DefaultCompressionTypes
+	}
+
+	codecs := make([]*compressionCodec, len(conf.Codecs))
+	for i, codec := range conf.Codecs {
+		codec := codec
+		_, err := codec.NewWriter(io.Discard, conf.Level)
+		assert1(err == nil, "compression: invalid level for "+codec.Name)
+		codecs[i] = &compressionCodec{name: strings.ToLower(codec.Name)}
+		codecs[i].pool.New = func() any {
+			w, _ := codec.NewWriter(io.Discard, conf.Level)
+			return w
+		}
+	}
+
+	return func(c *Context) {
+		if c.Request.Method == http.MethodHead || c.GetHeader("Upgrade") != "" {
+			return
+		}
+		codec, identity := negotiateEncoding(c.GetHeader("Accept-Encoding"), codecs)
+		if codec == nil && !identity {
+			_ = c.AbortWithError(http.StatusNotAcceptable, &Error{Err: ErrEncodingNotAcceptable, Type: ErrorTypePublic})
+			return
+		}
+		cw := &compressWriter{
+			ResponseWriter:  c.Writer,
+			codec:           codec,
+			identityRefused: !identity,
+			minLength:       conf.MinLength,
+			contentTypes:    conf.ContentTypes,
+			size:            noWritten,
+		}
+		c.Writer = cw
+		defer func() {
+			c.Writer = cw.ResponseWriter
+			cw.release()
+		}()
+		c.Next()
+		if err := cw.close(); err != nil {
+			_ = c.Error(err)
+		}
+	}
+}
+
+// negotiateEncoding picks the codec with the highest q-value in an Accept-Encoding
+// header, nil if none is acceptable, and reports whether the identity coding is
+// acceptable.
+func negotiateEncoding(header string, codecs []*compressionCodec) (*compressionCodec, bool) {
+	if header == "" {
+		return nil, true
+	}
+	q := parseQValues(header)
+	identity := true
+	if weight, ok := q["identity"]; ok {
+		identity = weight > 0
+	} else if weight, ok := q["*"]; ok {
+		identity = weight > 0
+	}
+
+	var best *compressionCodec
+	bestQ := 0.0
+	for _, codec := range codecs {
+		weight, ok := q[codec.name]
+		if !ok {
+			weight, ok = q["*"]
+		}
+		if ok && weight > bestQ {
+			best, bestQ = codec, weight
+		}
+	}
+	return best, identity
+}
+
+// parseQValues returns the q-value of every lowercased value of an Accept style header.
+func parseQValues(header string) map[string]float64 {
+	q := make(map[string]float64)
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		weight := 1.0
+		for _, param := range strings.Split(params, ";") {
+			k, v, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && strings.EqualFold(k, "q") {
+				if f, err := strconv.ParseFloat(v, 64); err == nil {
+					weight = f
+				}
+			}
+		}
+		q[name] = weight
+	}
+	return q
+}
+
+// compressWriter buffers the start of a response until it can decide whether to
+// compress it.
+type compressWriter struct {
+	ResponseWriter
+
+	codec           *compressionCodec
+	identityRefused bool
+	minLength       int
+	contentTypes    []string
+
+	buf     bytes.Buffer
+	decided bool
+	encoder CompressionWriter
+	size    int
+}
+
+var _ ResponseWriter = (*compressWriter)(nil)
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if w.size < 0 {
+		w.size = 0
+	}
+	w.size += len(data)
+	if !w.decided {
+		w.buf.Write(data)
+		if w.buf.Len() < w.minLength {
+			return len(data), nil
+		}
+		if err := w.decide(); err != nil {
+			return 0, err
+		}
+		return len(data), nil
+	}
+	if w.encoder != nil {
+		return w.encoder.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *compressWriter) Size() int {
+	return w.size
+}
+
+func (w *compressWriter) Written() bool {
+	return w.size != noWritten
+}
+
+// WriteHeaderNow marks the response as written but defers sending the headers until the
+// body, if any, is known.
+func (w *compressWriter) WriteHeaderNow() {
+	if w.size < 0 {
+		w.size = 0
+	}
+}
+
+// Flush sends what is buffered, compressed if the content type qualifies, so that
+// streamed responses are not held back by MinLength.
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		if err := w.decideStreaming(); err != nil {
+			return
+		}
+	}
+	if w.encoder != nil {
+		_ = w.encoder.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.decided = true
+	return w.ResponseWriter.Hijack()
+}
+
+func (w *compressWriter) decide() error {
+	return w.start(w.compressible() && (w.identityRefused || w.buf.Len() >= w.minLength))
+}
+
+func (w *compressWriter) decideStreaming() error {
+	return w.start(w.compressible() && (w.buf.Len() > 0 || w.size < 0))
+}
+
+// compressible reports whether the response may be compressed regardless of its size,
+// and adds Vary for responses that depend on Accept-Encoding. Any content type is
+// compressed when the client refuses the identity coding.
+func (w *compressWriter) compressible() bool {
+	h := w.Header()
+	status := w.ResponseWriter.Status()
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified ||
+		status == http.StatusPartialContent || h.Get("Content-Encoding") != "" {
+		return false
+	}
+	if h.Get("Content-Type") == "" && w.buf.Len() > 0 {
+		h.Set("Content-Type", http.DetectContentType(w.buf.Bytes()))
+	}
+	if !w.identityRefused && !matchContentType(h.Get("Content-Type"), w.contentTypes) {
+		return false
+	}
+	addVary(h, "Accept-Encoding")
+	if w.codec == nil {
+		return false
+	}
+	if cl := h.Get("Content-Length"); cl != "" && !w.identityRefused {
+		if n, err := strconv.Atoi(cl); err == nil && n < w.minLength {
+			return false
+		}
+	}
+	return true
+}
+
+func (w *compressWriter) start(compress bool) error {
+	w.decided = true
+	if compress {
+		h := w.Header()
+		h.Set("Content-Encoding", w.codec.name)
+		h.Del("Content-Length")
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+		w.encoder = w.codec.pool.Get().(CompressionWriter)
+		w.encoder.Reset(w.ResponseWriter)
+	}
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	var err error
+	if w.encoder != nil {
+		_, err = w.encoder.Write(w.buf.Bytes())
+	} else {
+		_, err = w.ResponseWriter.Write(w.buf.Bytes())
+	}
+	w.buf.Reset()
+	return err
+}
+
+// close sends the rest of the response once the chain returned.
+func (w *compressWriter) close() error {
+	if !w.decided {
+		if err := w.decide(); err != nil {
+			return err
+		}
+	}
+	if w.size >= 0 {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+	if w.encoder == nil {
+		return nil
+	}
+	err := w.encoder.Close()
+	w.codec.pool.Put(w.encoder)
+	w.encoder = nil
+	return err
+}
+
+// release returns the encoder of a response that was not closed, e.g. after a panic.
+func (w *compressWriter) release() {
+	if w.encoder != nil {
+		w.encoder.Reset(io.Discard)
+		w.codec.pool.Put(w.encoder)
+		w.encoder = nil
+	}
+}
+
+func matchContentType(contentType string, allowed []string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range allowed {
+		if t == mediaType || (strings.HasSuffix(t, "/*") && strings.HasPrefix(mediaType, t[:len(t)-1])) {
+			return true
+		}
+	}
+	return false
+}
+
+// addVary adds a field name to the Vary header unless already listed.
+func addVary(h http.Header, name string) {
+	for _, v := range h.Values("Vary") {
+		for _, f := range strings.Split(v, ",") {
+			if f = strings.TrimSpace(f); f == "*" || strings.EqualFold(f, name) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", name)
+}
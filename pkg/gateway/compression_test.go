@@ -0,0 +1,138 @@
+package gateway
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	gz, deflate := &compressionCodec{name: "gzip"}, &compressionCodec{name: "deflate"}
+	codecs := []*compressionCodec{gz, deflate}
+
+	for _, tt := range []struct {
+		header   string
+		want     *compressionCodec
+		identity bool
+	}{
+		{"", nil, true},
+		{"identity", nil, true},
+		{"gzip", gz, true},
+		{"deflate, gzip", gz, true},
+		{"gzip;q=0.5, deflate", deflate, true},
+		{"GZIP;Q=0.8, deflate;q=0.8", gz, true},
+		{"gzip;q=0, *", deflate, true},
+		{"*;q=0.1", gz, true},
+		{"br, zstd", nil, true},
+		{"gzip, identity;q=0", gz, false},
+		{"br, *;q=0", nil, false},
+		{"identity, *;q=0", nil, true},
+	} {
+		got, identity := negotiateEncoding(tt.header, codecs)
+		assert.Equal(t, tt.want, got, tt.header)
+		assert.Equal(t, tt.identity, identity, tt.header)
+	}
+}
+
+func TestCompress(t *testing.T) {
+	large := strings.Repeat(`{"hello":"world"}`, 100)
+	var innerSize int
+	r := New()
+	r.Use(Compress(CompressionConfig{}))
+	r.GET("/large", func(c *Context) {
+		c.Header("Content-Length", "1700")
+		c.Header("ETag", `"v1"`)
+		c.Data(http.StatusOK, "application/json", []byte(large))
+		innerSize = c.Writer.Size()
+	})
+	r.GET("/small", func(c *Context) {
+		c.Data(http.StatusOK, "application/json", []byte(`{}`))
+	})
+	r.GET("/image", func(c *Context) {
+		c.Data(http.StatusOK, "image/png", []byte(large))
+	})
+	r.GET("/empty", func(c *Context) {
+		c.AbortWithStatus(http.StatusForbidden)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/large", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+	assert.Empty(t, w.Header().Get("Content-Length"))
+	assert.Equal(t, `W/"v1"`, w.Header().Get("ETag"))
+	assert.Equal(t, len(large), innerSize)
+	zr, err := gzip.NewReader(w.Body)
+	require.NoError(t, err)
+	body, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, large, string(body))
+
+	for _, path := range []string{"/small", "/image"} {
+		req = httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code, path)
+		assert.Empty(t, w.Header().Get("Content-Encoding"), path)
+	}
+
+	w = performRequest(r, http.MethodGet, "/large")
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+	assert.Equal(t, large, w.Body.String())
+
+	// identity refused: small and unlisted content types are compressed too
+	for _, path := range []string{"/small", "/image"} {
+		req = httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept-Encoding", "gzip, identity;q=0")
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code, path)
+		assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"), path)
+	}
+	req = httptest.NewRequest(http.MethodGet, "/small", nil)
+	req.Header.Set("Accept-Encoding", "br, *;q=0")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotAcceptable, w.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/empty", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.Zero(t, w.Body.Len())
+}
+
+func TestCompressFlush(t *testing.T) {
+	r := New()
+	r.Use(Compress(CompressionConfig{}))
+	r.GET("/stream", func(c *Context) {
+		c.Header("Content-Type", "text/plain")
+		_, _ = c.Writer.WriteString("chunk")
+		c.Writer.Flush()
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/stream", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.True(t, w.Flushed)
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	zr, err := gzip.NewReader(w.Body)
+	require.NoError(t, err)
+	body, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, "chunk", string(body))
+}
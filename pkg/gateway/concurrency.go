@@ -0,0 +1,269 @@
+package gateway
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrOverloaded is recorded when a request is shed by a ConcurrencyLimiter.
+var ErrOverloaded = errors.New("server overloaded")
+
+// Priority classifies requests for load shedding.
+type Priority int
+
+const (
+	// PriorityLow requests are shed first.
+	PriorityLow Priority = iota
+	// PriorityNormal is the default priority.
+	PriorityNormal
+	// PriorityHigh requests are admitted from the queue before lower priorities.
+	PriorityHigh
+	// PriorityCritical requests bypass the limiter, e.g. health checks.
+	PriorityCritical
+)
+
+// ConcurrencyLimitConfig defines the config for ConcurrencyLimiter.
+type ConcurrencyLimitConfig struct {
+	// MaxInFlight is the maximum number of requests handled concurrently.
+	MaxInFlight int
+
+	// MaxQueue is the number of requests allowed to wait for a slot.
+	// Optional. Default value is 0, requests over the limit are shed immediately.
+	MaxQueue int
+
+	// QueueTimeout is how long a request waits in the queue before being shed.
+	// Optional. Default value is one second.
+	QueueTimeout time.Duration
+
+	// PriorityFunc classifies requests. When the queue is full a request evicts a
+	// queued request of lower priority, if any.
+	// Optional. Default value classifies every request as PriorityNormal.
+	PriorityFunc func(c *Context) Priority
+
+	// TargetLatency enables adaptive limiting: the limit is lowered multiplicatively
+	// while the average latency is above the target and raised by one while it is below
+	// and the limit is saturated, between MinInFlight and MaxInFlight.
+	// Optional. Default value is 0, which disables adaptive limiting.
+	TargetLatency time.Duration
+	// MinInFlight is the lower bound of the adaptive limit.
+	// Optional. Default value is 1.
+	MinInFlight int
+	// AdjustInterval is how often the adaptive limit is adjusted.
+	// Optional. Default value is one second.
+	AdjustInterval time.Duration
+
+	// RetryAfter is sent with shed requests.
+	// Optional. Default value is one second.
+	RetryAfter time.Duration
+}
+
+type concurrencyWaiter struct {
+	priority Priority
+	ready    chan bool // true when admitted, false when evicted
+}
+
+// ConcurrencyLimiter caps the number of requests handled concurrently. Install one on
+// the gateway and further ones on route groups to limit at both levels.
+type ConcurrencyLimiter struct {
+	config ConcurrencyLimitConfig
+
+	mu         sync.Mutex
+	inFlight   int
+	limit      int
+	queues     [PriorityCritical][]*concurrencyWaiter
+	queued     int
+	shed       uint64
+	avgLatency time.Duration
+	saturated  bool
+	lastAdjust time.Time
+}
+
+// NewConcurrencyLimiter returns a limiter for the given config.
+func NewConcurrencyLimiter(conf ConcurrencyLimitConfig) *ConcurrencyLimiter {
+	assert1(conf.MaxInFlight > 0, "concurrency limit: MaxInFlight must be positive")
+	if conf.QueueTimeout <= 0 {
+		conf.QueueTimeout = time.Second
+	}
+	if conf.PriorityFunc == nil {
+		conf.PriorityFunc = func(*Context) Priority { return PriorityNormal }
+	}
+	if conf.MinInFlight <= 0 {
+		conf.MinInFlight = 1
+	}
+	if conf.AdjustInterval <= 0 {
+		conf.AdjustInterval = time.Second
+	}
+	if conf.RetryAfter <= 0 {
+		conf.RetryAfter = time.Second
+	}
+	return &ConcurrencyLimiter{config: conf, limit: conf.MaxInFlight, lastAdjust: time.Now()}
+}
+
+// ConcurrencyLimit returns a middleware backed by a new ConcurrencyLimiter.
+func ConcurrencyLimit(conf ConcurrencyLimitConfig) HandlerFunc {
+	return NewConcurrencyLimiter(conf).Handler()
+}
+
+// Handler returns the middleware enforcing the limit. Shed requests are aborted with
+// 503 and a Retry-After header.
+func (l *ConcurrencyLimiter) Handler() HandlerFunc {
+	retryAfter := strconv.Itoa(ceilSeconds(l.config.RetryAfter))
+	return func(c *Context) {
+		priority := l.config.PriorityFunc(c)
+		if priority >= PriorityCritical {
+			return
+		}
+		if priority < PriorityLow {
+			priority = PriorityLow
+		}
+		if !l.acquire(c, priority) {
+			c.Header("Retry-After", retryAfter)
+			_ = c.AbortWithError(http.StatusServiceUnavailable, &Error{Err: ErrOverloaded, Type: ErrorTypePublic})
+			return
+		}
+		start := time.Now()
+		defer func() {
+			l.release(time.Since(start))
+		}()
+		c.Next()
+	}
+}
+
+// InFlight returns the number of requests currently handled.
+func (l *ConcurrencyLimiter) InFlight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inFlight
+}
+
+// Limit returns the current limit, which changes over time when adaptive.
+func (l *ConcurrencyLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// Queued returns the number of requests waiting for a slot.
+func (l *ConcurrencyLimiter) Queued() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.queued
+}
+
+// Shed returns the number of requests shed so far.
+func (l *ConcurrencyLimiter) Shed() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.shed
+}
+
+func (l *ConcurrencyLimiter) acquire(c *Context, priority Priority) bool {
+	l.mu.Lock()
+	if l.inFlight < l.limit {
+		l.inFlight++
+		l.mu.Unlock()
+		return true
+	}
+	l.saturated = true
+	if l.queued >= l.config.MaxQueue && !l.evictLocked(priority) {
+		l.shed++
+		l.mu.Unlock()
+		return false
+	}
+	w := &concurrencyWaiter{priority: priority, ready: make(chan bool, 1)}
+	l.queues[priority] = append(l.queues[priority], w)
+	l.queued++
+	l.mu.Unlock()
+
+	timer := time.NewTimer(l.config.QueueTimeout)
+	defer timer.Stop()
+	select {
+	case ok := <-w.ready:
+		return ok
+	case <-timer.C:
+	case <-c.Request.Context().Done():
+	}
+
+	l.mu.Lock()
+	if l.removeLocked(w) {
+		l.shed++
+		l.mu.Unlock()
+		return false
+	}
+	l.mu.Unlock()
+	// admitted or evicted while timing out
+	return <-w.ready
+}
+
+// evictLocked sheds the newest queued request of the lowest priority below priority.
+func (l *ConcurrencyLimiter) evictLocked(priority Priority) bool {
+	for p := PriorityLow; p < priority; p++ {
+		if q := l.queues[p]; len(q) > 0 {
+			w := q[len(q)-1]
+			l.queues[p] = q[:len(q)-1]
+			l.queued--
+			l.shed++
+			w.ready <- false
+			return true
+		}
+	}
+	return false
+}
+
+func (l *ConcurrencyLimiter) removeLocked(w *concurrencyWaiter) bool {
+	q := l.queues[w.priority]
+	for i, e := range q {
+		if e == w {
+			l.queues[w.priority] = append(q[:i], q[i+1:]...)
+			l.queued--
+			return true
+		}
+	}
+	return false
+}
+
+func (l *ConcurrencyLimiter) release(latency time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+	if l.config.TargetLatency > 0 {
+		l.adjustLocked(latency)
+	}
+	for p := PriorityCritical - 1; p >= PriorityLow && l.inFlight < l.limit; p-- {
+		for len(l.queues[p]) > 0 && l.inFlight < l.limit {
+			w := l.queues[p][0]
+			l.queues[p] = l.queues[p][1:]
+			l.queued--
+			l.inFlight++
+			w.ready <- true
+		}
+	}
+}
+
+// adjustLocked implements additive increase, multiplicative decrease of the limit
+// based on the moving average latency.
+func (l *ConcurrencyLimiter) adjustLocked(latency time.Duration) {
+	if l.avgLatency == 0 {
+		l.avgLatency = latency
+	} else {
+		l.avgLatency = (l.avgLatency*9 + latency) / 10
+	}
+	now := time.Now()
+	if now.Sub(l.lastAdjust) < l.config.AdjustInterval {
+		return
+	}
+	l.lastAdjust = now
+	switch {
+	case l.avgLatency > l.config.TargetLatency:
+		l.limit = l.limit * 9 / 10
+		if l.limit < l.config.MinInFlight {
+			l.limit = l.config.MinInFlight
+		}
+	case l.saturated && l.limit < l.config.MaxInFlight:
+		l.limit++
+	}
+	l.saturated = false
+}
@@ -0,0 +1,208 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newConcurrencyTestGateway returns a gateway whose /block route holds its slot until
+// unblock is closed and whose /fast route returns immediately. The X-Priority header sets the priority of a request.
+func newConcurrencyTestGateway(conf ConcurrencyLimitConfig, unblock <-chan struct{}) (*Gateway, *ConcurrencyLimiter) {
+	conf.PriorityFunc = func(c *Context) Priority {
+		p, err := strconv.Atoi(c.GetHeader("X-Priority"))
+		if err != nil {
+			return PriorityNormal
+		}
+		return Priority(p)
+	}
+	l := NewConcurrencyLimiter(conf)
+	r := New()
+	r.Use(l.Handler())
+	r.GET("/block", func(c *Context) {
+		<-unblock
+		c.String(http.StatusOK, "ok")
+	})
+	r.GET("/fast", func(c *Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	return r, l
+}
+
+func serveAsync(r http.Handler, req *http.Request) <-chan *httptest.ResponseRecorder {
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		done <- w
+	}()
+	return done
+}
+
+func blockRequest(priority Priority) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/block", nil)
+	req.Header.Set("X-Priority", strconv.Itoa(int(priority)))
+	return req
+}
+
+func TestConcurrencyLimitAdmitsUpToLimit(t *testing.T) {
+	unblock := make(chan struct{})
+	r, l := newConcurrencyTestGateway(ConcurrencyLimitConfig{MaxInFlight: 2}, unblock)
+
+	first := serveAsync(r, blockRequest(PriorityNormal))
+	second := serveAsync(r, blockRequest(PriorityNormal))
+	require.Eventually(t, func() bool { return l.InFlight() == 2 }, time.Second, time.Millisecond)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, blockRequest(PriorityNormal))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	assert.Equal(t, uint64(1), l.Shed())
+
+	close(unblock)
+	assert.Equal(t, http.StatusOK, (<-first).Code)
+	assert.Equal(t, http.StatusOK, (<-second).Code)
+	assert.Zero(t, l.InFlight())
+}
+
+func TestConcurrencyLimitQueueTimeout(t *testing.T) {
+	unblock := make(chan struct{})
+	r, l := newConcurrencyTestGateway(ConcurrencyLimitConfig{
+		MaxInFlight:  1,
+		MaxQueue:     1,
+		QueueTimeout: 20 * time.Millisecond,
+		RetryAfter:   1500 * time.Millisecond,
+	}, unblock)
+
+	first := serveAsync(r, blockRequest(PriorityNormal))
+	require.Eventually(t, func() bool { return l.InFlight() == 1 }, time.Second, time.Millisecond)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, blockRequest(PriorityNormal))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+	assert.Zero(t, l.Queued())
+	assert.Equal(t, uint64(1), l.Shed())
+
+	close(unblock)
+	assert.Equal(t, http.StatusOK, (<-first).Code)
+}
+
+func TestConcurrencyLimitEvictsLowerPriority(t *testing.T) {
+	unblock := make(chan struct{})
+	r, l := newConcurrencyTestGateway(ConcurrencyLimitConfig{MaxInFlight: 1, MaxQueue: 1, QueueTimeout: time.Minute}, unblock)
+
+	first := serveAsync(r, blockRequest(PriorityNormal))
+	require.Eventually(t, func() bool { return l.InFlight() == 1 }, time.Second, time.Millisecond)
+	// out of range priorities are treated as PriorityLow
+	low := serveAsync(r, blockRequest(-1))
+	require.Eventually(t, func() bool { return l.Queued() == 1 }, time.Second, time.Millisecond)
+
+	// a request of the same priority does not evict
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, blockRequest(PriorityLow))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	high := serveAsync(r, blockRequest(PriorityHigh))
+	assert.Equal(t, http.StatusServiceUnavailable, (<-low).Code)
+	require.Eventually(t, func() bool { return l.Queued() == 1 }, time.Second, time.Millisecond)
+	assert.Equal(t, uint64(2), l.Shed())
+
+	close(unblock)
+	assert.Equal(t, http.StatusOK, (<-first).Code)
+	assert.Equal(t, http.StatusOK, (<-high).Code)
+}
+
+func TestConcurrencyLimitCriticalBypass(t *testing.T) {
+	unblock := make(chan struct{})
+	r, l := newConcurrencyTestGateway(ConcurrencyLimitConfig{MaxInFlight: 1}, unblock)
+
+	first := serveAsync(r, blockRequest(PriorityNormal))
+	require.Eventually(t, func() bool { return l.InFlight() == 1 }, time.Second, time.Millisecond)
+
+	for priority, code := range map[Priority]int{
+		PriorityHigh:     http.StatusServiceUnavailable,
+		PriorityCritical: http.StatusOK,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/fast", nil)
+		req.Header.Set("X-Priority", strconv.Itoa(int(priority)))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, code, w.Code, priority)
+	}
+	assert.Equal(t, 1, l.InFlight())
+
+	close(unblock)
+	assert.Equal(t, http.StatusOK, (<-first).Code)
+}
+
+func TestConcurrencyLimitClientCancel(t *testing.T) {
+	unblock := make(chan struct{})
+	r, l := newConcurrencyTestGateway(ConcurrencyLimitConfig{MaxInFlight: 1, MaxQueue: 1, QueueTimeout: time.Minute}, unblock)
+
+	first := serveAsync(r, blockRequest(PriorityNormal))
+	require.Eventually(t, func() bool { return l.InFlight() == 1 }, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	queued := serveAsync(r, blockRequest(PriorityNormal).WithContext(ctx))
+	require.Eventually(t, func() bool { return l.Queued() == 1 }, time.Second, time.Millisecond)
+	cancel()
+	assert.Equal(t, http.StatusServiceUnavailable, (<-queued).Code)
+	assert.Zero(t, l.Queued())
+	assert.Equal(t, uint64(1), l.Shed())
+
+	close(unblock)
+	assert.Equal(t, http.StatusOK, (<-first).Code)
+	assert.Zero(t, l.InFlight())
+}
+
+func TestConcurrencyLimitAdaptive(t *testing.T) {
+	l := NewConcurrencyLimiter(ConcurrencyLimitConfig{
+		MaxInFlight:    10,
+		MinInFlight:    2,
+		TargetLatency:  100 * time.Millisecond,
+		AdjustInterval: time.Nanosecond,
+	})
+
+	// slow responses lower the limit multiplicatively down to MinInFlight
+	for i := 0; i < 5; i++ {
+		require.True(t, l.acquire(nil, PriorityNormal))
+		time.Sleep(time.Microsecond)
+		l.release(time.Second)
+	}
+	assert.Equal(t, 5, l.Limit())
+	for i := 0; i < 10; i++ {
+		require.True(t, l.acquire(nil, PriorityNormal))
+		time.Sleep(time.Microsecond)
+		l.release(time.Second)
+	}
+	assert.Equal(t, 2, l.Limit())
+
+	// fast responses raise it by one while it is saturated
+	for i := 0; i < 100 && l.Limit() < 4; i++ {
+		limit := l.Limit()
+		for j := 0; j < limit; j++ {
+			require.True(t, l.acquire(nil, PriorityNormal))
+		}
+		assert.False(t, l.acquire(nil, PriorityNormal))
+		time.Sleep(time.Microsecond)
+		for j := 0; j < limit; j++ {
+			l.release(time.Millisecond)
+		}
+	}
+	assert.Equal(t, 4, l.Limit())
+
+	// but not while it is not
+	for i := 0; i < 5; i++ {
+		require.True(t, l.acquire(nil, PriorityNormal))
+		time.Sleep(time.Microsecond)
+		l.release(time.Millisecond)
+	}
+	assert.Equal(t, 4, l.Limit())
+}
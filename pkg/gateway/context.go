@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 
 	"github.com/idproxy/gateway/pkg/render"
 )
@@ -31,7 +32,7 @@ type Context struct {
 	skippedNodes *[]skippedNode
 
 	// This mutex protects Keys map.
-	//mu sync.RWMutex
+	mu sync.RWMutex
 
 	// Keys is a key/value pair exclusively for the context of each request.
 	Keys map[string]any
@@ -52,6 +53,10 @@ type Context struct {
 	// SameSite allows a server to define a cookie attribute making it impossible for
 	// the browser to send this cookie along with cross-site requests.
 	sameSite http.SameSite
+
+	// span is the current span of a traced request, see Tracing.
+	span   *Span
+	tracer *tracer
 }
 
 /************************************/
@@ -71,10 +76,22 @@ func (c *Context) reset() {
 	c.queryCache = nil
 	c.formCache = nil
 	c.sameSite = 0
+	c.span = nil
+	c.tracer = nil
 	*c.params = (*c.params)[:0]
 	*c.skippedNodes = (*c.skippedNodes)[:0]
 }
 
+// FullPath returns a matched route full path. For not found routes
+// returns an empty string.
+//
+//	router.GET("/user/:id", func(c *gateway.Context) {
+//	    c.FullPath() == "/user/:id" // true
+//	})
+func (c *Context) FullPath() string {
+	return c.fullPath
+}
+
 func (r *Context) ClientIP() string {
 	remoteIP := net.ParseIP(r.RemoteIP())
 	if remoteIP == nil {
@@ -99,7 +116,11 @@ func (r *Context) RemoteIP() string {
 func (r *Context) Next() {
 	r.index++
 	for r.index < int8(len(r.handlers)) {
-		r.handlers[r.index](r)
+		if r.tracer != nil && r.tracer.handlerSpans {
+			r.runTraced(r.handlers[r.index])
+		} else {
+			r.handlers[r.index](r)
+		}
 		r.index++
 	}
 }
@@ -120,6 +141,27 @@ func (r *Context) AbortWithStatus(code int) {
 	r.Abort()
 }
 
+// AbortWithError calls `AbortWithStatus()` and `Error()` internally.
+// This method stops the chain, writes the status code and pushes the specified error to `c.Errors`.
+// See Context.Error() for more details.
+func (c *Context) AbortWithError(code int, err error) *Error {
+	c.AbortWithStatus(code)
+	return c.Error(err)
+}
+
+// AbortWithStatusJSON calls `Abort()` and then `JSON` internally.
+// This method stops the chain, writes the status code and return a JSON body.
+// It also sets the Content-Type as "application/json".
+func (c *Context) AbortWithStatusJSON(code int, jsonObj any) {
+	c.Abort()
+	c.JSON(code, jsonObj)
+}
+
+// IsAborted returns true if the current context was aborted.
+func (c *Context) IsAborted() bool {
+	return c.index >= abortIndex
+}
+
 /************************************/
 /********* ERROR MANAGEMENT *********/
 /************************************/
@@ -147,6 +189,76 @@ func (r *Context) Error(err error) *Error {
 	return parsedError
 }
 
+/************************************/
+/******** METADATA MANAGEMENT********/
+/************************************/
+
+// Set is used to store a new key/value pair exclusively for this context.
+// It also lazy initializes  c.Keys if it was not used previously.
+func (c *Context) Set(key string, value any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Keys == nil {
+		c.Keys = make(map[string]any)
+	}
+
+	c.Keys[key] = value
+}
+
+// Get returns the value for the given key, ie: (value, true).
+// If the value does not exist it returns (nil, false)
+func (c *Context) Get(key string) (value any, exists bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	value, exists = c.Keys[key]
+	return
+}
+
+// GetString returns the value associated with the key as a string.
+func (c *Context) GetString(key string) (s string) {
+	if val, ok := c.Get(key); ok && val != nil {
+		s, _ = val.(string)
+	}
+	return
+}
+
+/************************************/
+/************ INPUT DATA ************/
+/************************************/
+
+// Query returns the keyed url query value if it exists,
+// otherwise it returns an empty string `("")`.
+func (c *Context) Query(key string) (value string) {
+	value, _ = c.GetQuery(key)
+	return
+}
+
+// GetQuery is like Query(), it returns the keyed url query value
+// if it exists `(value, true)` (even when the value is an empty string),
+// otherwise it returns `("", false)`.
+func (c *Context) GetQuery(key string) (string, bool) {
+	c.initQueryCache()
+	if values, ok := c.queryCache[key]; ok && len(values) > 0 {
+		return values[0], true
+	}
+	return "", false
+}
+
+func (c *Context) initQueryCache() {
+	if c.queryCache == nil {
+		if c.Request != nil && c.Request.URL != nil {
+			c.queryCache = c.Request.URL.Query()
+		} else {
+			c.queryCache = url.Values{}
+		}
+	}
+}
+
+// GetHeader returns value from request headers.
+func (c *Context) GetHeader(key string) string {
+	return c.Request.Header.Get(key)
+}
+
 /************************************/
 /******** RESPONSE RENDERING ********/
 /************************************/
@@ -169,6 +281,17 @@ func (r *Context) Status(code int) {
 	r.Writer.WriteHeader(code)
 }
 
+// Header is an intelligent shortcut for c.Writer.Header().Set(key, value).
+// It writes a header in the response.
+// If value == "", this method removes the header `c.Writer.Header().Del(key)`
+func (c *Context) Header(key, value string) {
+	if value == "" {
+		c.Writer.Header().Del(key)
+		return
+	}
+	c.Writer.Header().Set(key, value)
+}
+
 // String writes the given string into the response body.
 func (r *Context) String(code int, format string, values ...any) {
 	r.Render(code, render.String{Format: format, Data: values})
@@ -180,6 +303,14 @@ func (c *Context) JSON(code int, obj any) {
 	c.Render(code, render.JSON{Data: obj})
 }
 
+// Data writes some data into the body stream and updates the HTTP code.
+func (c *Context) Data(code int, contentType string, data []byte) {
+	c.Render(code, render.Data{
+		ContentType: contentType,
+		Data:        data,
+	})
+}
+
 // Render writes the response headers and calls render.Render to render data.
 func (c *Context) Render(code int, r render.Render) {
 	c.Status(code)
@@ -196,3 +327,62 @@ func (c *Context) Render(code int, r render.Render) {
 		c.Abort()
 	}
 }
+
+// SetSameSite with cookie
+func (c *Context) SetSameSite(samesite http.SameSite) {
+	c.sameSite = samesite
+}
+
+// SetCookie adds a Set-Cookie header to the ResponseWriter's headers.
+// The provided cookie must have a valid Name. Invalid cookies may be
+// silently dropped.
+func (c *Context) SetCookie(name, value string, maxAge int, path, domain string, secure, httpOnly bool) {
+	if path == "" {
+		path = "/"
+	}
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    url.QueryEscape(value),
+		MaxAge:   maxAge,
+		Path:     path,
+		Domain:   domain,
+		SameSite: c.sameSite,
+		Secure:   secure,
+		HttpOnly: httpOnly,
+	})
+}
+
+// SetCookieData adds a Set-Cookie header for cookie to the ResponseWriter's headers.
+// Unlike SetCookie the value is written as is. An empty Path defaults to "/" and the
+// default SameSite mode to the one set with SetSameSite.
+func (c *Context) SetCookieData(cookie *http.Cookie) {
+	if cookie.Path == "" {
+		cookie.Path = "/"
+	}
+	if cookie.SameSite == http.SameSiteDefaultMode {
+		cookie.SameSite = c.sameSite
+	}
+	http.SetCookie(c.Writer, cookie)
+}
+
+// Cookie returns the named cookie provided in the request or
+// ErrNoCookie if not found. And return the named cookie is unescaped.
+// If multiple cookies match the given name, only one cookie will
+// be returned.
+func (c *Context) Cookie(name string) (string, error) {
+	cookie, err := c.Request.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+	val, _ := url.QueryUnescape(cookie.Value)
+	return val, nil
+}
+
+// Redirect returns an HTTP redirect to the specific location.
+func (c *Context) Redirect(code int, location string) {
+	c.Render(-1, render.Redirect{
+		Code:     code,
+		Location: location,
+		Request:  c.Request,
+	})
+}
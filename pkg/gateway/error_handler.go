@@ -0,0 +1,240 @@
+package gateway
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// ProblemMapping describes the problem response for an error.
+type ProblemMapping struct {
+	// Status is the status code of the response, unless a handler set an error status.
+	Status int
+	// Type is the problem type URI. Default value is "about:blank".
+	Type string
+	// Title is the problem title. Default value is the status text.
+	Title string
+}
+
+type problemEntry struct {
+	match   func(error) bool
+	mapping ProblemMapping
+}
+
+// ProblemRegistry maps errors to problem responses. Entries are matched in the order
+// they were registered.
+type ProblemRegistry struct {
+	mu      sync.RWMutex
+	entries []problemEntry
+}
+
+// NewProblemRegistry returns an empty registry.
+func NewProblemRegistry() *ProblemRegistry {
+	return &ProblemRegistry{}
+}
+
+// Register maps errors matching target with errors.Is.
+func (r *ProblemRegistry) Register(target error, m ProblemMapping) {
+	r.RegisterFunc(func(err error) bool { return errors.Is(err, target) }, m)
+}
+
+// RegisterFunc maps errors for which match returns true, e.g. to match error types with
+// errors.As.
+func (r *ProblemRegistry) RegisterFunc(match func(error) bool, m ProblemMapping) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, problemEntry{match: match, mapping: m})
+}
+
+// Lookup returns the mapping of the first entry matching err.
+func (r *ProblemRegistry) Lookup(err error) (ProblemMapping, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, e := range r.entries {
+		if e.match(err) {
+			return e.mapping, true
+		}
+	}
+	return ProblemMapping{}, false
+}
+
+// DefaultProblemRegistry maps the errors of this package. It is used by ErrorHandler
+// when no registry is configured; applications can add their own errors to it.
+var DefaultProblemRegistry = NewProblemRegistry()
+
+func init() {
+	for err, status := range map[error]int{
+		ErrInvalidCredentials:  http.StatusUnauthorized,
+		ErrAPIKeyExpired:       http.StatusUnauthorized,
+		ErrTokenInactive:       http.StatusUnauthorized,
+		ErrUnauthenticated:     http.StatusUnauthorized,
+		ErrForbidden:           http.StatusForbidden,
+		ErrRateLimited:         http.StatusTooManyRequests,
+		ErrOverloaded:          http.StatusServiceUnavailable,
+		ErrRequestTimeout:      http.StatusServiceUnavailable,
+		ErrBodyTooLarge:        http.StatusRequestEntityTooLarge,
+		ErrUnsupportedEncoding: http.StatusUnsupportedMediaType,
+		ErrMalformedBody:       http.StatusBadRequest,
+		ErrIdempotencyKey:      http.StatusBadRequest,
+		ErrIdempotencyInFlight: http.StatusConflict,
+		ErrIdempotencyMismatch: http.StatusUnprocessableEntity,
+	} {
+		DefaultProblemRegistry.Register(err, ProblemMapping{Status: status})
+	}
+}
+
+// ErrorHandlerConfig defines the config for ErrorHandler middleware.
+type ErrorHandlerConfig struct {
+	// Registry maps errors to status codes, types and titles.
+	// Optional. Default value is DefaultProblemRegistry.
+	Registry *ProblemRegistry
+}
+
+// ErrorHandler returns a middleware that turns the errors in Context.Errors into RFC 7807
+// problem responses, once the chain returned without writing a body. It responds when
+// the status is an error status, including the 404 and 405 of the router, or the chain
+// was aborted with errors.
+//
+// The last public, bind or render error decides the response: its registry mapping
+// gives the type, title and, unless a handler set an error status, the status. Bind
+// errors default to 400, other errors to 500. The message of public and bind errors is
+// the detail, and a map[string]any Meta is added as extension members. Private errors
+// only produce a generic problem.
+//
+// Headers written by AbortWithStatus and AbortWithError are held back until the chain
+// returns, so that the problem can still be written.
+func ErrorHandler(conf ErrorHandlerConfig) HandlerFunc {
+	registry := conf.Registry
+	if registry == nil {
+		registry = DefaultProblemRegistry
+	}
+	return func(c *Context) {
+		w := &deferredHeaderWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		defer func() {
+			c.Writer = w.ResponseWriter
+		}()
+
+		c.Next()
+
+		c.Writer = w.ResponseWriter
+		if w.passthrough || w.ResponseWriter.Written() {
+			w.commit()
+			return
+		}
+		p := problemFor(c, registry)
+		if p == nil {
+			w.commit()
+			return
+		}
+		c.AbortWithProblem(p)
+	}
+}
+
+// problemFor builds the problem response of a request, nil if it did not fail.
+func problemFor(c *Context, registry *ProblemRegistry) *Problem {
+	status := c.Writer.Status()
+	explicit := status >= http.StatusBadRequest
+	if !explicit && (len(c.Errors) == 0 || !c.IsAborted()) {
+		return nil
+	}
+
+	last := c.Errors.ByType(ErrorTypePublic | ErrorTypeBind | ErrorTypeRender).Last()
+	if last == nil {
+		if !explicit {
+			status = http.StatusInternalServerError
+		}
+		if len(c.Errors) > 0 {
+			if m, ok := registry.Lookup(c.Errors.Last()); ok && !explicit && m.Status != 0 {
+				status = m.Status
+			}
+		}
+		return NewProblem(status)
+	}
+
+	m, mapped := registry.Lookup(last)
+	if !explicit {
+		switch {
+		case mapped && m.Status != 0:
+			status = m.Status
+		case last.IsType(ErrorTypeBind):
+			status = http.StatusBadRequest
+		default:
+			status = http.StatusInternalServerError
+		}
+	}
+	p := NewProblem(status)
+	if m.Type != "" {
+		p.Type = m.Type
+	}
+	if m.Title != "" {
+		p.Title = m.Title
+	}
+	if last.IsType(ErrorTypePublic | ErrorTypeBind) {
+		p.Detail = last.Error()
+		if meta, ok := last.Meta.(map[string]any); ok {
+			p.Extensions = meta
+		}
+	}
+	return p
+}
+
+// deferredHeaderWriter holds back WriteHeaderNow until the body is written, flushed or
+// the connection hijacked, or ErrorHandler commits it.
+type deferredHeaderWriter struct {
+	ResponseWriter
+
+	pending     bool
+	passthrough bool
+}
+
+var _ ResponseWriter = (*deferredHeaderWriter)(nil)
+
+func (w *deferredHeaderWriter) Write(data []byte) (int, error) {
+	w.passthrough = true
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *deferredHeaderWriter) WriteString(s string) (int, error) {
+	w.passthrough = true
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *deferredHeaderWriter) WriteHeaderNow() {
+	if w.passthrough {
+		w.ResponseWriter.WriteHeaderNow()
+		return
+	}
+	w.pending = true
+}
+
+func (w *deferredHeaderWriter) Written() bool {
+	return w.pending || w.ResponseWriter.Written()
+}
+
+func (w *deferredHeaderWriter) Size() int {
+	if w.pending && !w.ResponseWriter.Written() {
+		return 0
+	}
+	return w.ResponseWriter.Size()
+}
+
+func (w *deferredHeaderWriter) Flush() {
+	w.passthrough = true
+	w.ResponseWriter.Flush()
+}
+
+func (w *deferredHeaderWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.passthrough = true
+	return w.ResponseWriter.Hijack()
+}
+
+// commit writes the headers held back.
+func (w *deferredHeaderWriter) commit() {
+	if w.pending {
+		w.pending = false
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
@@ -0,0 +1,111 @@
+package gateway
+
+import (
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/idproxy/gateway/internal/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decodeProblem(t *testing.T, body []byte) map[string]any {
+	var p map[string]any
+	require.NoError(t, json.Unmarshal(body, &p), string(body))
+	return p
+}
+
+func TestErrorHandler(t *testing.T) {
+	errNoUser := errors.New("user does not exist")
+	registry := NewProblemRegistry()
+	registry.Register(errNoUser, ProblemMapping{Status: http.StatusNotFound, Type: "https://example.com/problems/no-user", Title: "No such user"})
+
+	r := New()
+	r.Use(RequestID(RequestIDConfig{}), ErrorHandler(ErrorHandlerConfig{Registry: registry}))
+	r.GET("/mapped", func(c *Context) {
+		_ = c.Error(&Error{Err: errNoUser, Type: ErrorTypePublic, Meta: map[string]any{"user": "42"}})
+		c.Abort()
+	})
+	r.GET("/explicit", func(c *Context) {
+		c.Header("WWW-Authenticate", "Basic")
+		_ = c.AbortWithError(http.StatusUnauthorized, &Error{Err: ErrInvalidCredentials, Type: ErrorTypePublic})
+	})
+	r.GET("/private", func(c *Context) {
+		_ = c.AbortWithError(http.StatusBadGateway, errors.New("dial tcp 10.0.0.1: refused"))
+	})
+	r.GET("/bind", func(c *Context) {
+		_ = c.Error(&Error{Err: errors.New("name is required"), Type: ErrorTypeBind})
+		c.Abort()
+	})
+	r.GET("/ok", func(c *Context) {
+		_ = c.Error(errors.New("cache miss"))
+		c.String(http.StatusOK, "ok")
+	})
+	r.GET("/written", func(c *Context) {
+		c.String(http.StatusConflict, "conflict")
+		_ = c.Error(&Error{Err: errNoUser, Type: ErrorTypePublic})
+	})
+
+	w := performRequest(r, http.MethodGet, "/mapped")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+	p := decodeProblem(t, w.Body.Bytes())
+	assert.Equal(t, "https://example.com/problems/no-user", p["type"])
+	assert.Equal(t, "No such user", p["title"])
+	assert.Equal(t, "user does not exist", p["detail"])
+	assert.Equal(t, "42", p["user"])
+	assert.Equal(t, w.Header().Get("X-Request-ID"), p["request_id"])
+
+	w = performRequest(r, http.MethodGet, "/explicit")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "Basic", w.Header().Get("WWW-Authenticate"))
+	p = decodeProblem(t, w.Body.Bytes())
+	assert.Equal(t, "Unauthorized", p["title"])
+	assert.Equal(t, ErrInvalidCredentials.Error(), p["detail"])
+
+	w = performRequest(r, http.MethodGet, "/private")
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	p = decodeProblem(t, w.Body.Bytes())
+	assert.Equal(t, "Bad Gateway", p["title"])
+	assert.NotContains(t, w.Body.String(), "10.0.0.1")
+
+	w = performRequest(r, http.MethodGet, "/bind")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "name is required", decodeProblem(t, w.Body.Bytes())["detail"])
+
+	w = performRequest(r, http.MethodGet, "/ok")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ok", w.Body.String())
+
+	w = performRequest(r, http.MethodGet, "/written")
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "conflict", w.Body.String())
+
+	w = performRequest(r, http.MethodGet, "/missing")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "Not Found", decodeProblem(t, w.Body.Bytes())["title"])
+}
+
+func TestErrorHandlerXML(t *testing.T) {
+	r := New()
+	r.Use(ErrorHandler(ErrorHandlerConfig{}))
+	r.GET("/limited", func(c *Context) {
+		_ = c.Error(&Error{Err: ErrRateLimited, Type: ErrorTypePublic})
+		c.Abort()
+	})
+
+	w := performRequestWithHeader(r, http.MethodGet, "/limited", http.Header{"Accept": {"application/json;q=0.5, application/problem+xml"}})
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "application/problem+xml", w.Header().Get("Content-Type"))
+
+	var p Problem
+	require.NoError(t, xml.Unmarshal(w.Body.Bytes(), &p))
+	assert.Equal(t, "urn:ietf:rfc:7807", p.XMLName.Space)
+	assert.Equal(t, http.StatusTooManyRequests, p.Status)
+	assert.Equal(t, ErrRateLimited.Error(), p.Detail)
+
+	w = performRequestWithHeader(r, http.MethodGet, "/limited", http.Header{"Accept": {"text/html, */*;q=0.1"}})
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+}
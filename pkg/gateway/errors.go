@@ -2,7 +2,10 @@ package gateway
 
 import (
 	"fmt"
+	"reflect"
 	"strings"
+
+	"github.com/idproxy/gateway/internal/json"
 )
 
 // ErrorType is an unsigned 64-bit error code as defined in the gin spec.
@@ -32,6 +35,59 @@ type Error struct {
 
 type errorMsgs []*Error
 
+// Error implements the error interface.
+func (msg Error) Error() string {
+	return msg.Err.Error()
+}
+
+// SetType sets the error's type.
+func (msg *Error) SetType(flags ErrorType) *Error {
+	msg.Type = flags
+	return msg
+}
+
+// SetMeta sets the error's meta data.
+func (msg *Error) SetMeta(data any) *Error {
+	msg.Meta = data
+	return msg
+}
+
+// JSON returns the error as a JSON object with the message under "error". The fields of
+// a map or struct Meta are merged into the object, without replacing "error" unless
+// Meta sets it; any other Meta is added under "meta".
+func (msg *Error) JSON() any {
+	data := map[string]any{}
+	if msg.Meta != nil {
+		value := reflect.ValueOf(msg.Meta)
+		for value.Kind() == reflect.Pointer && !value.IsNil() {
+			value = value.Elem()
+		}
+		switch value.Kind() {
+		case reflect.Map:
+			for _, key := range value.MapKeys() {
+				data[fmt.Sprint(key.Interface())] = value.MapIndex(key).Interface()
+			}
+		case reflect.Struct:
+			// Marshal and decode so that the fields are named as the json tags say.
+			if b, err := json.Marshal(msg.Meta); err == nil && json.Unmarshal(b, &data) == nil {
+				break
+			}
+			data["meta"] = msg.Meta
+		default:
+			data["meta"] = msg.Meta
+		}
+	}
+	if _, ok := data["error"]; !ok {
+		data["error"] = msg.Error()
+	}
+	return data
+}
+
+// MarshalJSON implements the json.Marshaller interface.
+func (msg *Error) MarshalJSON() ([]byte, error) {
+	return json.Marshal(msg.JSON())
+}
+
 // IsType judges one error.
 func (r *Error) IsType(flags ErrorType) bool {
 	return (r.Type & flags) > 0
@@ -60,6 +116,55 @@ func (r errorMsgs) ByType(typ ErrorType) errorMsgs {
 	return result
 }
 
+// Last returns the last error in the slice. It returns nil if the array is empty.
+// Shortcut for errors[len(errors)-1].
+func (a errorMsgs) Last() *Error {
+	if length := len(a); length > 0 {
+		return a[length-1]
+	}
+	return nil
+}
+
+// Errors returns an array with all the error messages.
+// Example:
+//
+//	c.Error(errors.New("first"))
+//	c.Error(errors.New("second"))
+//	c.Error(errors.New("third"))
+//	c.Errors.Errors() // == []string{"first", "second", "third"}
+func (a errorMsgs) Errors() []string {
+	if len(a) == 0 {
+		return nil
+	}
+	errorStrings := make([]string, len(a))
+	for i, err := range a {
+		errorStrings[i] = err.Error()
+	}
+	return errorStrings
+}
+
+// JSON returns nil without errors, the JSON object of a single error, or an array of
+// the objects of all errors.
+func (a errorMsgs) JSON() any {
+	switch length := len(a); length {
+	case 0:
+		return nil
+	case 1:
+		return a.Last().JSON()
+	default:
+		jsonData := make([]any, length)
+		for i, err := range a {
+			jsonData[i] = err.JSON()
+		}
+		return jsonData
+	}
+}
+
+// MarshalJSON implements the json.Marshaller interface.
+func (a errorMsgs) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.JSON())
+}
+
 func (a errorMsgs) String() string {
 	if len(a) == 0 {
 		return ""
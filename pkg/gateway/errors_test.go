@@ -0,0 +1,103 @@
+package gateway
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/idproxy/gateway/internal/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errorTypeFlags = []ErrorType{ErrorTypeBind, ErrorTypeRender, ErrorTypePrivate, ErrorTypePublic}
+
+// errorTypeCombinations returns every combination of the error type flags, including
+// none.
+func errorTypeCombinations() []ErrorType {
+	var combinations []ErrorType
+	for mask := 0; mask < 1<<len(errorTypeFlags); mask++ {
+		var typ ErrorType
+		for i, flag := range errorTypeFlags {
+			if mask&(1<<i) != 0 {
+				typ |= flag
+			}
+		}
+		combinations = append(combinations, typ)
+	}
+	return combinations
+}
+
+func TestErrorIsType(t *testing.T) {
+	for _, typ := range errorTypeCombinations() {
+		err := (&Error{Err: errors.New("test")}).SetType(typ)
+		for _, flag := range errorTypeFlags {
+			assert.Equal(t, typ&flag != 0, err.IsType(flag), "type %b flag %b", typ, flag)
+		}
+		assert.Equal(t, typ != 0, err.IsType(ErrorTypeAny), "type %b", typ)
+		assert.Equal(t, typ&(ErrorTypePublic|ErrorTypeBind) != 0, err.IsType(ErrorTypePublic|ErrorTypeBind), "type %b", typ)
+	}
+}
+
+func TestErrorsByType(t *testing.T) {
+	var errs errorMsgs
+	for _, typ := range errorTypeCombinations() {
+		errs = append(errs, &Error{Err: errors.New("test"), Type: typ})
+	}
+	assert.Len(t, errs.ByType(ErrorTypeAny), 16)
+	for _, flag := range errorTypeFlags {
+		filtered := errs.ByType(flag)
+		assert.Len(t, filtered, 8, "flag %b", flag)
+		for _, err := range filtered {
+			assert.True(t, err.IsType(flag))
+		}
+	}
+	assert.Len(t, errs.ByType(ErrorTypePublic|ErrorTypePrivate), 12)
+	assert.Nil(t, errorMsgs(nil).ByType(ErrorTypeAny))
+}
+
+func TestErrorJSON(t *testing.T) {
+	err := &Error{Err: errors.New("test error"), Type: ErrorTypePrivate}
+	assert.Equal(t, map[string]any{"error": "test error"}, err.JSON())
+
+	err.SetMeta("some data")
+	assert.Equal(t, map[string]any{"error": "test error", "meta": "some data"}, err.JSON())
+
+	err.SetMeta(map[string]any{"status": "200", "data": "some data"})
+	assert.Equal(t, map[string]any{"error": "test error", "status": "200", "data": "some data"}, err.JSON())
+
+	err.SetMeta(map[string]any{"error": "custom error", "status": "200"})
+	assert.Equal(t, map[string]any{"error": "custom error", "status": "200"}, err.JSON())
+
+	type meta struct {
+		Limit int    `json:"limit"`
+		Scope string `json:"scope,omitempty"`
+	}
+	err.SetMeta(&meta{Limit: 10})
+	b, jsonErr := json.Marshal(err)
+	require.NoError(t, jsonErr)
+	assert.JSONEq(t, `{"error":"test error","limit":10}`, string(b))
+
+	err.SetMeta([]string{"a", "b"})
+	assert.Equal(t, map[string]any{"error": "test error", "meta": []string{"a", "b"}}, err.JSON())
+}
+
+func TestErrorSlice(t *testing.T) {
+	var errs errorMsgs
+	assert.Nil(t, errs.Last())
+	assert.Nil(t, errs.Errors())
+	assert.Nil(t, errs.JSON())
+
+	errs = errorMsgs{
+		{Err: errors.New("first"), Type: ErrorTypePrivate},
+		{Err: errors.New("second"), Type: ErrorTypePrivate, Meta: "some data"},
+		{Err: errors.New("third"), Type: ErrorTypePublic, Meta: map[string]any{"status": "400"}},
+	}
+	assert.Equal(t, "third", errs.Last().Error())
+	assert.Equal(t, []string{"first", "second", "third"}, errs.Errors())
+	assert.Equal(t, []string{"third"}, errs.ByType(ErrorTypePublic).Errors())
+	assert.Equal(t, map[string]any{"error": "third", "status": "400"}, errs.ByType(ErrorTypePublic).JSON())
+
+	b, err := json.Marshal(errs)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[{"error":"first"},{"error":"second","meta":"some data"},{"error":"third","status":"400"}]`, string(b))
+}
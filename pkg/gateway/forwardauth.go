@@ -0,0 +1,176 @@
+package gateway
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ForwardAuthConfig defines the config for ForwardAuth handler.
+type ForwardAuthConfig struct {
+	// Authenticators are authentication middlewares, e.g. OIDC.Authenticate, evaluated in
+	// order against the forwarded request. The first one that stores a principal without
+	// aborting authenticates the request.
+	Authenticators []HandlerFunc
+
+	// LoginURL is where unauthenticated browser navigations are redirected, with the
+	// original URL in the rd query parameter. nginx auth_request does not pass redirects
+	// through, leave it empty to answer 401 and redirect with error_page instead.
+	// Optional.
+	LoginURL string
+
+	// PathPrefix is stripped from the request path when the original request is not
+	// described by forwarding headers, as with Envoy ext_authz HTTP which appends the
+	// original path to the path of the auth service.
+	// Optional.
+	PathPrefix string
+
+	// UserHeader, EmailHeader and GroupsHeader name the identity response headers.
+	// Optional. Default values are "X-Auth-User", "X-Auth-Email" and "X-Auth-Groups".
+	UserHeader   string
+	EmailHeader  string
+	GroupsHeader string
+}
+
+// ForwardAuth returns a handler serving as external authentication service for ingress
+// controllers: nginx auth_request, Traefik ForwardAuth and Envoy ext_authz HTTP. The
+// original request is reconstructed from X-Original-URL or X-Forwarded-Method,
+// X-Forwarded-Proto, X-Forwarded-Host and X-Forwarded-Uri and the authenticators are
+// evaluated against it. Authenticated requests get 200 with identity headers, others
+// 401 or a 302 to LoginURL.
+func ForwardAuth(conf ForwardAuthConfig) HandlerFunc {
+	assert1(len(conf.Authenticators) > 0, "forward auth: at least one authenticator is required")
+	if conf.UserHeader == "" {
+		conf.UserHeader = "X-Auth-User"
+	}
+	if conf.EmailHeader == "" {
+		conf.EmailHeader = "X-Auth-Email"
+	}
+	if conf.GroupsHeader == "" {
+		conf.GroupsHeader = "X-Auth-Groups"
+	}
+
+	return func(c *Context) {
+		req, err := forwardedRequest(c.Request, conf.PathPrefix)
+		if err != nil {
+			_ = c.AbortWithError(http.StatusBadRequest, &Error{Err: err, Type: ErrorTypePublic})
+			return
+		}
+
+		var challenge string
+		for _, authenticate := range conf.Authenticators {
+			hw := &headerWriter{header: http.Header{}}
+			sub := c.derive(req, hw, HandlersChain{authenticate})
+			sub.Next()
+			if p, ok := sub.Principal(); ok && !sub.IsAborted() {
+				c.SetPrincipal(p)
+				c.Header(conf.UserHeader, p.Subject)
+				c.Header(conf.EmailHeader, p.Email)
+				c.Header(conf.GroupsHeader, strings.Join(p.Groups, ","))
+				c.Status(http.StatusOK)
+				return
+			}
+			if v := hw.header.Get("WWW-Authenticate"); v != "" && challenge == "" {
+				challenge = v
+			}
+			c.Errors = append(c.Errors, sub.Errors...)
+		}
+
+		if conf.LoginURL != "" && (req.Method == http.MethodGet || req.Method == http.MethodHead) {
+			c.Redirect(http.StatusFound, appendQuery(conf.LoginURL, url.Values{"rd": {originalURL(req)}}))
+			c.Abort()
+			return
+		}
+		c.Header("WWW-Authenticate", challenge)
+		c.AbortWithStatus(http.StatusUnauthorized)
+	}
+}
+
+// forwardedRequest reconstructs the request the ingress controller asks about.
+func forwardedRequest(r *http.Request, pathPrefix string) (*http.Request, error) {
+	req := r.Clone(r.Context())
+	if m := firstHeader(r.Header, "X-Forwarded-Method", "X-Original-Method"); m != "" {
+		req.Method = strings.ToUpper(m)
+	}
+
+	switch {
+	case r.Header.Get("X-Original-URL") != "":
+		u, err := url.Parse(r.Header.Get("X-Original-URL"))
+		if err != nil {
+			return nil, err
+		}
+		req.URL = u
+	case r.Header.Get("X-Forwarded-Uri") != "":
+		u, err := url.ParseRequestURI(r.Header.Get("X-Forwarded-Uri"))
+		if err != nil {
+			return nil, err
+		}
+		u.Scheme = r.Header.Get("X-Forwarded-Proto")
+		u.Host = r.Header.Get("X-Forwarded-Host")
+		req.URL = u
+	default:
+		u := *r.URL
+		if pathPrefix != "" {
+			u.Path = "/" + strings.TrimPrefix(strings.TrimPrefix(u.Path, pathPrefix), "/")
+			u.RawPath = ""
+		}
+		u.Host = firstHeader(r.Header, "X-Forwarded-Host")
+		u.Scheme = firstHeader(r.Header, "X-Forwarded-Proto")
+		req.URL = &u
+	}
+	if req.URL.Host != "" {
+		req.Host = req.URL.Host
+	} else {
+		req.URL.Host = r.Host
+	}
+	if req.URL.Scheme == "" {
+		req.URL.Scheme = "http"
+		if r.TLS != nil {
+			req.URL.Scheme = "https"
+		}
+	}
+	req.RequestURI = req.URL.RequestURI()
+	return req, nil
+}
+
+func originalURL(r *http.Request) string {
+	return r.URL.Scheme + "://" + r.URL.Host + r.URL.RequestURI()
+}
+
+func firstHeader(h http.Header, keys ...string) string {
+	for _, k := range keys {
+		if v := h.Get(k); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// derive returns a new Context running handlers against req and w. It shares the
+// gateway but none of the request state of c.
+func (c *Context) derive(req *http.Request, w http.ResponseWriter, handlers HandlersChain) *Context {
+	sub := c.gateway.allocateContext(c.gateway.maxParams)
+	sub.writermem.reset(w)
+	sub.Request = req
+	sub.reset()
+	sub.handlers = handlers
+	return sub
+}
+
+// headerWriter is a ResponseWriter that keeps the headers and discards the body.
+type headerWriter struct {
+	header http.Header
+	status int
+}
+
+func (w *headerWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *headerWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (w *headerWriter) WriteHeader(code int) {
+	w.status = code
+}
@@ -0,0 +1,81 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// tokenAuthenticator authenticates requests to /private carrying the token "secret".
+func tokenAuthenticator(c *Context) {
+	if c.Request.URL.Path != "/private" {
+		c.SetPrincipal(&Principal{Subject: "anonymous"})
+		return
+	}
+	if c.GetHeader("Authorization") != "Bearer secret" {
+		c.Header("WWW-Authenticate", `Bearer realm="test"`)
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	c.SetPrincipal(&Principal{Subject: "alice", Groups: []string{"dev", "ops"}})
+}
+
+func TestForwardAuth(t *testing.T) {
+	r := New()
+	r.Any("/auth/*path", ForwardAuth(ForwardAuthConfig{
+		Authenticators: []HandlerFunc{tokenAuthenticator},
+		LoginURL:       "https://login.example.com/auth/login",
+		PathPrefix:     "/auth",
+	}))
+
+	tests := []struct {
+		name     string
+		path     string
+		headers  map[string]string
+		code     int
+		user     string
+		location string
+	}{
+		{
+			name:    "traefik authenticated",
+			path:    "/auth/",
+			headers: map[string]string{"X-Forwarded-Method": "POST", "X-Forwarded-Uri": "/private", "Authorization": "Bearer secret"},
+			code:    http.StatusOK,
+			user:    "alice",
+		},
+		{
+			name:    "nginx unauthenticated api call",
+			path:    "/auth/",
+			headers: map[string]string{"X-Original-Method": "POST", "X-Original-URL": "https://app.example.com/private"},
+			code:    http.StatusUnauthorized,
+		},
+		{
+			name:     "browser navigation redirected to login",
+			path:     "/auth/",
+			headers:  map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "app.example.com", "X-Forwarded-Uri": "/private?a=b"},
+			code:     http.StatusFound,
+			location: "https://login.example.com/auth/login?rd=https%3A%2F%2Fapp.example.com%2Fprivate%3Fa%3Db",
+		},
+		{
+			name: "envoy public path",
+			path: "/auth/public",
+			code: http.StatusOK,
+			user: "anonymous",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			assert.Equal(t, tt.code, w.Code)
+			assert.Equal(t, tt.user, w.Header().Get("X-Auth-User"))
+			assert.Equal(t, tt.location, w.Header().Get("Location"))
+		})
+	}
+}
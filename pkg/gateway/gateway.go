@@ -8,6 +8,7 @@ import (
 	"sync"
 
 	"github.com/idproxy/gateway/internal/bytesconv"
+	"github.com/idproxy/gateway/pkg/audit"
 	"github.com/idproxy/gateway/pkg/binding"
 	"golang.org/x/net/http2"
 	"golang.org/x/net/http2/h2c"
@@ -54,6 +55,16 @@ type Gateway struct {
 	// See the PR #1817 and issue #1644
 	RemoveExtraSlash bool
 
+	// MaxBodyBytes limits the size of request bodies for all routes. Requests declaring a
+	// larger Content-Length are rejected before the chain runs, reading past it fails with
+	// ErrBodyTooLarge; both respond with a 413 problem. Groups can set their own limit
+	// with BodyLimit. The default value 0 means no limit.
+	MaxBodyBytes int64
+
+	// AuditLog receives the events recorded with Context.Audit by handlers and by the
+	// authentication and authorization middlewares. Nil disables auditing.
+	AuditLog *audit.Logger
+
 	// UseH2C enable h2c support.
 	useH2C bool
 
@@ -65,6 +76,12 @@ type Gateway struct {
 	trees       methodTrees
 	maxParams   uint16
 	maxSections uint16
+
+	routePolicies []RoutePolicy
+	// unloggedPaths are the paths of probe routes, skipped by the access log in addition
+	// to LoggerConfig.SkipPaths.
+	unloggedPaths map[string]bool
+	poolStats     poolStats
 }
 
 func New() *Gateway {
@@ -80,6 +97,7 @@ func New() *Gateway {
 	}
 	r.RouterGroup.gateway = r
 	r.pool.New = func() any {
+		r.poolStats.allocated.Add(1)
 		return r.allocateContext(r.maxParams)
 	}
 	return r
@@ -133,15 +151,15 @@ func (r *Gateway) Run(addr ...string) (err error) {
 
 // ServeHTTP conforms to the http.Handler interface.
 func (r *Gateway) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	gctx := r.pool.Get().(*Context)
+	gctx := r.acquireContext()
+	// deferred so that a panic escaping the chain, e.g. http.ErrAbortHandler re-panicked
+	// by Recovery, does not leak the Context from PoolStats
+	defer r.releaseContext(gctx)
 	gctx.writermem.reset(w)
 	gctx.Request = req
-	fmt.Printf("Params: %v\n", gctx.Params)
 	gctx.reset()
 
 	r.handleHTTPRequest(gctx)
-
-	r.pool.Put(gctx)
 }
 
 func (r *Gateway) handleHTTPRequest(gctx *Context) {
@@ -156,7 +174,6 @@ func (r *Gateway) handleHTTPRequest(gctx *Context) {
 	if r.RemoveExtraSlash {
 		rPath = cleanPath(rPath)
 	}
-	fmt.Println(rPath)
 
 	// Find root of the tree for the given HTTP method
 	t := r.trees
@@ -171,14 +188,21 @@ func (r *Gateway) handleHTTPRequest(gctx *Context) {
 		if value.params != nil {
 			gctx.Params = *value.params
 		}
-		fmt.Printf("value: %v\n", value)
-		if value.params != nil {
-			fmt.Printf("value params: %v\n", value.params)
-		}
 		if value.handlers != nil {
 			gctx.handlers = value.handlers
 			gctx.fullPath = value.fullPath
+			if r.MaxBodyBytes > 0 {
+				if declaredBodyTooLarge(gctx, r.MaxBodyBytes) {
+					abortBodyTooLarge(gctx, r.MaxBodyBytes)
+					gctx.writermem.WriteHeaderNow()
+					return
+				}
+				limitBody(gctx, r.MaxBodyBytes)
+			}
 			gctx.Next()
+			if r.MaxBodyBytes > 0 {
+				checkBodyLimit(gctx)
+			}
 			gctx.writermem.WriteHeaderNow()
 			return
 		}
@@ -212,9 +236,7 @@ func (r *Gateway) addRoute(method, path string, handlers HandlersChain) {
 	assert1(len(handlers) > 0, "there must be at least one handler")
 
 	debugPrintRoute(method, path, handlers)
-	fmt.Println(method, path)
 	root := r.trees.get(method)
-	fmt.Printf("root: %#v, method: %s, path: %s", root, method, path)
 	if root == nil {
 		root = new(node)
 		root.fullPath = "/"
@@ -0,0 +1,325 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrDraining is reported by the readiness probe once Health.Drain was called.
+var ErrDraining = errors.New("health: draining")
+
+// HealthCheckFunc checks a dependency and returns an error if it is unhealthy. It must
+// return when ctx is done.
+type HealthCheckFunc func(ctx context.Context) error
+
+// HealthCheck is a named check registered with Health.
+type HealthCheck struct {
+	// Name identifies the check in the output of the probes.
+	Name string
+
+	// Check is the check to run.
+	Check HealthCheckFunc
+
+	// Timeout bounds one run of the check, which fails when it is exceeded.
+	// Optional. Default value is HealthConfig.Timeout.
+	Timeout time.Duration
+
+	// CacheTTL is how long the result of a run is reused, so that frequent probes do not
+	// load the dependency.
+	// Optional. Default value is HealthConfig.CacheTTL.
+	CacheTTL time.Duration
+
+	// Liveness makes the liveness probe run the check too. Only checks whose failure
+	// requires restarting the process should set it, failing dependencies should only
+	// make the instance unready.
+	// Optional. Default value is false.
+	Liveness bool
+}
+
+// HealthConfig defines the config for Health.
+type HealthConfig struct {
+	// Timeout is the default timeout of checks.
+	// Optional. Default value is 2 seconds.
+	Timeout time.Duration
+
+	// CacheTTL is the default time results of checks are reused.
+	// Optional. Default value is 1 second.
+	CacheTTL time.Duration
+
+	// DrainDelay is how long Shutdown keeps serving after readiness started failing,
+	// so that load balancers stop sending traffic first.
+	// Optional. Default value is 5 seconds.
+	DrainDelay time.Duration
+}
+
+// CheckResult is the result of one check in the output of the probes.
+type CheckResult struct {
+	Status   string  `json:"status"`
+	Error    string  `json:"error,omitempty"`
+	Duration float64 `json:"duration_ms"`
+	Cached   bool    `json:"cached,omitempty"`
+}
+
+// HealthReport is the output of the probes.
+type HealthReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+type healthCheck struct {
+	HealthCheck
+
+	mu      sync.Mutex
+	checked time.Time
+	result  CheckResult
+}
+
+// Health serves the /healthz, /readyz and /livez probes from a registry of checks:
+//
+//   - /livez runs the checks marked Liveness,
+//   - /readyz runs every check and fails while draining,
+//   - /healthz runs every check.
+//
+// Probes respond with 200 or 503 and a HealthReport.
+type Health struct {
+	config   HealthConfig
+	mu       sync.RWMutex
+	checks   []*healthCheck
+	draining atomic.Bool
+}
+
+// NewHealth returns a Health without checks.
+func NewHealth(conf HealthConfig) *Health {
+	if conf.Timeout <= 0 {
+		conf.Timeout = 2 * time.Second
+	}
+	if conf.CacheTTL <= 0 {
+		conf.CacheTTL = time.Second
+	}
+	if conf.DrainDelay <= 0 {
+		conf.DrainDelay = 5 * time.Second
+	}
+	return &Health{config: conf}
+}
+
+// AddCheck registers a check. It panics if a check with the same name exists.
+func (h *Health) AddCheck(check HealthCheck) {
+	assert1(check.Name != "", "health check must have a name")
+	assert1(check.Check != nil, "health check "+check.Name+" has no check func")
+	if check.Timeout <= 0 {
+		check.Timeout = h.config.Timeout
+	}
+	if check.CacheTTL <= 0 {
+		check.CacheTTL = h.config.CacheTTL
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, c := range h.checks {
+		assert1(c.Name != check.Name, "health check "+check.Name+" is already registered")
+	}
+	h.checks = append(h.checks, &healthCheck{HealthCheck: check})
+}
+
+// Register adds the GET and HEAD routes of the probes to group and excludes them from
+// access logs, whatever LoggerConfig.SkipPaths is set to.
+func (h *Health) Register(group *RouterGroup) {
+	probes := map[string]HandlerFunc{
+		"/healthz": h.Healthz,
+		"/readyz":  h.Readyz,
+		"/livez":   h.Livez,
+	}
+	r := group.gateway
+	for path, handler := range probes {
+		group.GET(path, handler)
+		group.HEAD(path, handler)
+		if r.unloggedPaths == nil {
+			r.unloggedPaths = make(map[string]bool)
+		}
+		r.unloggedPaths[group.calculateAbsolutePath(path)] = true
+	}
+}
+
+// Healthz is the handler of the health probe.
+func (h *Health) Healthz(c *Context) {
+	h.serve(c, false, false)
+}
+
+// Readyz is the handler of the readiness probe.
+func (h *Health) Readyz(c *Context) {
+	h.serve(c, false, true)
+}
+
+// Livez is the handler of the liveness probe.
+func (h *Health) Livez(c *Context) {
+	h.serve(c, true, false)
+}
+
+func (h *Health) serve(c *Context, liveness, readiness bool) {
+	report := h.Check(c.Request.Context(), liveness)
+	if readiness && h.Draining() {
+		report.Status = "fail"
+		if report.Checks == nil {
+			report.Checks = map[string]CheckResult{}
+		}
+		report.Checks["drain"] = CheckResult{Status: "fail", Error: ErrDraining.Error()}
+	}
+	c.Header("Cache-Control", "no-store")
+	code := http.StatusOK
+	if report.Status != "ok" {
+		code = http.StatusServiceUnavailable
+	}
+	c.JSON(code, report)
+}
+
+// Check runs the checks concurrently, only those marked Liveness if liveness is true,
+// and aggregates their results.
+func (h *Health) Check(ctx context.Context, liveness bool) HealthReport {
+	h.mu.RLock()
+	checks := make([]*healthCheck, 0, len(h.checks))
+	for _, c := range h.checks {
+		if !liveness || c.Liveness {
+			checks = append(checks, c)
+		}
+	}
+	h.mu.RUnlock()
+
+	report := HealthReport{Status: "ok"}
+	if len(checks) == 0 {
+		return report
+	}
+	results := make([]CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c *healthCheck) {
+			defer wg.Done()
+			results[i] = c.run(ctx)
+		}(i, c)
+	}
+	wg.Wait()
+
+	report.Checks = make(map[string]CheckResult, len(checks))
+	for i, c := range checks {
+		report.Checks[c.Name] = results[i]
+		if results[i].Status != "ok" {
+			report.Status = "fail"
+		}
+	}
+	return report
+}
+
+// run returns the cached result or runs the check. Concurrent probes wait for the same
+// run.
+func (c *healthCheck) run(ctx context.Context) CheckResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.checked.IsZero() && time.Since(c.checked) < c.CacheTTL {
+		result := c.result
+		result.Cached = true
+		return result
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				done <- fmt.Errorf("panic: %v", err)
+			}
+		}()
+		done <- c.Check(ctx)
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	result := CheckResult{Status: "ok", Duration: float64(time.Since(start).Microseconds()) / 1000}
+	if err != nil {
+		result.Status, result.Error = "fail", err.Error()
+	}
+	// Results of probes canceled by the client are not cached.
+	if !errors.Is(err, context.Canceled) {
+		c.checked, c.result = time.Now(), result
+	}
+	return result
+}
+
+// Drain makes the readiness probe fail, e.g. when the process received SIGTERM.
+func (h *Health) Drain() {
+	h.draining.Store(true)
+}
+
+// Draining returns true after Drain was called.
+func (h *Health) Draining() bool {
+	return h.draining.Load()
+}
+
+// Shutdown gracefully stops srv: it drains, keeps serving for DrainDelay so that load
+// balancers see the instance unready, then calls srv.Shutdown.
+func (h *Health) Shutdown(ctx context.Context, srv *http.Server) error {
+	h.Drain()
+	t := time.NewTimer(h.config.DrainDelay)
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+		t.Stop()
+	}
+	return srv.Shutdown(ctx)
+}
+
+// Checks returns the names of the registered checks, sorted.
+func (h *Health) Checks() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	names := make([]string, len(h.checks))
+	for i, c := range h.checks {
+		names[i] = c.Name
+	}
+	sort.Strings(names)
+	return names
+}
+
+// HTTPCheck returns a check that fails unless a GET of url responds with a status
+// below 500, e.g. to check that an upstream is reachable. client may be nil.
+func HTTPCheck(client *http.Client, url string) HealthCheckFunc {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("%s responded with %d", url, resp.StatusCode)
+		}
+		return nil
+	}
+}
+
+// SessionStoreCheck returns a check that fails if store cannot look up a session.
+func SessionStoreCheck(store SessionStore) HealthCheckFunc {
+	return func(ctx context.Context) error {
+		_, err := store.Get(ctx, "healthcheck")
+		if err != nil && !errors.Is(err, ErrSessionNotFound) {
+			return err
+		}
+		return nil
+	}
+}
@@ -0,0 +1,104 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/idproxy/gateway/internal/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decodeHealthReport(t *testing.T, body []byte) HealthReport {
+	var report HealthReport
+	require.NoError(t, json.Unmarshal(body, &report), string(body))
+	return report
+}
+
+func TestHealthProbes(t *testing.T) {
+	var upstreamDown atomic.Bool
+	upstreamDown.Store(true)
+	var runs atomic.Int32
+
+	h := NewHealth(HealthConfig{CacheTTL: time.Hour})
+	h.AddCheck(HealthCheck{Name: "upstream", Check: func(ctx context.Context) error {
+		runs.Add(1)
+		if upstreamDown.Load() {
+			return errors.New("connection refused")
+		}
+		return nil
+	}, CacheTTL: time.Nanosecond})
+	h.AddCheck(HealthCheck{Name: "sessions", Check: SessionStoreCheck(NewMemorySessionStore())})
+	h.AddCheck(HealthCheck{Name: "slow", Timeout: 10 * time.Millisecond, Liveness: true, Check: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}})
+	assert.Panics(t, func() { h.AddCheck(HealthCheck{Name: "slow", Check: func(context.Context) error { return nil }}) })
+	assert.Equal(t, []string{"sessions", "slow", "upstream"}, h.Checks())
+
+	var out bytes.Buffer
+	r := New()
+	r.Use(LoggerWithConfig(LoggerConfig{Output: &out}))
+	h.Register(&r.RouterGroup)
+	r.GET("/", func(c *Context) {})
+
+	w := performRequest(r, http.MethodGet, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	report := decodeHealthReport(t, w.Body.Bytes())
+	assert.Equal(t, "fail", report.Status)
+	assert.Equal(t, "connection refused", report.Checks["upstream"].Error)
+	assert.Equal(t, "ok", report.Checks["sessions"].Status)
+	assert.Equal(t, context.DeadlineExceeded.Error(), report.Checks["slow"].Error)
+
+	w = performRequest(r, http.MethodGet, "/livez")
+	report = decodeHealthReport(t, w.Body.Bytes())
+	assert.Len(t, report.Checks, 1)
+	assert.True(t, report.Checks["slow"].Cached)
+
+	upstreamDown.Store(false)
+	w = performRequest(r, http.MethodGet, "/healthz")
+	report = decodeHealthReport(t, w.Body.Bytes())
+	assert.Equal(t, "ok", report.Checks["upstream"].Status)
+	assert.Equal(t, int32(2), runs.Load())
+
+	h2 := NewHealth(HealthConfig{})
+	h2.AddCheck(HealthCheck{Name: "ok", Check: func(context.Context) error { return nil }})
+	r2 := New()
+	h2.Register(r2.Group("/probe"))
+	w = performRequest(r2, http.MethodGet, "/probe/readyz")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ok", decodeHealthReport(t, w.Body.Bytes()).Status)
+
+	h2.Drain()
+	w = performRequest(r2, http.MethodGet, "/probe/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, ErrDraining.Error(), decodeHealthReport(t, w.Body.Bytes()).Checks["drain"].Error)
+	assert.Equal(t, http.StatusOK, performRequest(r2, http.MethodGet, "/probe/livez").Code)
+	assert.Equal(t, http.StatusOK, performRequest(r2, http.MethodGet, "/probe/healthz").Code)
+
+	// Probes are not logged, other routes are.
+	assert.Zero(t, out.Len())
+	performRequest(r, http.MethodGet, "/")
+	assert.NotZero(t, out.Len())
+}
+
+func TestHealthProbesNotLoggedWithSkipPaths(t *testing.T) {
+	var out bytes.Buffer
+	r := New()
+	r.Use(LoggerWithConfig(LoggerConfig{Output: &out, SkipPaths: []string{"/metrics"}}))
+	NewHealth(HealthConfig{}).Register(r.Group("/probe"))
+	r.GET("/metrics", func(c *Context) {})
+	r.GET("/", func(c *Context) {})
+
+	for _, path := range []string{"/probe/healthz", "/probe/readyz", "/probe/livez", "/metrics"} {
+		assert.Equal(t, http.StatusOK, performRequest(r, http.MethodGet, path).Code, path)
+	}
+	assert.Zero(t, out.Len())
+	performRequest(r, http.MethodGet, "/")
+	assert.NotZero(t, out.Len())
+}
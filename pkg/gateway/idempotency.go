@@ -0,0 +1,313 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrIdempotencyInFlight is recorded when a request reuses the key of a request
+	// that is still being handled.
+	ErrIdempotencyInFlight = errors.New("idempotency: request with this key is in progress")
+	// ErrIdempotencyMismatch is recorded when a request reuses a key with a different
+	// method, path or body.
+	ErrIdempotencyMismatch = errors.New("idempotency: key reused for a different request")
+	// ErrIdempotencyKey is recorded when an idempotency key is too long.
+	ErrIdempotencyKey = errors.New("idempotency: invalid key")
+)
+
+// IdempotentResponse is a response stored for replay.
+type IdempotentResponse struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+// IdempotencyRecord is the state of an idempotency key.
+type IdempotencyRecord struct {
+	// Fingerprint identifies the request that reserved the key.
+	Fingerprint string `json:"fingerprint"`
+	// Response is nil while the request is in flight.
+	Response *IdempotentResponse `json:"response,omitempty"`
+}
+
+// IdempotencyStore keeps idempotency records. Implementations must be safe for
+// concurrent use and make Reserve atomic, so that only one request owns a key.
+type IdempotencyStore interface {
+	// Reserve creates an in-flight record for the key and returns true, or returns the
+	// existing record and false.
+	Reserve(ctx context.Context, key, fingerprint string, ttl time.Duration) (*IdempotencyRecord, bool, error)
+	// Complete stores the response of a reserved key.
+	Complete(ctx context.Context, key string, resp *IdempotentResponse, ttl time.Duration) error
+	// Release deletes the record of a reserved key, so the request can be retried.
+	Release(ctx context.Context, key string) error
+}
+
+// IdempotencyConfig defines the config for Idempotency middleware.
+type IdempotencyConfig struct {
+	// Header is the request header carrying the key.
+	// Optional. Default value is "Idempotency-Key".
+	Header string
+
+	// Methods are the methods keys are honored for.
+	// Optional. Default value is POST and PATCH.
+	Methods []string
+
+	// Store keeps the records.
+	// Optional. Default value is a new in-memory store.
+	Store IdempotencyStore
+
+	// TTL is how long a key is remembered.
+	// Optional. Default value is 24 hours.
+	TTL time.Duration
+
+	// ScopeFunc scopes keys, so that clients can not replay the responses of each other.
+	// Keys of requests with an empty scope are ignored.
+	// Optional. Default value scopes keys by the authenticated principal or else by the
+	// credential headers, Authorization, Cookie and X-API-Key, and ignores the keys of
+	// anonymous requests, which can not be told apart.
+	ScopeFunc func(c *Context) string
+
+	// MaxBodyBytes is the largest request body fingerprinted, requests with larger bodies
+	// are handled without idempotency.
+	// Optional. Default value is 1 MiB.
+	MaxBodyBytes int64
+}
+
+const maxIdempotencyKeyLength = 255
+
+// Idempotency returns a middleware making retries of unsafe requests carrying an
+// Idempotency-Key safe. The first request reserves the key and its response is stored
+// and replayed, with an Idempotent-Replayed header, to later requests with the same key
+// and the same method, path and body. A retry arriving while the first request is still
+// handled is aborted with 409, a request reusing the key for a different payload with
+// 422. Server errors, 408 and 429 are not stored, so the request can be retried.
+//
+// Install it after authentication, so that the default ScopeFunc sees the principal.
+// Only the headers written by the handlers are stored, headers already set on a replayed
+// response, e.g. by RequestID or RateLimit, are kept.
+func Idempotency(conf IdempotencyConfig) HandlerFunc {
+	if conf.Header == "" {
+		conf.Header = "Idempotency-Key"
+	}
+	if len(conf.Methods) == 0 {
+		conf.Methods = []string{http.MethodPost, http.MethodPatch}
+	}
+	if conf.Store == nil {
+		conf.Store = NewMemoryIdempotencyStore()
+	}
+	if conf.TTL <= 0 {
+		conf.TTL = 24 * time.Hour
+	}
+	if conf.ScopeFunc == nil {
+		conf.ScopeFunc = defaultIdempotencyScope
+	}
+	if conf.MaxBodyBytes <= 0 {
+		conf.MaxBodyBytes = 1 << 20
+	}
+
+	return func(c *Context) {
+		key := c.GetHeader(conf.Header)
+		if key == "" || !contains(conf.Methods, c.Request.Method) {
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			_ = c.AbortWithError(http.StatusBadRequest, &Error{Err: ErrIdempotencyKey, Type: ErrorTypePublic})
+			return
+		}
+		scope := conf.ScopeFunc(c)
+		if scope == "" {
+			return
+		}
+		fingerprint, ok := requestFingerprint(c, conf.MaxBodyBytes)
+		if !ok {
+			return
+		}
+		key = scope + "|" + key
+		ctx := c.Request.Context()
+
+		record, reserved, err := conf.Store.Reserve(ctx, key, fingerprint, conf.TTL)
+		if err != nil {
+			// fail open, an unavailable store must not take the gateway down
+			_ = c.Error(err)
+			return
+		}
+		if !reserved {
+			switch {
+			case record.Fingerprint != fingerprint:
+				_ = c.AbortWithError(http.StatusUnprocessableEntity, &Error{Err: ErrIdempotencyMismatch, Type: ErrorTypePublic})
+			case record.Response == nil:
+				c.Header("Retry-After", "1")
+				_ = c.AbortWithError(http.StatusConflict, &Error{Err: ErrIdempotencyInFlight, Type: ErrorTypePublic})
+			default:
+				replayResponse(c, record.Response)
+			}
+			return
+		}
+
+		completed := false
+		defer func() {
+			if !completed {
+				if err := conf.Store.Release(context.Background(), key); err != nil {
+					_ = c.Error(err)
+				}
+			}
+		}()
+
+		before := c.Writer.Header().Clone()
+		rb := newResponseBuffer(c.Writer, 0)
+		c.Writer = rb
+		defer func() {
+			c.Writer = rb.ResponseWriter
+		}()
+		c.Next()
+
+		if status := rb.Status(); !rb.streaming && status < http.StatusInternalServerError &&
+			status != http.StatusRequestTimeout && status != http.StatusTooManyRequests {
+			resp := &IdempotentResponse{Status: status, Header: writtenHeader(before, rb.Header()), Body: append([]byte(nil), rb.buf.Bytes()...)}
+			if err := conf.Store.Complete(context.Background(), key, resp, conf.TTL); err != nil {
+				_ = c.Error(err)
+			} else {
+				completed = true
+			}
+		}
+		if err := rb.stream(); err != nil {
+			_ = c.Error(err)
+		}
+	}
+}
+
+// defaultIdempotencyScope scopes keys by the principal of the request or else by a hash
+// of its credential headers.
+func defaultIdempotencyScope(c *Context) string {
+	if p, ok := c.Principal(); ok {
+		return "principal|" + p.Issuer + "|" + p.Subject
+	}
+	h := sha256.New()
+	found := false
+	for _, name := range credentialHeaders {
+		for _, v := range c.Request.Header.Values(name) {
+			_, _ = io.WriteString(h, name+": "+v+"\n")
+			found = true
+		}
+	}
+	if !found {
+		return ""
+	}
+	return "credentials|" + hex.EncodeToString(h.Sum(nil))
+}
+
+// requestFingerprint hashes the method, path and body of a request. The body is read
+// and replaced, false is returned when it is over limit.
+func requestFingerprint(c *Context, limit int64) (string, bool) {
+	h := sha256.New()
+	_, _ = io.WriteString(h, c.Request.Method+" "+c.Request.URL.RequestURI()+"\n")
+	if c.Request.Body != nil && c.Request.Body != http.NoBody {
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, limit+1))
+		c.Request.Body = &replayBody{
+			Reader: io.MultiReader(bytes.NewReader(body), c.Request.Body),
+			src:    c.Request.Body,
+		}
+		if err != nil || int64(len(body)) > limit {
+			return "", false
+		}
+		h.Write(body)
+	}
+	return hex.EncodeToString(h.Sum(nil)), true
+}
+
+// replayBody is a request body of which the start was read ahead.
+type replayBody struct {
+	io.Reader
+	src io.ReadCloser
+}
+
+func (b *replayBody) Close() error {
+	return b.src.Close()
+}
+
+func (b *replayBody) limitExceeded() (int64, bool) {
+	if src, ok := b.src.(bodyLimiter); ok {
+		return src.limitExceeded()
+	}
+	return 0, false
+}
+
+func replayResponse(c *Context, resp *IdempotentResponse) {
+	h := c.Writer.Header()
+	replayHeader(h, resp.Header)
+	h.Set("Idempotent-Replayed", "true")
+	c.Abort()
+	c.Status(resp.Status)
+	if _, err := c.Writer.Write(resp.Body); err != nil {
+		_ = c.Error(err)
+	}
+}
+
+type idempotencyEntry struct {
+	record  IdempotencyRecord
+	expires time.Time
+}
+
+// MemoryIdempotencyStore is an IdempotencyStore keeping records in process memory.
+// Expired records are removed lazily.
+type MemoryIdempotencyStore struct {
+	mu      sync.Mutex
+	entries map[string]*idempotencyEntry
+	writes  int
+}
+
+var _ IdempotencyStore = (*MemoryIdempotencyStore)(nil)
+
+// NewMemoryIdempotencyStore returns an empty in-memory idempotency store.
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{entries: make(map[string]*idempotencyEntry)}
+}
+
+// Reserve implements IdempotencyStore.
+func (s *MemoryIdempotencyStore) Reserve(_ context.Context, key, fingerprint string, ttl time.Duration) (*IdempotencyRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if e, ok := s.entries[key]; ok && now.Before(e.expires) {
+		record := e.record
+		return &record, false, nil
+	}
+	if s.writes++; s.writes%1024 == 0 {
+		for k, e := range s.entries {
+			if !now.Before(e.expires) {
+				delete(s.entries, k)
+			}
+		}
+	}
+	s.entries[key] = &idempotencyEntry{record: IdempotencyRecord{Fingerprint: fingerprint}, expires: now.Add(ttl)}
+	return nil, true, nil
+}
+
+// Complete implements IdempotencyStore.
+func (s *MemoryIdempotencyStore) Complete(_ context.Context, key string, resp *IdempotentResponse, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok {
+		return errors.New("idempotency: key is not reserved")
+	}
+	e.record.Response = resp
+	e.expires = time.Now().Add(ttl)
+	return nil
+}
+
+// Release implements IdempotencyStore.
+func (s *MemoryIdempotencyStore) Release(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
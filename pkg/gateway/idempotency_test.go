@@ -0,0 +1,99 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotency(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	r := New()
+	r.Use(RequestID(RequestIDConfig{}), Idempotency(IdempotencyConfig{}))
+	r.POST("/tokens", func(c *Context) {
+		n := atomic.AddInt32(&calls, 1)
+		if c.Query("wait") != "" {
+			<-release
+		}
+		c.SetCookie("sid", "abc", 0, "/", "", false, true)
+		c.JSON(http.StatusCreated, map[string]int32{"token": n})
+	})
+	r.POST("/flaky", func(c *Context) {
+		atomic.AddInt32(&calls, 1)
+		c.Status(http.StatusServiceUnavailable)
+	})
+
+	post := func(path, key, body string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		auth := "Bearer alice"
+		if len(header) > 0 {
+			auth = header[0]
+		}
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post("/tokens", "k1", `{"user":"alice"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.JSONEq(t, `{"token":1}`, w.Body.String())
+	assert.Empty(t, w.Header().Get("Idempotent-Replayed"))
+	firstID := w.Header().Get("X-Request-ID")
+
+	w = post("/tokens", "k1", `{"user":"alice"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.JSONEq(t, `{"token":1}`, w.Body.String())
+	assert.Equal(t, "true", w.Header().Get("Idempotent-Replayed"))
+	assert.Contains(t, w.Header().Get("Set-Cookie"), "sid=abc")
+	assert.NotEqual(t, firstID, w.Header().Get("X-Request-ID"))
+	assert.Len(t, w.Header().Values("X-Request-ID"), 1)
+	assert.EqualValues(t, 1, atomic.LoadInt32(&calls))
+
+	w = post("/tokens", "k1", `{"user":"bob"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	// other clients reusing the key do not get the response replayed
+	w = post("/tokens", "k1", `{"user":"alice"}`, "Bearer mallory")
+	assert.JSONEq(t, `{"token":2}`, w.Body.String())
+	assert.Empty(t, w.Header().Get("Idempotent-Replayed"))
+	w = post("/tokens", "k1", `{"user":"alice"}`, "")
+	assert.JSONEq(t, `{"token":3}`, w.Body.String())
+	w = post("/tokens", "k1", `{"user":"alice"}`, "")
+	assert.JSONEq(t, `{"token":4}`, w.Body.String())
+	assert.Empty(t, w.Header().Get("Idempotent-Replayed"))
+
+	w = post("/tokens", "", `{"user":"alice"}`)
+	assert.JSONEq(t, `{"token":5}`, w.Body.String())
+
+	// server errors are not stored
+	post("/flaky", "k2", "")
+	post("/flaky", "k2", "")
+	assert.EqualValues(t, 7, atomic.LoadInt32(&calls))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w := post("/tokens?wait=1", "k3", "")
+		assert.Equal(t, http.StatusCreated, w.Code)
+	}()
+	// wait for the first request to reserve the key
+	for atomic.LoadInt32(&calls) < 8 {
+		time.Sleep(time.Millisecond)
+	}
+	w = post("/tokens?wait=1", "k3", "")
+	assert.Equal(t, http.StatusConflict, w.Code)
+	close(release)
+	<-done
+}
@@ -0,0 +1,178 @@
+package gateway
+
+import (
+	"net/http"
+	"net/textproto"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/idproxy/gateway/internal/jwt"
+)
+
+// StripHeaders returns a middleware that removes the given headers from the inbound
+// request so clients can not spoof identity headers set by the gateway. A name ending
+// in "*" removes every header with that prefix, e.g. "X-Auth-*".
+func StripHeaders(names ...string) HandlerFunc {
+	var exact, prefixes []string
+	for _, name := range names {
+		if strings.HasSuffix(name, "*") {
+			prefixes = append(prefixes, textproto.CanonicalMIMEHeaderKey(strings.TrimSuffix(name, "*")))
+			continue
+		}
+		exact = append(exact, textproto.CanonicalMIMEHeaderKey(name))
+	}
+
+	return func(c *Context) {
+		stripHeaders(c.Request.Header, exact, prefixes)
+	}
+}
+
+// stripHeaders removes the exact names and the names with one of the prefixes from h.
+// Names are compared in canonical form with underscores read as dashes, so keys added
+// to the map without canonicalization and "X_Auth_User" style names, which some
+// upstreams treat like dashes, are removed too.
+func stripHeaders(h http.Header, exact, prefixes []string) {
+	for _, name := range exact {
+		delete(h, name)
+	}
+	for name := range h {
+		key := textproto.CanonicalMIMEHeaderKey(strings.ReplaceAll(name, "_", "-"))
+		if contains(exact, key) {
+			delete(h, name)
+			continue
+		}
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(key, prefix) {
+				delete(h, name)
+				break
+			}
+		}
+	}
+}
+
+// IdentityHeadersConfig defines the config for IdentityHeaders middleware.
+type IdentityHeadersConfig struct {
+	// Headers maps request header names to text/template templates rendered with the
+	// principal, e.g. {"X-Auth-User": "{{.Principal.Subject}}",
+	// "X-Auth-Groups": `{{join .Principal.Groups ","}}`}. Templates can also read
+	// {{index .Keys "key"}}. Headers rendering to an empty string are not set.
+	Headers map[string]string
+
+	// AssertionHeader is the name of a header carrying a signed JWT describing the
+	// principal, so upstreams can verify the identity was asserted by the gateway.
+	// Optional. No assertion is sent when empty.
+	AssertionHeader string
+	// SigningMethod is the JWS algorithm of the assertion, e.g. "RS256", "ES256" or "HS256".
+	SigningMethod string
+	// SigningKey is the *rsa.PrivateKey, *ecdsa.PrivateKey or []byte secret matching SigningMethod.
+	SigningKey any
+	// KeyID is set as the kid header of the assertion.
+	KeyID string
+	// Issuer and Audience are set as the iss and aud claims of the assertion.
+	Issuer   string
+	Audience string
+	// AssertionTTL is the lifetime of the assertion.
+	// Optional. Default value is one minute.
+	AssertionTTL time.Duration
+}
+
+// identityTemplateData is the data identity header templates are rendered with.
+type identityTemplateData struct {
+	Principal *Principal
+	Keys      map[string]any
+}
+
+var identityTemplateFuncs = template.FuncMap{
+	"join": strings.Join,
+}
+
+// IdentityHeaders returns a middleware, to be installed after the authentication
+// middlewares, that passes the authenticated principal upstream as request headers.
+// The configured headers are always removed from the inbound request first, so a
+// request without principal reaches the upstream without any identity headers.
+func IdentityHeaders(conf IdentityHeadersConfig) HandlerFunc {
+	templates := make(map[string]*template.Template, len(conf.Headers))
+	exact := make([]string, 0, len(conf.Headers)+1)
+	for name, text := range conf.Headers {
+		name = textproto.CanonicalMIMEHeaderKey(name)
+		templates[name] = template.Must(template.New(name).Option("missingkey=zero").Funcs(identityTemplateFuncs).Parse(text))
+		exact = append(exact, name)
+	}
+	if conf.AssertionHeader != "" {
+		assert1(conf.SigningMethod != "" && conf.SigningKey != nil, "identity headers: assertion requires SigningMethod and SigningKey")
+		exact = append(exact, textproto.CanonicalMIMEHeaderKey(conf.AssertionHeader))
+	}
+	if conf.AssertionTTL <= 0 {
+		conf.AssertionTTL = time.Minute
+	}
+
+	return func(c *Context) {
+		h := c.Request.Header
+		stripHeaders(h, exact, nil)
+
+		p, ok := c.Principal()
+		if !ok {
+			return
+		}
+		c.mu.RLock()
+		data := identityTemplateData{Principal: p, Keys: c.Keys}
+		var buf strings.Builder
+		for name, tmpl := range templates {
+			buf.Reset()
+			if err := tmpl.Execute(&buf, data); err != nil {
+				_ = c.Error(err)
+				continue
+			}
+			if v := buf.String(); v != "" {
+				h.Set(name, v)
+			}
+		}
+		c.mu.RUnlock()
+
+		if conf.AssertionHeader != "" {
+			assertion, err := signAssertion(&conf, p)
+			if err != nil {
+				_ = c.Error(err)
+				return
+			}
+			h.Set(conf.AssertionHeader, assertion)
+		}
+	}
+}
+
+func signAssertion(conf *IdentityHeadersConfig, p *Principal) (string, error) {
+	now := time.Now()
+	claims := map[string]any{
+		"sub": p.Subject,
+		"iat": now.Unix(),
+		"nbf": now.Unix(),
+		"exp": now.Add(conf.AssertionTTL).Unix(),
+		"jti": randomString(16),
+	}
+	if conf.Issuer != "" {
+		claims["iss"] = conf.Issuer
+	}
+	if conf.Audience != "" {
+		claims["aud"] = conf.Audience
+	}
+	if p.Name != "" {
+		claims["name"] = p.Name
+	}
+	if p.Email != "" {
+		claims["email"] = p.Email
+	}
+	if len(p.Groups) > 0 {
+		claims["groups"] = p.Groups
+	}
+	if len(p.Roles) > 0 {
+		claims["roles"] = p.Roles
+	}
+	if len(p.Scopes) > 0 {
+		claims["scope"] = strings.Join(p.Scopes, " ")
+	}
+	if p.Method != "" {
+		claims["amr"] = []string{p.Method}
+	}
+	return jwt.Sign(conf.SigningMethod, conf.KeyID, conf.SigningKey, claims)
+}
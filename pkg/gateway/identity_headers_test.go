@@ -0,0 +1,169 @@
+package gateway
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/idproxy/gateway/internal/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newIdentityTestGateway returns a gateway authenticating requests as p, if not nil,
+// and echoing the request headers it received into the response.
+func newIdentityTestGateway(p *Principal, handlers ...HandlerFunc) *Gateway {
+	r := New()
+	r.Use(func(c *Context) {
+		if p != nil {
+			c.SetPrincipal(p)
+		}
+		c.Set("tenant", "acme")
+	})
+	r.Use(handlers...)
+	r.GET("/", func(c *Context) {
+		for name, values := range c.Request.Header {
+			c.Writer.Header()[name] = values
+		}
+		c.Status(http.StatusNoContent)
+	})
+	return r
+}
+
+func TestStripHeaders(t *testing.T) {
+	r := newIdentityTestGateway(nil, StripHeaders("X-Auth-User", "x-forwarded-user", "X-Auth-Role-*"))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Auth-User", "admin")
+	req.Header.Set("X-Forwarded-User", "admin")
+	req.Header["x-auth-user"] = []string{"admin"}
+	req.Header["X_AUTH_USER"] = []string{"admin"}
+	req.Header.Set("X-Auth-Role-Admin", "true")
+	req.Header["x-auth-role-root"] = []string{"true"}
+	req.Header.Set("X-Auth-Other", "kept")
+	req.Header.Set("Accept", "text/plain")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	for _, name := range []string{"X-Auth-User", "x-auth-user", "X_AUTH_USER", "X-Forwarded-User", "X-Auth-Role-Admin", "x-auth-role-root"} {
+		assert.Empty(t, w.Header()[name], name)
+	}
+	assert.Equal(t, "kept", w.Header().Get("X-Auth-Other"))
+	assert.Equal(t, "text/plain", w.Header().Get("Accept"))
+}
+
+func TestIdentityHeaders(t *testing.T) {
+	p := &Principal{Subject: "alice", Email: "alice@example.com", Groups: []string{"admins", "dev"}}
+	conf := IdentityHeadersConfig{Headers: map[string]string{
+		"x-auth-user":   "{{.Principal.Subject}}",
+		"X-Auth-Email":  "{{.Principal.Email}}",
+		"X-Auth-Groups": `{{join .Principal.Groups ","}}`,
+		"X-Auth-Name":   "{{.Principal.Name}}",
+		"X-Auth-Tenant": `{{index .Keys "tenant"}}`,
+	}}
+
+	spoofed := http.Header{
+		"X-Auth-User": {"mallory"},
+		"x-auth-user": {"mallory"},
+		"X-Auth-Name": {"Mallory"},
+		"X_Auth_Name": {"Mallory"},
+	}
+	w := performRequestWithHeader(newIdentityTestGateway(p, IdentityHeaders(conf)), http.MethodGet, "/", spoofed)
+	assert.Equal(t, []string{"alice"}, w.Header()["X-Auth-User"])
+	assert.Empty(t, w.Header()["x-auth-user"])
+	assert.Equal(t, "alice@example.com", w.Header().Get("X-Auth-Email"))
+	assert.Equal(t, "admins,dev", w.Header().Get("X-Auth-Groups"))
+	assert.Equal(t, "acme", w.Header().Get("X-Auth-Tenant"))
+	// Templates rendering to an empty string do not set the header, and the spoofed
+	// values are gone.
+	assert.Empty(t, w.Header()["X-Auth-Name"])
+	assert.Empty(t, w.Header()["X_Auth_Name"])
+
+	// Without principal the identity headers are only removed.
+	w = performRequestWithHeader(newIdentityTestGateway(nil, IdentityHeaders(conf)), http.MethodGet, "/", spoofed)
+	for name := range spoofed {
+		assert.Empty(t, w.Header()[name], name)
+	}
+	assert.Empty(t, w.Header().Get("X-Auth-Tenant"))
+}
+
+func TestIdentityHeadersAssertion(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	p := &Principal{Subject: "alice", Email: "alice@example.com", Groups: []string{"admins"}, Scopes: []string{"read", "write"}, Method: "oidc"}
+	conf := IdentityHeadersConfig{
+		AssertionHeader: "X-Auth-Assertion",
+		SigningMethod:   "ES256",
+		SigningKey:      key,
+		KeyID:           "gateway",
+		Issuer:          "https://gateway.example.com",
+		Audience:        "upstream",
+		AssertionTTL:    30 * time.Second,
+	}
+	r := newIdentityTestGateway(p, IdentityHeaders(conf))
+
+	w := performRequestWithHeader(r, http.MethodGet, "/", http.Header{"X-Auth-Assertion": {"forged"}})
+	raw := w.Header().Get("X-Auth-Assertion")
+	require.NotEqual(t, "forged", raw)
+	tok, err := jwt.Parse(raw)
+	require.NoError(t, err)
+	assert.Equal(t, jwt.Header{Alg: "ES256", Kid: "gateway", Typ: "JWT"}, tok.Header)
+	require.NoError(t, tok.Verify(&key.PublicKey))
+
+	claims := tok.Claims
+	assert.Equal(t, "alice", claims["sub"])
+	assert.Equal(t, "https://gateway.example.com", claims["iss"])
+	assert.Equal(t, "upstream", claims["aud"])
+	assert.Equal(t, "alice@example.com", claims["email"])
+	assert.Equal(t, []any{"admins"}, claims["groups"])
+	assert.Equal(t, "read write", claims["scope"])
+	assert.Equal(t, []any{"oidc"}, claims["amr"])
+	assert.NotEmpty(t, claims["jti"])
+
+	iat, ok := claimTime(claims["iat"])
+	require.True(t, ok)
+	exp, ok := claimTime(claims["exp"])
+	require.True(t, ok)
+	assert.WithinDuration(t, time.Now(), iat, 2*time.Second)
+	assert.Equal(t, 30*time.Second, exp.Sub(iat))
+
+	// Every request gets a fresh assertion.
+	w = performRequestWithHeader(r, http.MethodGet, "/", nil)
+	next, err := jwt.Parse(w.Header().Get("X-Auth-Assertion"))
+	require.NoError(t, err)
+	assert.NotEqual(t, claims["jti"], next.Claims["jti"])
+
+	// The assertion does not verify with another key.
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	assert.ErrorIs(t, tok.Verify(&other.PublicKey), jwt.ErrInvalidSignature)
+}
+
+func TestIdentityHeadersAssertionDefaultTTL(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	r := newIdentityTestGateway(&Principal{Subject: "alice"}, IdentityHeaders(IdentityHeadersConfig{
+		AssertionHeader: "X-Auth-Assertion",
+		SigningMethod:   "HS256",
+		SigningKey:      secret,
+	}))
+	w := performRequestWithHeader(r, http.MethodGet, "/", nil)
+	tok, err := jwt.Parse(w.Header().Get("X-Auth-Assertion"))
+	require.NoError(t, err)
+	require.NoError(t, tok.Verify(secret))
+	iat, _ := claimTime(tok.Claims["iat"])
+	exp, _ := claimTime(tok.Claims["exp"])
+	assert.Equal(t, time.Minute, exp.Sub(iat))
+	assert.Nil(t, tok.Claims["iss"])
+	assert.Nil(t, tok.Claims["aud"])
+}
+
+func TestIdentityHeadersRequiresSigningKey(t *testing.T) {
+	assert.Panics(t, func() {
+		IdentityHeaders(IdentityHeadersConfig{AssertionHeader: "X-Auth-Assertion"})
+	})
+}
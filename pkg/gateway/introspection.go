@@ -0,0 +1,258 @@
+package gateway
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/idproxy/gateway/internal/json"
+)
+
+// ErrTokenInactive is recorded when the introspection endpoint reports a token as inactive.
+var ErrTokenInactive = errors.New("introspection: token is not active")
+
+// IntrospectionConfig defines the config for TokenIntrospection middleware.
+type IntrospectionConfig struct {
+	// Endpoint is the RFC 7662 introspection endpoint.
+	Endpoint string
+
+	// ClientID and ClientSecret authenticate the gateway at the endpoint with HTTP Basic.
+	ClientID     string
+	ClientSecret string
+
+	// MaxTTL bounds how long an active result is cached. Results are never cached past
+	// the exp of the token.
+	// Optional. Default value is 5 minutes.
+	MaxTTL time.Duration
+
+	// InactiveTTL is how long an inactive result is cached.
+	// Optional. Default value is 30 seconds.
+	InactiveTTL time.Duration
+
+	// MaxEntries bounds the number of cached results.
+	// Optional. Default value is 10000.
+	MaxEntries int
+
+	// GroupsClaim and RolesClaim name the response members mapped into Principal.Groups
+	// and Principal.Roles. Optional. Default values are "groups" and "roles".
+	GroupsClaim string
+	RolesClaim  string
+
+	// HTTPClient is used to call the endpoint.
+	// Optional. Default value is a client with a 5 second timeout.
+	HTTPClient *http.Client
+}
+
+type introspectionEntry struct {
+	principal *Principal // nil when the token is inactive
+	expires   time.Time
+}
+
+type introspectionCall struct {
+	done      chan struct{}
+	principal *Principal
+	err       error
+}
+
+type introspector struct {
+	config IntrospectionConfig
+
+	mu       sync.Mutex
+	cache    map[[sha256.Size]byte]introspectionEntry
+	inflight map[[sha256.Size]byte]*introspectionCall
+}
+
+// TokenIntrospection returns a middleware authenticating bearer tokens with an OAuth2
+// token introspection endpoint (RFC 7662). Results are cached, honoring the exp of the
+// token, and concurrent lookups of the same token share one call to the endpoint.
+// Requests without a bearer token or with an inactive token are aborted with 401, and
+// with 503 when the endpoint can not be reached.
+func TokenIntrospection(conf IntrospectionConfig) HandlerFunc {
+	assert1(conf.Endpoint != "", "introspection: Endpoint can not be empty")
+	if conf.MaxTTL <= 0 {
+		conf.MaxTTL = 5 * time.Minute
+	}
+	if conf.InactiveTTL <= 0 {
+		conf.InactiveTTL = 30 * time.Second
+	}
+	if conf.MaxEntries <= 0 {
+		conf.MaxEntries = 10000
+	}
+	if conf.GroupsClaim == "" {
+		conf.GroupsClaim = "groups"
+	}
+	if conf.RolesClaim == "" {
+		conf.RolesClaim = "roles"
+	}
+	if conf.HTTPClient == nil {
+		conf.HTTPClient = &http.Client{Timeout: 5 * time.Second}
+	}
+	in := &introspector{
+		config:   conf,
+		cache:    make(map[[sha256.Size]byte]introspectionEntry),
+		inflight: make(map[[sha256.Size]byte]*introspectionCall),
+	}
+
+	return func(c *Context) {
+		token, ok := bearerToken(c.GetHeader("Authorization"))
+		if !ok {
+			c.Header("WWW-Authenticate", "Bearer")
+			_ = c.AbortWithError(http.StatusUnauthorized, &Error{Err: ErrInvalidCredentials, Type: ErrorTypePublic})
+			return
+		}
+		p, err := in.lookup(c.Request.Context(), token)
+		if err != nil {
+			_ = c.AbortWithError(http.StatusServiceUnavailable, err)
+			return
+		}
+		if p == nil {
+			c.auditLoginFailure("introspection", "", ErrTokenInactive)
+			c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+			_ = c.AbortWithError(http.StatusUnauthorized, &Error{Err: ErrTokenInactive, Type: ErrorTypePublic})
+			return
+		}
+		c.SetPrincipal(p)
+	}
+}
+
+// lookup returns the principal of an active token, nil for an inactive token.
+func (in *introspector) lookup(ctx context.Context, token string) (*Principal, error) {
+	key := sha256.Sum256([]byte(token))
+	now := time.Now()
+
+	in.mu.Lock()
+	if e, ok := in.cache[key]; ok && now.Before(e.expires) {
+		in.mu.Unlock()
+		return e.principal, nil
+	}
+	if call, ok := in.inflight[key]; ok {
+		in.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.principal, call.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	call := &introspectionCall{done: make(chan struct{})}
+	in.inflight[key] = call
+	in.mu.Unlock()
+
+	// the call is detached from the request so that a canceled first request does not
+	// fail the requests waiting for the same token
+	timeout := in.config.HTTPClient.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	callCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	call.principal, call.err = in.introspect(callCtx, token)
+	cancel()
+
+	in.mu.Lock()
+	delete(in.inflight, key)
+	if call.err == nil {
+		in.store(key, call.principal, now)
+	}
+	in.mu.Unlock()
+	close(call.done)
+	return call.principal, call.err
+}
+
+// store caches a result. It must be called with in.mu held.
+func (in *introspector) store(key [sha256.Size]byte, p *Principal, now time.Time) {
+	expires := now.Add(in.config.InactiveTTL)
+	if p != nil {
+		expires = now.Add(in.config.MaxTTL)
+		if !p.ExpiresAt.IsZero() && p.ExpiresAt.Before(expires) {
+			expires = p.ExpiresAt
+		}
+	}
+	if len(in.cache) >= in.config.MaxEntries {
+		for k, e := range in.cache {
+			if !now.Before(e.expires) {
+				delete(in.cache, k)
+			}
+		}
+		// still full: drop arbitrary entries, they are cheap to look up again
+		for k := range in.cache {
+			if len(in.cache) < in.config.MaxEntries {
+				break
+			}
+			delete(in.cache, k)
+		}
+	}
+	in.cache[key] = introspectionEntry{principal: p, expires: expires}
+}
+
+func (in *introspector) introspect(ctx context.Context, token string) (*Principal, error) {
+	form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, in.config.Endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if in.config.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(in.config.ClientID), url.QueryEscape(in.config.ClientSecret))
+	}
+
+	resp, err := in.config.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("introspection: endpoint returned %d", resp.StatusCode)
+	}
+	var claims map[string]any
+	if err := json.Unmarshal(body, &claims); err != nil {
+		return nil, err
+	}
+
+	if active, _ := claims["active"].(bool); !active {
+		return nil, nil
+	}
+	p := &Principal{
+		Groups: claimStrings(claims[in.config.GroupsClaim]),
+		Roles:  claimStrings(claims[in.config.RolesClaim]),
+		Method: "introspection",
+		Claims: claims,
+	}
+	p.Issuer, _ = claims["iss"].(string)
+	p.Name, _ = claims["username"].(string)
+	p.Email, _ = claims["email"].(string)
+	if p.Subject, _ = claims["sub"].(string); p.Subject == "" {
+		p.Subject = p.Name
+	}
+	if scope, ok := claims["scope"].(string); ok {
+		p.Scopes = strings.Fields(scope)
+	}
+	if exp, ok := claimTime(claims["exp"]); ok {
+		if !time.Now().Before(exp) {
+			return nil, nil
+		}
+		p.ExpiresAt = exp
+	}
+	return p, nil
+}
+
+// bearerToken extracts the token of an Authorization header using the Bearer scheme.
+func bearerToken(header string) (string, bool) {
+	const prefix = "bearer "
+	if len(header) <= len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return "", false
+	}
+	token := strings.TrimSpace(header[len(prefix):])
+	return token, token != ""
+}
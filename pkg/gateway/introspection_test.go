@@ -0,0 +1,105 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newIntrospectionServer(t *testing.T, calls *int32, delay time.Duration) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		if id, secret, _ := r.BasicAuth(); id != "gateway" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		time.Sleep(delay)
+		switch r.PostFormValue("token") {
+		case "active":
+			writeTestJSON(w, map[string]any{
+				"active":   true,
+				"sub":      "alice",
+				"username": "alice",
+				"scope":    "read write",
+				"exp":      time.Now().Add(time.Hour).Unix(),
+			})
+		case "expired":
+			writeTestJSON(w, map[string]any{"active": true, "sub": "bob", "exp": time.Now().Add(-time.Minute).Unix()})
+		default:
+			writeTestJSON(w, map[string]any{"active": false})
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newIntrospectionTestGateway(endpoint string) *Gateway {
+	r := New()
+	r.Use(TokenIntrospection(IntrospectionConfig{Endpoint: endpoint, ClientID: "gateway", ClientSecret: "secret"}))
+	r.GET("/", func(c *Context) {
+		p, _ := c.Principal()
+		c.String(http.StatusOK, "%s %v", p.Subject, p.Scopes)
+	})
+	return r
+}
+
+func bearerRequest(r http.Handler, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestTokenIntrospection(t *testing.T) {
+	var calls int32
+	r := newIntrospectionTestGateway(newIntrospectionServer(t, &calls, 0).URL)
+
+	w := bearerRequest(r, "active")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "alice [read write]", w.Body.String())
+
+	w = bearerRequest(r, "active")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls), "active result is cached")
+
+	for i := 0; i < 2; i++ {
+		w = bearerRequest(r, "revoked")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls), "inactive result is cached")
+
+	assert.Equal(t, http.StatusUnauthorized, bearerRequest(r, "expired").Code)
+	assert.Equal(t, http.StatusUnauthorized, bearerRequest(r, "").Code)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestTokenIntrospectionCoalescesLookups(t *testing.T) {
+	var calls int32
+	r := newIntrospectionTestGateway(newIntrospectionServer(t, &calls, 50*time.Millisecond).URL)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Equal(t, http.StatusOK, bearerRequest(r, "active").Code)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestTokenIntrospectionEndpointDown(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	r := newIntrospectionTestGateway(srv.URL)
+	assert.Equal(t, http.StatusServiceUnavailable, bearerRequest(r, "active").Code)
+}
@@ -3,6 +3,7 @@ package gateway
 import (
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"os"
 	"time"
@@ -40,9 +41,41 @@ type LoggerConfig struct {
 	// Optional. Default value is gin.DefaultWriter.
 	Output io.Writer
 
-	// SkipPaths is an url path array which logs are not written.
+	// SkipPaths is an url path array which logs are not written. The probe routes
+	// registered by Health.Register are always skipped.
 	// Optional.
 	SkipPaths []string
+
+	// Format selects the text lines of Formatter or a structured access log written
+	// through log/slog as JSON or logfmt.
+	// Optional. Default value is LogFormatText.
+	Format LogFormat
+
+	// Handler receives the records of the structured access log, e.g. to send them to a
+	// shared slog.Handler. Setting it implies a structured access log.
+	// Optional. Default value is a JSON or text handler writing to Output.
+	Handler slog.Handler
+
+	// Fields selects the fields of the structured access log besides method, path,
+	// status, latency and client IP.
+	// Optional. Default value is DefaultLogFields.
+	Fields LogField
+
+	// RequestHeaders and ResponseHeaders are the headers added to the structured
+	// access log.
+	// Optional.
+	RequestHeaders  []string
+	ResponseHeaders []string
+
+	// SampleRate is the fraction of requests logged, between 0 and 1. Responses with
+	// status 500 and above or with errors are always logged.
+	// Optional. Default value is 1.
+	SampleRate float64
+
+	// RedactQueryParams are the query parameters whose values are replaced by REDACTED
+	// in the logged path.
+	// Optional. Default value is DefaultRedactedQueryParams.
+	RedactQueryParams []string
 }
 
 // LogFormatter gives the signature of the formatter function passed to LoggerWithFormatter
@@ -72,6 +105,18 @@ type LogFormatterParams struct {
 	BodySize int
 	// Keys are the keys set on the request's context.
 	Keys map[string]any
+	// RequestID is the ID set by the RequestID middleware.
+	RequestID string
+	// TraceID is the W3C trace ID of the request, if a trace context was set.
+	TraceID string
+	// Route is the matched route template, e.g. /users/:id.
+	Route string
+	// Principal is the authenticated principal, if any.
+	Principal *Principal
+	// RequestSize is the Content-Length of the request, -1 if unknown.
+	RequestSize int64
+	// UpstreamLatency is the latency stored under UpstreamLatencyKey, if any.
+	UpstreamLatency time.Duration
 }
 
 // StatusCodeColor is the ANSI color for appropriately logging http status code to a terminal.
@@ -136,14 +181,18 @@ var defaultLogFormatter = func(param LogFormatterParams) string {
 	if param.Latency > time.Minute {
 		param.Latency = param.Latency.Truncate(time.Second)
 	}
-	fmt.Printf("logger formatter: %v\n", param)
-	return fmt.Sprintf("[GIN] %v |%s %3d %s| %13v | %15s |%s %-7s %s %#v\n%s",
+	var requestID string
+	if param.RequestID != "" {
+		requestID = " | " + param.RequestID
+	}
+	return fmt.Sprintf("[GW] %v |%s %3d %s| %13v | %15s |%s %-7s %s %#v%s\n%s",
 		param.TimeStamp.Format("2006/01/02 - 15:04:05"),
 		statusColor, param.StatusCode, resetColor,
 		param.Latency,
 		param.ClientIP,
 		methodColor, param.Method, resetColor,
 		param.Path,
+		requestID,
 		param.ErrorMessage,
 	)
 }
@@ -168,6 +217,25 @@ func LoggerWithConfig(conf LoggerConfig) HandlerFunc {
 
 	notlogged := conf.SkipPaths
 
+	if conf.Fields == 0 {
+		conf.Fields = DefaultLogFields
+	}
+	if conf.SampleRate <= 0 || conf.SampleRate > 1 {
+		conf.SampleRate = 1
+	}
+	if conf.RedactQueryParams == nil {
+		conf.RedactQueryParams = DefaultRedactedQueryParams
+	}
+	var logger *slog.Logger
+	switch {
+	case conf.Handler != nil:
+		logger = slog.New(conf.Handler)
+	case conf.Format == LogFormatJSON:
+		logger = slog.New(slog.NewJSONHandler(out, nil))
+	case conf.Format == LogFormatLogfmt:
+		logger = slog.New(slog.NewTextHandler(out, nil))
+	}
+
 	isTerm := true
 
 	if w, ok := out.(*os.File); !ok || os.Getenv("TERM") == "dumb" ||
@@ -195,7 +263,11 @@ func LoggerWithConfig(conf LoggerConfig) HandlerFunc {
 		gctx.Next()
 
 		// Log only when path is not being skipped
-		if _, ok := skip[path]; !ok {
+		_, skipped := skip[path]
+		if !skipped && gctx.gateway != nil {
+			skipped = gctx.gateway.unloggedPaths[path]
+		}
+		if !skipped && sampled(gctx, conf.SampleRate) {
 			param := LogFormatterParams{
 				Request: gctx.Request,
 				isTerm:  isTerm,
@@ -213,13 +285,31 @@ func LoggerWithConfig(conf LoggerConfig) HandlerFunc {
 
 			param.BodySize = gctx.Writer.Size()
 
+			param.RequestID = gctx.RequestID()
+			if v, ok := gctx.Get(TraceContextKey); ok {
+				if tc, ok := v.(TraceContext); ok {
+					param.TraceID = tc.TraceIDString()
+				}
+			}
+
+			param.Route = gctx.FullPath()
+			param.Principal, _ = gctx.Principal()
+			param.RequestSize = gctx.Request.ContentLength
+			if v, ok := gctx.Get(UpstreamLatencyKey); ok {
+				param.UpstreamLatency, _ = v.(time.Duration)
+			}
+
 			if raw != "" {
-				path = path + "?" + raw
+				path = path + "?" + redactQuery(raw, conf.RedactQueryParams)
 			}
 
 			param.Path = path
 
-			fmt.Fprint(out, formatter(param))
+			if logger != nil {
+				logAccess(logger, &conf, gctx, param)
+			} else {
+				fmt.Fprint(out, formatter(param))
+			}
 		}
 	}
 }
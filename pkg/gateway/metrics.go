@@ -0,0 +1,301 @@
+package gateway
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultLatencyBuckets are the default upper bounds, in seconds, of the request
+// duration histogram.
+var DefaultLatencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// DefaultSizeBuckets are the default upper bounds, in bytes, of the response size
+// histogram.
+var DefaultSizeBuckets = []float64{100, 1000, 10000, 100000, 1e6, 1e7}
+
+// MetricsConfig defines the config for Metrics.
+type MetricsConfig struct {
+	// Namespace prefixes the metric names.
+	// Optional. Default value is "gateway".
+	Namespace string
+
+	// LatencyBuckets are the upper bounds of the request duration histogram in seconds.
+	// Optional. Default value is DefaultLatencyBuckets.
+	LatencyBuckets []float64
+
+	// SizeBuckets are the upper bounds of the response size histogram in bytes.
+	// Optional. Default value is DefaultSizeBuckets.
+	SizeBuckets []float64
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+func (h *histogram) observe(bounds []float64, v float64) {
+	i := sort.SearchFloat64s(bounds, v)
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.sum += v
+	h.count++
+}
+
+type requestSeries struct {
+	requests uint64
+	latency  histogram
+	size     histogram
+}
+
+type metricsLabels struct {
+	method, route, status string
+}
+
+// Metrics records request metrics and exposes them in the Prometheus text format,
+// without depending on a client library:
+//
+//   - <namespace>_http_requests_total counts requests,
+//   - <namespace>_http_request_duration_seconds is a histogram of their latency,
+//   - <namespace>_http_response_size_bytes is a histogram of the response sizes,
+//
+// all labeled by method, route and status, and <namespace>_http_requests_in_flight
+// gauges the requests being handled by method and route. The route label is the route
+// template, e.g. /users/:id, or "unmatched", and status is the status class, e.g. 2xx,
+// which keeps the number of series bounded.
+type Metrics struct {
+	config MetricsConfig
+
+	mu       sync.Mutex
+	series   map[metricsLabels]*requestSeries
+	inFlight map[metricsLabels]int64
+}
+
+// NewMetrics returns a new Metrics for the given config.
+func NewMetrics(conf MetricsConfig) *Metrics {
+	if conf.Namespace == "" {
+		conf.Namespace = "gateway"
+	}
+	if len(conf.LatencyBuckets) == 0 {
+		conf.LatencyBuckets = DefaultLatencyBuckets
+	}
+	if len(conf.SizeBuckets) == 0 {
+		conf.SizeBuckets = DefaultSizeBuckets
+	}
+	assert1(sort.Float64sAreSorted(conf.LatencyBuckets) && sort.Float64sAreSorted(conf.SizeBuckets),
+		"metrics: buckets must be sorted")
+	return &Metrics{
+		config:   conf,
+		series:   make(map[metricsLabels]*requestSeries),
+		inFlight: make(map[metricsLabels]int64),
+	}
+}
+
+// Handler returns the middleware recording the metrics of every request.
+func (m *Metrics) Handler() HandlerFunc {
+	return func(c *Context) {
+		start := time.Now()
+		labels := metricsLabels{method: metricsMethod(c.Request.Method), route: c.FullPath()}
+		if labels.route == "" {
+			labels.route = "unmatched"
+		}
+
+		m.mu.Lock()
+		m.inFlight[labels]++
+		m.mu.Unlock()
+		defer func() {
+			status := c.Writer.Status()
+			p := recover()
+			if p != nil {
+				status = http.StatusInternalServerError
+			}
+			m.observe(labels, status, c.Writer.Size(), time.Since(start))
+			if p != nil {
+				panic(p)
+			}
+		}()
+		c.Next()
+	}
+}
+
+func (m *Metrics) observe(labels metricsLabels, status, size int, latency time.Duration) {
+	if size < 0 {
+		size = 0
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inFlight[labels]--
+	labels.status = strconv.Itoa(status/100) + "xx"
+	s, ok := m.series[labels]
+	if !ok {
+		s = &requestSeries{
+			latency: histogram{counts: make([]uint64, len(m.config.LatencyBuckets))},
+			size:    histogram{counts: make([]uint64, len(m.config.SizeBuckets))},
+		}
+		m.series[labels] = s
+	}
+	s.requests++
+	s.latency.observe(m.config.LatencyBuckets, latency.Seconds())
+	s.size.observe(m.config.SizeBuckets, float64(size))
+}
+
+// metricsMethod maps unknown methods to OTHER, so that clients can not create series.
+func metricsMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "OTHER"
+}
+
+// ServeMetrics is a handler writing the metrics in the Prometheus text exposition
+// format, e.g. for GET /metrics.
+func (m *Metrics) ServeMetrics(c *Context) {
+	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.Status(http.StatusOK)
+	if _, err := m.WriteTo(c.Writer); err != nil {
+		_ = c.Error(err)
+	}
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]metricsLabels, 0, len(m.series))
+	for k := range m.series {
+		keys = append(keys, k)
+	}
+	sortMetricsLabels(keys)
+	gauges := make([]metricsLabels, 0, len(m.inFlight))
+	for k := range m.inFlight {
+		gauges = append(gauges, k)
+	}
+	sortMetricsLabels(gauges)
+
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	ns := m.config.Namespace
+
+	name := ns + "_http_requests_total"
+	writeMetricHeader(cw, name, "counter", "Total number of HTTP requests.")
+	for _, k := range keys {
+		writeSample(cw, name, k.labels(), float64(m.series[k].requests))
+	}
+
+	name = ns + "_http_request_duration_seconds"
+	writeMetricHeader(cw, name, "histogram", "Latency of HTTP requests in seconds.")
+	for _, k := range keys {
+		writeHistogram(cw, name, k.labels(), m.config.LatencyBuckets, &m.series[k].latency)
+	}
+
+	name = ns + "_http_response_size_bytes"
+	writeMetricHeader(cw, name, "histogram", "Size of HTTP response bodies in bytes.")
+	for _, k := range keys {
+		writeHistogram(cw, name, k.labels(), m.config.SizeBuckets, &m.series[k].size)
+	}
+
+	name = ns + "_http_requests_in_flight"
+	writeMetricHeader(cw, name, "gauge", "Number of HTTP requests being handled.")
+	for _, k := range gauges {
+		writeSample(cw, name, k.labels()[:2], float64(m.inFlight[k]))
+	}
+
+	if cw.err == nil {
+		cw.err = cw.w.Flush()
+	}
+	return cw.n, cw.err
+}
+
+func sortMetricsLabels(keys []metricsLabels) {
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.status < b.status
+	})
+}
+
+func (l metricsLabels) labels() [][2]string {
+	return [][2]string{{"method", l.method}, {"route", l.route}, {"status", l.status}}
+}
+
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (w *countingWriter) WriteString(s string) {
+	if w.err != nil {
+		return
+	}
+	n, err := w.w.WriteString(s)
+	w.n += int64(n)
+	w.err = err
+}
+
+func writeMetricHeader(w *countingWriter, name, typ, help string) {
+	w.WriteString("# HELP " + name + " " + help + "\n# TYPE " + name + " " + typ + "\n")
+}
+
+func writeSample(w *countingWriter, name string, labels [][2]string, v float64) {
+	var b strings.Builder
+	b.WriteString(name)
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(l[0] + `="` + escapeLabelValue(l[1]) + `"`)
+		}
+		b.WriteByte('}')
+	}
+	b.WriteByte(' ')
+	b.WriteString(formatMetricValue(v))
+	b.WriteByte('\n')
+	w.WriteString(b.String())
+}
+
+func writeHistogram(w *countingWriter, name string, labels [][2]string, bounds []float64, h *histogram) {
+	var cumulative uint64
+	for i, bound := range bounds {
+		cumulative += h.counts[i]
+		writeSample(w, name+"_bucket", append(labels[:len(labels):len(labels)], [2]string{"le", formatMetricValue(bound)}), float64(cumulative))
+	}
+	writeSample(w, name+"_bucket", append(labels[:len(labels):len(labels)], [2]string{"le", "+Inf"}), float64(h.count))
+	writeSample(w, name+"_sum", labels, h.sum)
+	writeSample(w, name+"_count", labels, float64(h.count))
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(v string) string {
+	return labelValueEscaper.Replace(v)
+}
+
+func formatMetricValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,48 @@
+package gateway
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics(MetricsConfig{LatencyBuckets: []float64{1}, SizeBuckets: []float64{6}})
+	r := New()
+	r.Use(m.Handler())
+	r.GET("/metrics", m.ServeMetrics)
+	r.GET("/users/:id", func(c *Context) {
+		c.String(http.StatusOK, "user %s", c.Params.ByName("id"))
+	})
+
+	performRequest(r, http.MethodGet, "/users/1")
+	performRequest(r, http.MethodGet, "/users/22")
+	performRequest(r, "PURGE", "/users/1")
+	performRequest(r, http.MethodGet, "/nowhere")
+
+	w := performRequest(r, http.MethodGet, "/metrics")
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", w.Header().Get("Content-Type"))
+	body := w.Body.String()
+	for _, line := range []string{
+		"# TYPE gateway_http_requests_total counter",
+		`gateway_http_requests_total{method="GET",route="/users/:id",status="2xx"} 2`,
+		`gateway_http_requests_total{method="GET",route="unmatched",status="4xx"} 1`,
+		`gateway_http_requests_total{method="OTHER",route="unmatched",status="4xx"} 1`,
+		"# TYPE gateway_http_request_duration_seconds histogram",
+		`gateway_http_request_duration_seconds_bucket{method="GET",route="/users/:id",status="2xx",le="1"} 2`,
+		`gateway_http_request_duration_seconds_bucket{method="GET",route="/users/:id",status="2xx",le="+Inf"} 2`,
+		`gateway_http_request_duration_seconds_count{method="GET",route="/users/:id",status="2xx"} 2`,
+		`gateway_http_response_size_bytes_bucket{method="GET",route="/users/:id",status="2xx",le="6"} 1`,
+		`gateway_http_response_size_bytes_bucket{method="GET",route="/users/:id",status="2xx",le="+Inf"} 2`,
+		`gateway_http_response_size_bytes_sum{method="GET",route="/users/:id",status="2xx"} 13`,
+		`gateway_http_requests_in_flight{method="GET",route="/metrics"} 1`,
+	} {
+		assert.Contains(t, body, line+"\n")
+	}
+	assert.NotContains(t, body, "/users/1")
+}
+
+func TestEscapeLabelValue(t *testing.T) {
+	assert.Equal(t, `a\\b\"c\nd`, escapeLabelValue("a\\b\"c\nd"))
+}
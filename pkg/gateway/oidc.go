@@ -0,0 +1,725 @@
+package gateway
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/idproxy/gateway/internal/json"
+	"github.com/idproxy/gateway/internal/jwt"
+	"github.com/idproxy/gateway/pkg/audit"
+)
+
+const (
+	defaultOIDCSessionCookie = "gateway_session"
+	oidcStateCookieSuffix    = "_oidc"
+	oidcStateTTL             = 10 * time.Minute
+	oidcKeySetMinRefresh     = 10 * time.Second
+)
+
+var (
+	// ErrOIDCState is returned when the callback state is missing, expired or does not match.
+	ErrOIDCState = errors.New("oidc: invalid or expired state")
+	// ErrOIDCNonce is returned when the ID token nonce does not match the one sent with the request.
+	ErrOIDCNonce = errors.New("oidc: nonce mismatch")
+	// ErrOIDCIDToken is returned when the ID token fails validation.
+	ErrOIDCIDToken = errors.New("oidc: invalid id token")
+	// ErrOIDCNoSession is returned when the request carries no valid session.
+	ErrOIDCNoSession = errors.New("oidc: no valid session")
+	// ErrOIDCLogoutOrigin is returned when a logout request comes from another site.
+	ErrOIDCLogoutOrigin = errors.New("oidc: cross-site logout request")
+)
+
+// OIDCConfig defines the config for the OpenID Connect relying party.
+type OIDCConfig struct {
+	// Issuer is the issuer URL of the OpenID provider. The provider metadata is
+	// discovered from Issuer + "/.well-known/openid-configuration".
+	Issuer string
+
+	// ClientID and ClientSecret are the credentials of the gateway at the provider.
+	// When ClientSecret is empty the gateway authenticates as a public client and
+	// relies on PKCE only.
+	ClientID     string
+	ClientSecret string
+
+	// RedirectURL is the absolute URL of the callback route registered at the provider.
+	RedirectURL string
+
+	// Scopes requested from the provider.
+	// Optional. Default value is openid, profile and email.
+	Scopes []string
+
+	// HashKey is used to derive the key encrypting the session and state cookies. It must
+	// be at least 32 bytes.
+	// Optional. If empty a random key is generated, which invalidates sessions on restart.
+	HashKey []byte
+
+	// CookieName is the name of the session cookie.
+	// Optional. Default value is "gateway_session".
+	CookieName string
+	// CookieDomain and CookiePath scope the session cookie.
+	CookieDomain string
+	CookiePath   string
+	// CookieSecure marks the cookies as Secure. It should be true in production.
+	CookieSecure bool
+
+	// SessionTTL is how long a session established by the callback stays valid. The session
+	// ends earlier when the ID token expires first.
+	// Optional. Default value is 8 hours.
+	SessionTTL time.Duration
+
+	// PostLogoutRedirectURL is where the client is sent after logout. When the provider
+	// supports RP-initiated logout it is passed as post_logout_redirect_uri.
+	// Optional. Default value is "/".
+	PostLogoutRedirectURL string
+
+	// AllowedRedirectHosts lists the hosts the login flow may redirect back to with an
+	// absolute rd URL, as needed when the gateway serves ForwardAuth for other hosts.
+	// Optional. By default only local paths are allowed.
+	AllowedRedirectHosts []string
+
+	// GroupsClaim and RolesClaim name the ID token claims mapped into Principal.Groups and
+	// Principal.Roles. Optional. Default values are "groups" and "roles".
+	GroupsClaim string
+	RolesClaim  string
+
+	// SessionClaims names the ID token claims kept in Principal.Claims, e.g. for the
+	// claim expressions of Authorize. Other claims are dropped so that the session cookie
+	// stays small.
+	// Optional. By default no claims are kept.
+	SessionClaims []string
+
+	// ClockSkew is the tolerance applied when validating token timestamps.
+	// Optional. Default value is one minute.
+	ClockSkew time.Duration
+
+	// HTTPClient is used to talk to the provider.
+	// Optional. Default value is a client with a 10 second timeout.
+	HTTPClient *http.Client
+}
+
+// oidcMetadata is the subset of the provider metadata the relying party uses.
+type oidcMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+	EndSessionEndpoint    string `json:"end_session_endpoint"`
+}
+
+// oidcState is kept in an encrypted cookie between /login and /callback.
+type oidcState struct {
+	State    string `json:"s"`
+	Nonce    string `json:"n"`
+	Verifier string `json:"v"`
+	Redirect string `json:"r"`
+	Expires  int64  `json:"e"`
+}
+
+// oidcSession is kept in the encrypted session cookie.
+type oidcSession struct {
+	Principal *Principal `json:"p"`
+	Expires   int64      `json:"e"`
+}
+
+type oidcTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	IDToken     string `json:"id_token"`
+	Scope       string `json:"scope"`
+	Error       string `json:"error"`
+	ErrorDesc   string `json:"error_description"`
+}
+
+// OIDC is an OpenID Connect relying party using the authorization code flow with PKCE.
+// Register mounts the login, callback and logout routes and Authenticate returns the
+// middleware that resolves the session cookie into a *Principal.
+type OIDC struct {
+	config    OIDCConfig
+	codec     *CookieCodec
+	loginPath string
+
+	mu          sync.RWMutex
+	metadata    *oidcMetadata
+	keySet      *jwt.KeySet
+	keysFetched time.Time
+}
+
+// NewOIDC returns a relying party for the given config. The provider metadata is
+// discovered lazily on first use.
+func NewOIDC(conf OIDCConfig) *OIDC {
+	assert1(conf.Issuer != "", "oidc: Issuer can not be empty")
+	assert1(conf.ClientID != "", "oidc: ClientID can not be empty")
+	assert1(conf.RedirectURL != "", "oidc: RedirectURL can not be empty")
+
+	conf.Issuer = strings.TrimSuffix(conf.Issuer, "/")
+	if len(conf.Scopes) == 0 {
+		conf.Scopes = []string{"openid", "profile", "email"}
+	}
+	if len(conf.HashKey) == 0 {
+		debugPrint("[WARNING] oidc: no HashKey configured, sessions will not survive a restart")
+		conf.HashKey = []byte(randomString(32))
+	}
+	if conf.CookieName == "" {
+		conf.CookieName = defaultOIDCSessionCookie
+	}
+	if conf.CookiePath == "" {
+		conf.CookiePath = "/"
+	}
+	if conf.SessionTTL <= 0 {
+		conf.SessionTTL = 8 * time.Hour
+	}
+	if conf.PostLogoutRedirectURL == "" {
+		conf.PostLogoutRedirectURL = "/"
+	}
+	if conf.GroupsClaim == "" {
+		conf.GroupsClaim = "groups"
+	}
+	if conf.RolesClaim == "" {
+		conf.RolesClaim = "roles"
+	}
+	if conf.ClockSkew <= 0 {
+		conf.ClockSkew = time.Minute
+	}
+	if conf.HTTPClient == nil {
+		conf.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	key := sha256.Sum256(conf.HashKey)
+	codec, err := NewCookieCodec(0, key[:])
+	if err != nil {
+		panic(err)
+	}
+	return &OIDC{config: conf, codec: codec, loginPath: "/login"}
+}
+
+// Register adds the /login, /callback and /logout routes to the group. Logout only
+// accepts POST so that it can not be triggered by a cross-site link or image.
+func (o *OIDC) Register(group *RouterGroup) {
+	o.loginPath = joinPaths(group.BasePath(), "/login")
+	group.GET("/login", o.login)
+	group.GET("/callback", o.callback)
+	group.POST("/logout", o.logout)
+}
+
+// LoginPath returns the path of the login route.
+func (o *OIDC) LoginPath() string {
+	return o.loginPath
+}
+
+// Authenticate returns a middleware that stores the principal of a valid session in
+// c.Keys. Requests without a session are redirected to the login route when they are
+// browser navigations (GET or HEAD) and rejected with 401 otherwise.
+func (o *OIDC) Authenticate() HandlerFunc {
+	return func(c *Context) {
+		p, err := o.principal(c)
+		if err != nil {
+			if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+				c.Redirect(http.StatusFound, o.loginURL(c.Request.URL.RequestURI()))
+				c.Abort()
+				return
+			}
+			_ = c.AbortWithError(http.StatusUnauthorized, err)
+			return
+		}
+		c.SetPrincipal(p)
+	}
+}
+
+func (o *OIDC) loginURL(redirect string) string {
+	return o.loginPath + "?rd=" + url.QueryEscape(redirect)
+}
+
+// principal resolves the session cookie of the request.
+func (o *OIDC) principal(c *Context) (*Principal, error) {
+	cookie, err := c.Cookie(o.config.CookieName)
+	if err != nil {
+		return nil, ErrOIDCNoSession
+	}
+	var sess oidcSession
+	if err := o.decode(o.config.CookieName, cookie, &sess); err != nil || sess.Principal == nil {
+		return nil, ErrOIDCNoSession
+	}
+	if time.Now().Unix() >= sess.Expires {
+		return nil, ErrOIDCNoSession
+	}
+	return sess.Principal, nil
+}
+
+func (o *OIDC) login(c *Context) {
+	md, err := o.discover(c.Request.Context())
+	if err != nil {
+		_ = c.AbortWithError(http.StatusBadGateway, err)
+		return
+	}
+	st := oidcState{
+		State:    randomString(32),
+		Nonce:    randomString(32),
+		Verifier: randomString(48),
+		Redirect: safeRedirect(c.Query("rd"), o.config.AllowedRedirectHosts),
+		Expires:  time.Now().Add(oidcStateTTL).Unix(),
+	}
+	value, err := o.encode(o.config.CookieName+oidcStateCookieSuffix, st)
+	if err != nil {
+		_ = c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	o.setCookie(c, o.config.CookieName+oidcStateCookieSuffix, value, int(oidcStateTTL/time.Second))
+
+	challenge := sha256.Sum256([]byte(st.Verifier))
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", o.config.ClientID)
+	q.Set("redirect_uri", o.config.RedirectURL)
+	q.Set("scope", strings.Join(o.config.Scopes, " "))
+	q.Set("state", st.State)
+	q.Set("nonce", st.Nonce)
+	q.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	q.Set("code_challenge_method", "S256")
+	c.Redirect(http.StatusFound, appendQuery(md.AuthorizationEndpoint, q))
+}
+
+func (o *OIDC) callback(c *Context) {
+	stateCookie := o.config.CookieName + oidcStateCookieSuffix
+	if e := c.Query("error"); e != "" {
+		o.setCookie(c, stateCookie, "", -1)
+		err := fmt.Errorf("oidc: authorization failed: %s: %s", e, c.Query("error_description"))
+		c.auditLoginFailure("oidc", "", err)
+		_ = c.AbortWithError(http.StatusUnauthorized, &Error{Err: err, Type: ErrorTypePublic})
+		return
+	}
+
+	var st oidcState
+	cookie, err := c.Cookie(stateCookie)
+	if err != nil || o.decode(stateCookie, cookie, &st) != nil ||
+		time.Now().Unix() >= st.Expires ||
+		!hmac.Equal([]byte(st.State), []byte(c.Query("state"))) {
+		c.auditLoginFailure("oidc", "", ErrOIDCState)
+		_ = c.AbortWithError(http.StatusBadRequest, &Error{Err: ErrOIDCState, Type: ErrorTypePublic})
+		return
+	}
+	o.setCookie(c, stateCookie, "", -1)
+
+	code := c.Query("code")
+	if code == "" {
+		_ = c.AbortWithError(http.StatusBadRequest, &Error{Err: errors.New("oidc: missing code"), Type: ErrorTypePublic})
+		return
+	}
+	tok, err := o.exchange(c.Request.Context(), code, st.Verifier)
+	if err != nil {
+		c.auditLoginFailure("oidc", "", err)
+		_ = c.AbortWithError(http.StatusBadGateway, err)
+		return
+	}
+	claims, err := o.verifyIDToken(c.Request.Context(), tok.IDToken, st.Nonce)
+	if err != nil {
+		c.auditLoginFailure("oidc", "", err)
+		_ = c.AbortWithError(http.StatusUnauthorized, err)
+		return
+	}
+
+	p := o.newPrincipal(claims, tok.Scope)
+	value, err := o.encode(o.config.CookieName, oidcSession{Principal: p, Expires: p.ExpiresAt.Unix()})
+	if err != nil {
+		_ = c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	o.setCookie(c, o.config.CookieName, value, int(time.Until(p.ExpiresAt)/time.Second))
+	c.SetPrincipal(p)
+	c.Audit(audit.Event{Type: audit.LoginSuccess})
+	c.Audit(audit.Event{Type: audit.TokenIssued, Reason: "session cookie", Details: map[string]any{"expires": p.ExpiresAt}})
+	c.Redirect(http.StatusFound, st.Redirect)
+}
+
+func (o *OIDC) logout(c *Context) {
+	if !o.sameSite(c.Request) {
+		_ = c.AbortWithError(http.StatusForbidden, &Error{Err: ErrOIDCLogoutOrigin, Type: ErrorTypePublic})
+		return
+	}
+	if p, err := o.principal(c); err == nil {
+		c.SetPrincipal(p)
+		c.Audit(audit.Event{Type: audit.Logout})
+	}
+	o.setCookie(c, o.config.CookieName, "", -1)
+	md, err := o.discover(c.Request.Context())
+	if err != nil || md.EndSessionEndpoint == "" {
+		c.Redirect(http.StatusFound, o.config.PostLogoutRedirectURL)
+		return
+	}
+	q := url.Values{}
+	q.Set("client_id", o.config.ClientID)
+	q.Set("post_logout_redirect_uri", o.config.PostLogoutRedirectURL)
+	c.Redirect(http.StatusFound, appendQuery(md.EndSessionEndpoint, q))
+}
+
+// sameSite reports whether r was sent by a page of the gateway itself. Browsers send
+// Origin with every POST and Sec-Fetch-Site with every request, so a request carrying
+// neither is not a cross-site form submission.
+func (o *OIDC) sameSite(r *http.Request) bool {
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "", "same-origin", "none":
+	default:
+		return false
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	ru, err := url.Parse(o.config.RedirectURL)
+	return err == nil && strings.EqualFold(u.Scheme, ru.Scheme) && strings.EqualFold(u.Host, ru.Host)
+}
+
+func (o *OIDC) newPrincipal(claims map[string]any, scope string) *Principal {
+	p := &Principal{
+		Issuer:    o.config.Issuer,
+		Groups:    claimStrings(claims[o.config.GroupsClaim]),
+		Roles:     claimStrings(claims[o.config.RolesClaim]),
+		Scopes:    strings.Fields(scope),
+		Method:    "oidc",
+		ExpiresAt: time.Now().Add(o.config.SessionTTL).Truncate(time.Second),
+	}
+	// The session never outlives the ID token it was established from.
+	if exp, ok := claimTime(claims["exp"]); ok && exp.Before(p.ExpiresAt) {
+		p.ExpiresAt = exp
+	}
+	for _, name := range o.config.SessionClaims {
+		if v, ok := claims[name]; ok {
+			if p.Claims == nil {
+				p.Claims = make(map[string]any, len(o.config.SessionClaims))
+			}
+			p.Claims[name] = v
+		}
+	}
+	p.Subject, _ = claims["sub"].(string)
+	p.Name, _ = claims["name"].(string)
+	p.Email, _ = claims["email"].(string)
+	return p
+}
+
+// exchange redeems the authorization code at the token endpoint.
+func (o *OIDC) exchange(ctx context.Context, code, verifier string) (*oidcTokenResponse, error) {
+	md, err := o.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", o.config.RedirectURL)
+	form.Set("code_verifier", verifier)
+	if o.config.ClientSecret == "" {
+		form.Set("client_id", o.config.ClientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, md.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if o.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(o.config.ClientID), url.QueryEscape(o.config.ClientSecret))
+	}
+
+	var tok oidcTokenResponse
+	status, err := o.doJSON(req, &tok)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK || tok.Error != "" {
+		return nil, fmt.Errorf("oidc: token endpoint returned %d: %s %s", status, tok.Error, tok.ErrorDesc)
+	}
+	if tok.IDToken == "" {
+		return nil, fmt.Errorf("%w: token response has no id_token", ErrOIDCIDToken)
+	}
+	return &tok, nil
+}
+
+// verifyIDToken validates the signature and the claims of the ID token as required by
+// OpenID Connect Core 1.0 section 3.1.3.7.
+func (o *OIDC) verifyIDToken(ctx context.Context, raw, nonce string) (map[string]any, error) {
+	tok, err := jwt.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOIDCIDToken, err)
+	}
+	if strings.HasPrefix(tok.Header.Alg, "HS") {
+		// symmetric signatures would let anyone holding the client secret mint tokens
+		return nil, fmt.Errorf("%w: %v", ErrOIDCIDToken, jwt.ErrUnsupportedAlg)
+	}
+	md, err := o.discover(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOIDCIDToken, err)
+	}
+	key, err := o.signingKey(ctx, tok.Header.Kid)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOIDCIDToken, err)
+	}
+	if err := tok.Verify(key); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOIDCIDToken, err)
+	}
+
+	claims := tok.Claims
+	now := time.Now()
+	// iss must match the discovered issuer exactly, which may end with a slash that
+	// the configured Issuer was trimmed of
+	if iss, _ := claims["iss"].(string); iss != md.Issuer {
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrOIDCIDToken, iss)
+	}
+	aud := claimStrings(claims["aud"])
+	if !contains(aud, o.config.ClientID) {
+		return nil, fmt.Errorf("%w: audience does not contain client id", ErrOIDCIDToken)
+	}
+	if azp, ok := claims["azp"].(string); (len(aud) > 1 || ok) && azp != o.config.ClientID {
+		return nil, fmt.Errorf("%w: unexpected authorized party %q", ErrOIDCIDToken, azp)
+	}
+	exp, ok := claimTime(claims["exp"])
+	if !ok || now.After(exp.Add(o.config.ClockSkew)) {
+		return nil, fmt.Errorf("%w: token expired", ErrOIDCIDToken)
+	}
+	if iat, ok := claimTime(claims["iat"]); ok && iat.After(now.Add(o.config.ClockSkew)) {
+		return nil, fmt.Errorf("%w: token issued in the future", ErrOIDCIDToken)
+	}
+	if nbf, ok := claimTime(claims["nbf"]); ok && nbf.After(now.Add(o.config.ClockSkew)) {
+		return nil, fmt.Errorf("%w: token not valid yet", ErrOIDCIDToken)
+	}
+	if n, _ := claims["nonce"].(string); !hmac.Equal([]byte(n), []byte(nonce)) {
+		return nil, ErrOIDCNonce
+	}
+	return claims, nil
+}
+
+// discover fetches and caches the provider metadata.
+func (o *OIDC) discover(ctx context.Context) (*oidcMetadata, error) {
+	o.mu.RLock()
+	md := o.metadata
+	o.mu.RUnlock()
+	if md != nil {
+		return md, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, o.config.Issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	md = &oidcMetadata{}
+	status, err := o.doJSON(req, md)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("oidc: discovery returned %d", status)
+	}
+	if strings.TrimSuffix(md.Issuer, "/") != o.config.Issuer {
+		return nil, fmt.Errorf("oidc: discovered issuer %q does not match %q", md.Issuer, o.config.Issuer)
+	}
+
+	o.mu.Lock()
+	o.metadata = md
+	o.mu.Unlock()
+	return md, nil
+}
+
+// signingKey returns the provider key with the given id, refreshing the key set when
+// the key is unknown so that provider key rotation is picked up.
+func (o *OIDC) signingKey(ctx context.Context, kid string) (any, error) {
+	o.mu.RLock()
+	ks, fetched := o.keySet, o.keysFetched
+	o.mu.RUnlock()
+	if ks != nil {
+		key, err := ks.Lookup(kid)
+		if err == nil || time.Since(fetched) < oidcKeySetMinRefresh {
+			return key, err
+		}
+	}
+
+	ks, err := o.fetchKeySet(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ks.Lookup(kid)
+}
+
+// fetchKeySet fetches the key set of the provider and caches it.
+func (o *OIDC) fetchKeySet(ctx context.Context) (*jwt.KeySet, error) {
+	md, err := o.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, md.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	ks := &jwt.KeySet{}
+	status, err := o.doJSON(req, ks)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("oidc: jwks endpoint returned %d", status)
+	}
+
+	o.mu.Lock()
+	o.keySet, o.keysFetched = ks, time.Now()
+	o.mu.Unlock()
+	return ks, nil
+}
+
+// KeySetLoaded returns true once the key set of the provider was fetched.
+func (o *OIDC) KeySetLoaded() bool {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.keySet != nil
+}
+
+// HealthCheck returns a check that fails until the key set of the provider is loaded,
+// fetching it if needed, so that an instance is only ready once it can verify logins.
+func (o *OIDC) HealthCheck() HealthCheckFunc {
+	return func(ctx context.Context) error {
+		if o.KeySetLoaded() {
+			return nil
+		}
+		_, err := o.fetchKeySet(ctx)
+		return err
+	}
+}
+
+func (o *OIDC) doJSON(req *http.Request, v any) (int, error) {
+	resp, err := o.config.HTTPClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if err := json.Unmarshal(body, v); err != nil && resp.StatusCode == http.StatusOK {
+		return resp.StatusCode, err
+	}
+	return resp.StatusCode, nil
+}
+
+func (o *OIDC) setCookie(c *Context, name, value string, maxAge int) {
+	c.SetCookieData(&http.Cookie{
+		Name:     name,
+		Value:    value,
+		MaxAge:   maxAge,
+		Path:     o.config.CookiePath,
+		Domain:   o.config.CookieDomain,
+		SameSite: http.SameSiteLaxMode,
+		Secure:   o.config.CookieSecure,
+		HttpOnly: true,
+	})
+}
+
+// encode serializes v and encrypts it for the cookie with the given name, so that the
+// profile of the principal is not readable by the client.
+func (o *OIDC) encode(name string, v any) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return o.codec.Encode(name, b)
+}
+
+// decode decrypts value of the cookie with the given name and deserializes it into v.
+func (o *OIDC) decode(name, value string, v any) error {
+	b, err := o.codec.Decode(name, value)
+	if err != nil {
+		return ErrOIDCNoSession
+	}
+	return json.Unmarshal(b, v)
+}
+
+// randomString returns n random bytes encoded as unpadded base64url.
+func randomString(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// safeRedirect only allows local absolute paths and URLs on allowed hosts so the
+// login flow can not be used as an open redirector. Browsers drop tabs and newlines
+// from URLs and treat backslashes like slashes, so targets containing whitespace or
+// control characters are rejected, and so are local paths with a backslash, raw or
+// escaped, before the query.
+func safeRedirect(rd string, allowedHosts []string) string {
+	if rd == "" || strings.IndexFunc(rd, func(r rune) bool {
+		return unicode.IsControl(r) || unicode.IsSpace(r)
+	}) >= 0 {
+		return "/"
+	}
+	u, err := url.Parse(rd)
+	if err != nil {
+		return "/"
+	}
+	if rd[0] == '/' {
+		path, _, _ := strings.Cut(rd, "?")
+		if u.Scheme == "" && u.Host == "" && !strings.HasPrefix(rd, "//") &&
+			!strings.Contains(path, "\\") && !strings.Contains(strings.ToLower(path), "%5c") {
+			return rd
+		}
+		return "/"
+	}
+	if (u.Scheme == "https" || u.Scheme == "http") && u.User == nil && contains(allowedHosts, u.Hostname()) {
+		return rd
+	}
+	return "/"
+}
+
+func appendQuery(endpoint string, q url.Values) string {
+	if strings.Contains(endpoint, "?") {
+		return endpoint + "&" + q.Encode()
+	}
+	return endpoint + "?" + q.Encode()
+}
+
+// claimStrings returns a claim that is either a single string or an array of strings.
+func claimStrings(v any) []string {
+	switch t := v.(type) {
+	case string:
+		if t == "" {
+			return nil
+		}
+		return []string{t}
+	case []string:
+		return t
+	case []any:
+		out := make([]string, 0, len(t))
+		for _, e := range t {
+			if s, ok := e.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// claimTime returns a NumericDate claim as time.
+func claimTime(v any) (time.Time, bool) {
+	switch t := v.(type) {
+	case float64:
+		return time.Unix(int64(t), 0), true
+	case int64:
+		return time.Unix(t, 0), true
+	}
+	return time.Time{}, false
+}
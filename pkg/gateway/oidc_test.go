@@ -0,0 +1,476 @@
+package gateway
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/idproxy/gateway/internal/json"
+	"github.com/idproxy/gateway/internal/jwt"
+	"github.com/idproxy/gateway/pkg/audit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeIdP is a minimal OpenID provider issuing RS256 signed ID tokens.
+type fakeIdP struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]url.Values // code -> authorization request
+	nonce string                // overrides the nonce in issued tokens when set
+
+	issuer string // issuer in the metadata and issued tokens, defaults to the server URL
+}
+
+func (idp *fakeIdP) issuerURL() string {
+	if idp.issuer != "" {
+		return idp.issuer
+	}
+	return idp.URL
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	idp := &fakeIdP{key: key, codes: map[string]url.Values{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeTestJSON(w, map[string]string{
+			"issuer":                 idp.issuerURL(),
+			"authorization_endpoint": idp.URL + "/authorize",
+			"token_endpoint":         idp.URL + "/token",
+			"jwks_uri":               idp.URL + "/jwks",
+			"end_session_endpoint":   idp.URL + "/logout",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		jwk, _ := jwt.NewJSONWebKey("test-key", &key.PublicKey)
+		writeTestJSON(w, jwt.KeySet{Keys: []jwt.JSONWebKey{jwk}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if id != "client" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			writeTestJSON(w, map[string]string{"error": "invalid_client"})
+			return
+		}
+		idp.mu.Lock()
+		authz, ok := idp.codes[r.PostFormValue("code")]
+		delete(idp.codes, r.PostFormValue("code"))
+		nonce := idp.nonce
+		idp.mu.Unlock()
+		challenge := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+		if !ok || authz.Get("code_challenge") != base64.RawURLEncoding.EncodeToString(challenge[:]) {
+			w.WriteHeader(http.StatusBadRequest)
+			writeTestJSON(w, map[string]string{"error": "invalid_grant"})
+			return
+		}
+		if nonce == "" {
+			nonce = authz.Get("nonce")
+		}
+		idToken, _ := jwt.Sign("RS256", "test-key", key, map[string]any{
+			"iss":    idp.issuerURL(),
+			"sub":    "alice",
+			"aud":    "client",
+			"exp":    time.Now().Add(time.Hour).Unix(),
+			"iat":    time.Now().Unix(),
+			"nonce":  nonce,
+			"email":  "alice@example.com",
+			"groups": []string{"admins"},
+		})
+		writeTestJSON(w, map[string]string{"access_token": "at", "id_token": idToken, "scope": "openid email"})
+	})
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+// authorize simulates the user signing in at the provider and returns the code.
+func (idp *fakeIdP) authorize(t *testing.T, location string) (code, state string) {
+	u, err := url.Parse(location)
+	require.NoError(t, err)
+	q := u.Query()
+	assert.Equal(t, idp.URL+"/authorize", u.Scheme+"://"+u.Host+u.Path)
+	assert.Equal(t, "S256", q.Get("code_challenge_method"))
+	assert.NotEmpty(t, q.Get("nonce"))
+
+	code = randomString(16)
+	idp.mu.Lock()
+	idp.codes[code] = q
+	idp.mu.Unlock()
+	return code, q.Get("state")
+}
+
+func writeTestJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	b, _ := json.Marshal(v)
+	_, _ = w.Write(b)
+}
+
+func performRequest(r http.Handler, method, path string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func findCookie(w *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, c := range w.Result().Cookies() {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func newOIDCTestGateway(idp *fakeIdP) *Gateway {
+	o := NewOIDC(OIDCConfig{
+		Issuer:       idp.issuerURL(),
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURL:  "https://gateway.example.com/auth/callback",
+		HashKey:      []byte("0123456789abcdef0123456789abcdef"),
+	})
+	r := New()
+	o.Register(r.Group("/auth"))
+	me := func(c *Context) {
+		p, _ := c.Principal()
+		c.String(http.StatusOK, "%s %s %v", p.Subject, p.Email, p.Groups)
+	}
+	app := r.Group("/app", o.Authenticate())
+	app.GET("/me", me)
+	app.POST("/me", me)
+	return r
+}
+
+func TestOIDCLoginFlow(t *testing.T) {
+	idp := newFakeIdP(t)
+	r := newOIDCTestGateway(idp)
+
+	w := performRequest(r, http.MethodGet, "/app/me")
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "/auth/login?rd=%2Fapp%2Fme", w.Header().Get("Location"))
+
+	w = performRequest(r, http.MethodGet, w.Header().Get("Location"))
+	assert.Equal(t, http.StatusFound, w.Code)
+	stateCookie := findCookie(w, "gateway_session_oidc")
+	require.NotNil(t, stateCookie)
+	code, state := idp.authorize(t, w.Header().Get("Location"))
+
+	w = performRequest(r, http.MethodGet, "/auth/callback?code="+code+"&state="+state, stateCookie)
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "/app/me", w.Header().Get("Location"))
+	session := findCookie(w, "gateway_session")
+	require.NotNil(t, session)
+	assert.True(t, session.HttpOnly)
+	assert.Equal(t, http.SameSiteLaxMode, session.SameSite)
+	plain, _ := base64.RawURLEncoding.DecodeString(session.Value)
+	assert.NotContains(t, string(plain), "alice@example.com", "session cookie must be encrypted")
+
+	w = performRequest(r, http.MethodGet, "/app/me", session)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "alice alice@example.com [admins]", w.Body.String())
+
+	w = performRequest(r, http.MethodGet, "/auth/logout", session)
+	assert.NotEqual(t, http.StatusFound, w.Code, "logout must not be reachable over GET")
+	assert.Nil(t, findCookie(w, "gateway_session"))
+
+	w = performRequest(r, http.MethodPost, "/auth/logout", session)
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.True(t, strings.HasPrefix(w.Header().Get("Location"), idp.URL+"/logout?"))
+	assert.Equal(t, -1, findCookie(w, "gateway_session").MaxAge)
+}
+
+func TestOIDCSessionKeepsOnlySessionClaims(t *testing.T) {
+	o := NewOIDC(OIDCConfig{
+		Issuer:        "https://idp.example.com",
+		ClientID:      "client",
+		RedirectURL:   "https://gateway.example.com/auth/callback",
+		HashKey:       []byte("0123456789abcdef0123456789abcdef"),
+		SessionClaims: []string{"tenant", "missing"},
+	})
+	p := o.newPrincipal(map[string]any{
+		"sub":     "alice",
+		"email":   "alice@example.com",
+		"tenant":  "acme",
+		"address": map[string]any{"street": "Main St 1"},
+	}, "openid")
+	assert.Equal(t, "alice", p.Subject)
+	assert.Equal(t, map[string]any{"tenant": "acme"}, p.Claims)
+
+	value, err := o.encode(o.config.CookieName, oidcSession{Principal: p, Expires: p.ExpiresAt.Unix()})
+	require.NoError(t, err)
+	var sess oidcSession
+	require.NoError(t, o.decode(o.config.CookieName, value, &sess))
+	assert.Equal(t, "acme", sess.Principal.Claims["tenant"])
+	// A value encrypted for the state cookie is not accepted as a session.
+	assert.ErrorIs(t, o.decode(o.config.CookieName+oidcStateCookieSuffix, value, &sess), ErrOIDCNoSession)
+
+	o = NewOIDC(OIDCConfig{Issuer: "https://idp.example.com", ClientID: "client", RedirectURL: "https://gateway.example.com/auth/callback"})
+	assert.Nil(t, o.newPrincipal(map[string]any{"sub": "alice", "tenant": "acme"}, "").Claims)
+}
+
+func TestOIDCSessionEndsWithIDToken(t *testing.T) {
+	o := NewOIDC(OIDCConfig{
+		Issuer:      "https://idp.example.com",
+		ClientID:    "client",
+		RedirectURL: "https://gateway.example.com/auth/callback",
+		SessionTTL:  time.Hour,
+	})
+	now := time.Now()
+	exp := now.Add(10 * time.Minute).Truncate(time.Second)
+	p := o.newPrincipal(map[string]any{"sub": "alice", "exp": float64(exp.Unix())}, "")
+	assert.True(t, p.ExpiresAt.Equal(exp), "got %v, want %v", p.ExpiresAt, exp)
+
+	p = o.newPrincipal(map[string]any{"sub": "alice", "exp": float64(now.Add(2 * time.Hour).Unix())}, "")
+	assert.WithinDuration(t, now.Add(time.Hour), p.ExpiresAt, 2*time.Second)
+}
+
+func TestOIDCLogoutRejectsCrossSiteRequests(t *testing.T) {
+	idp := newFakeIdP(t)
+	r := newOIDCTestGateway(idp)
+
+	for name, header := range map[string]http.Header{
+		"foreign origin":  {"Origin": {"https://evil.example.com"}},
+		"null origin":     {"Origin": {"null"}},
+		"cross-site":      {"Sec-Fetch-Site": {"cross-site"}},
+		"sibling subsite": {"Sec-Fetch-Site": {"same-site"}},
+	} {
+		header.Set("Cookie", "gateway_session=x")
+		w := performRequestWithHeader(r, http.MethodPost, "/auth/logout", header)
+		assert.Equal(t, http.StatusForbidden, w.Code, name)
+		assert.Nil(t, findCookie(w, "gateway_session"), name)
+	}
+
+	for name, header := range map[string]http.Header{
+		"no origin":       {},
+		"redirect origin": {"Origin": {"https://gateway.example.com"}, "Sec-Fetch-Site": {"same-origin"}},
+		"request host":    {"Origin": {"http://example.com"}},
+	} {
+		w := performRequestWithHeader(r, http.MethodPost, "/auth/logout", header)
+		assert.Equal(t, http.StatusFound, w.Code, name)
+	}
+}
+
+func TestOIDCLoginFlowWithTrailingSlashIssuer(t *testing.T) {
+	idp := newFakeIdP(t)
+	idp.issuer = idp.URL + "/"
+	r := newOIDCTestGateway(idp)
+
+	w := performRequest(r, http.MethodGet, "/auth/login?rd=/app/me")
+	assert.Equal(t, http.StatusFound, w.Code)
+	stateCookie := findCookie(w, "gateway_session_oidc")
+	require.NotNil(t, stateCookie)
+	code, state := idp.authorize(t, w.Header().Get("Location"))
+
+	w = performRequest(r, http.MethodGet, "/auth/callback?code="+code+"&state="+state, stateCookie)
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "/app/me", w.Header().Get("Location"))
+	session := findCookie(w, "gateway_session")
+	require.NotNil(t, session)
+
+	w = performRequest(r, http.MethodGet, "/app/me", session)
+	assert.Equal(t, "alice alice@example.com [admins]", w.Body.String())
+
+	// iss must still match the discovered issuer exactly
+	o := NewOIDC(OIDCConfig{Issuer: idp.issuer, ClientID: "client", RedirectURL: "https://gateway.example.com/auth/callback"})
+	raw, err := jwt.Sign("RS256", "test-key", idp.key, map[string]any{
+		"iss":   idp.URL,
+		"sub":   "alice",
+		"aud":   "client",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": "n",
+	})
+	require.NoError(t, err)
+	_, err = o.verifyIDToken(context.Background(), raw, "n")
+	assert.ErrorIs(t, err, ErrOIDCIDToken)
+}
+
+func TestOIDCVerifyIDToken(t *testing.T) {
+	idp := newFakeIdP(t)
+	o := NewOIDC(OIDCConfig{Issuer: idp.URL, ClientID: "client", RedirectURL: "https://gateway.example.com/auth/callback"})
+	now := time.Now()
+	claims := func(override map[string]any) map[string]any {
+		c := map[string]any{
+			"iss":   idp.URL,
+			"sub":   "alice",
+			"aud":   "client",
+			"exp":   now.Add(time.Hour).Unix(),
+			"iat":   now.Unix(),
+			"nonce": "n",
+		}
+		for k, v := range override {
+			c[k] = v
+		}
+		return c
+	}
+	sign := func(alg, kid string, key any, c map[string]any) string {
+		raw, err := jwt.Sign(alg, kid, key, c)
+		require.NoError(t, err)
+		return raw
+	}
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&idp.key.PublicKey)
+	require.NoError(t, err)
+
+	got, err := o.verifyIDToken(context.Background(), sign("RS256", "test-key", idp.key, claims(nil)), "n")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", got["sub"])
+
+	tests := map[string]string{
+		"expired":         sign("RS256", "test-key", idp.key, claims(map[string]any{"exp": now.Add(-2 * time.Minute).Unix()})),
+		"no exp":          sign("RS256", "test-key", idp.key, claims(map[string]any{"exp": nil})),
+		"not valid yet":   sign("RS256", "test-key", idp.key, claims(map[string]any{"nbf": now.Add(2 * time.Minute).Unix()})),
+		"issued later":    sign("RS256", "test-key", idp.key, claims(map[string]any{"iat": now.Add(2 * time.Minute).Unix()})),
+		"wrong issuer":    sign("RS256", "test-key", idp.key, claims(map[string]any{"iss": "https://evil.example.com"})),
+		"wrong audience":  sign("RS256", "test-key", idp.key, claims(map[string]any{"aud": "other"})),
+		"wrong kid":       sign("RS256", "unknown-key", idp.key, claims(nil)),
+		"wrong key":       sign("RS256", "test-key", other, claims(nil)),
+		"hmac with jwk":   sign("HS256", "test-key", der, claims(nil)),
+		"none":            unsignedTestToken(t, "none", claims(nil)),
+		"empty algorithm": unsignedTestToken(t, "", claims(nil)),
+	}
+	for name, raw := range tests {
+		_, err := o.verifyIDToken(context.Background(), raw, "n")
+		assert.ErrorIs(t, err, ErrOIDCIDToken, name)
+	}
+
+	// Timestamps within the clock skew are accepted.
+	_, err = o.verifyIDToken(context.Background(), sign("RS256", "test-key", idp.key, claims(map[string]any{
+		"exp": now.Add(-30 * time.Second).Unix(),
+		"nbf": now.Add(30 * time.Second).Unix(),
+	})), "n")
+	assert.NoError(t, err)
+
+	_, err = o.verifyIDToken(context.Background(), sign("RS256", "test-key", idp.key, claims(nil)), "other")
+	assert.ErrorIs(t, err, ErrOIDCNonce)
+}
+
+func unsignedTestToken(t *testing.T, alg string, claims map[string]any) string {
+	header, err := json.Marshal(map[string]string{"alg": alg, "kid": "test-key"})
+	require.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+	return base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload) + "."
+}
+
+func TestOIDCCookiesDoNotChangeSameSiteOfContext(t *testing.T) {
+	o := NewOIDC(OIDCConfig{Issuer: "https://idp.example.com", ClientID: "client", RedirectURL: "https://gateway.example.com/auth/callback"})
+	r := New()
+	r.GET("/", func(c *Context) {
+		o.setCookie(c, "gateway_session", "v", 60)
+		c.SetCookie("other", "v", 60, "/", "", false, false)
+	})
+	w := performRequest(r, http.MethodGet, "/")
+	assert.Equal(t, http.SameSiteLaxMode, findCookie(w, "gateway_session").SameSite)
+	assert.Equal(t, http.SameSite(0), findCookie(w, "other").SameSite)
+}
+
+func TestOIDCCallbackRejectsStateMismatch(t *testing.T) {
+	idp := newFakeIdP(t)
+	r := newOIDCTestGateway(idp)
+
+	w := performRequest(r, http.MethodGet, "/auth/login")
+	stateCookie := findCookie(w, "gateway_session_oidc")
+	code, _ := idp.authorize(t, w.Header().Get("Location"))
+
+	w = performRequest(r, http.MethodGet, "/auth/callback?code="+code+"&state=forged", stateCookie)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Nil(t, findCookie(w, "gateway_session"))
+}
+
+func TestOIDCCallbackAuditsFailedExchange(t *testing.T) {
+	sink := &audit.MemorySink{}
+	log, err := audit.New(sink)
+	require.NoError(t, err)
+	idp := newFakeIdP(t)
+	r := newOIDCTestGateway(idp)
+	r.AuditLog = log
+
+	w := performRequest(r, http.MethodGet, "/auth/login")
+	stateCookie := findCookie(w, "gateway_session_oidc")
+	_, state := idp.authorize(t, w.Header().Get("Location"))
+
+	w = performRequest(r, http.MethodGet, "/auth/callback?code=unknown&state="+state, stateCookie)
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	entries := sink.Entries()
+	require.Len(t, entries, 1)
+	assert.Equal(t, audit.LoginFailure, entries[0].Event.Type)
+	assert.Equal(t, "oidc", entries[0].Event.Method)
+}
+
+func TestOIDCCallbackRejectsNonceMismatch(t *testing.T) {
+	idp := newFakeIdP(t)
+	idp.nonce = "replayed"
+	r := newOIDCTestGateway(idp)
+
+	w := performRequest(r, http.MethodGet, "/auth/login")
+	stateCookie := findCookie(w, "gateway_session_oidc")
+	code, state := idp.authorize(t, w.Header().Get("Location"))
+
+	w = performRequest(r, http.MethodGet, "/auth/callback?code="+code+"&state="+state, stateCookie)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Nil(t, findCookie(w, "gateway_session"))
+}
+
+func TestOIDCLoginRejectsOpenRedirect(t *testing.T) {
+	allowed := []string{"app.example.com"}
+	tests := []struct {
+		rd   string
+		want string
+	}{
+		{"", "/"},
+		{"/app?x=1", "/app?x=1"},
+		{"/app/a%2Fb?q=%5C", "/app/a%2Fb?q=%5C"},
+		{"https://app.example.com/x", "https://app.example.com/x"},
+		{"https://evil.example.com", "/"},
+		{"https://app.example.com@evil.example.com/", "/"},
+		{"https://user@app.example.com/", "/"},
+		{"//evil.example.com", "/"},
+		{"javascript:alert(1)", "/"},
+		{"/\t/evil.example.com", "/"},
+		{"/\r\n/evil.example.com", "/"},
+		{"/ /evil.example.com", "/"},
+		{"/\\evil.example.com", "/"},
+		{"\\/evil.example.com", "/"},
+		{"/%5c/evil.example.com", "/"},
+		{"/%5C/evil.example.com", "/"},
+		{"/app\\..\\evil", "/"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, safeRedirect(tt.rd, allowed), "rd=%q", tt.rd)
+	}
+
+	// The rd query parameter is checked after it was decoded.
+	q, err := url.ParseQuery("rd=/%09/evil.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "/", safeRedirect(q.Get("rd"), allowed))
+}
+
+func TestOIDCAuthenticateRejectsTamperedSession(t *testing.T) {
+	idp := newFakeIdP(t)
+	r := newOIDCTestGateway(idp)
+
+	w := performRequest(r, http.MethodPost, "/app/me", &http.Cookie{Name: "gateway_session", Value: "e30.forged"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = performRequest(r, http.MethodGet, "/app/me", &http.Cookie{Name: "gateway_session", Value: "e30.forged"})
+	assert.Equal(t, http.StatusFound, w.Code)
+}
@@ -0,0 +1,82 @@
+package gateway
+
+import "time"
+
+// PrincipalKey is the Context.Keys key under which the authentication middlewares store
+// the authenticated *Principal.
+const PrincipalKey = "gateway/principal"
+
+// credentialHeaders are the request headers carrying credentials, as sent to the
+// authentication middlewares with their default configuration.
+var credentialHeaders = []string{"Authorization", "Cookie", "X-API-Key"}
+
+// Principal is the authenticated identity of a request. Every authentication middleware
+// stores the identity it established in the same shape so that authorization, header
+// injection and logging do not need to know how the request was authenticated.
+type Principal struct {
+	// Subject uniquely identifies the principal for the issuer.
+	Subject string `json:"sub"`
+	// Issuer identifies who authenticated the principal, e.g. the OIDC issuer URL.
+	Issuer string `json:"iss,omitempty"`
+	// Name is the display name of the principal.
+	Name string `json:"name,omitempty"`
+	// Email is the email address of the principal.
+	Email string `json:"email,omitempty"`
+	// Groups the principal is a member of.
+	Groups []string `json:"groups,omitempty"`
+	// Roles granted to the principal.
+	Roles []string `json:"roles,omitempty"`
+	// Scopes granted to the credential used by the principal.
+	Scopes []string `json:"scope,omitempty"`
+	// Method is the authentication method, e.g. "oidc", "basic", "apikey".
+	Method string `json:"amr,omitempty"`
+	// ExpiresAt is the time after which the authentication is no longer valid.
+	// The zero value means the authentication does not expire.
+	ExpiresAt time.Time `json:"exp,omitempty"`
+	// Claims holds the raw claims the principal was built from.
+	Claims map[string]any `json:"claims,omitempty"`
+}
+
+// Expired returns true if the authentication of the principal is no longer valid at t.
+func (p *Principal) Expired(t time.Time) bool {
+	return !p.ExpiresAt.IsZero() && !t.Before(p.ExpiresAt)
+}
+
+// HasGroup returns true if the principal is a member of group.
+func (p *Principal) HasGroup(group string) bool {
+	return contains(p.Groups, group)
+}
+
+// HasRole returns true if the principal was granted role.
+func (p *Principal) HasRole(role string) bool {
+	return contains(p.Roles, role)
+}
+
+// HasScope returns true if the principal was granted scope.
+func (p *Principal) HasScope(scope string) bool {
+	return contains(p.Scopes, scope)
+}
+
+// SetPrincipal stores the authenticated principal in c.Keys.
+func (c *Context) SetPrincipal(p *Principal) {
+	c.Set(PrincipalKey, p)
+}
+
+// Principal returns the principal stored by an authentication middleware, if any.
+func (c *Context) Principal() (*Principal, bool) {
+	v, ok := c.Get(PrincipalKey)
+	if !ok {
+		return nil, false
+	}
+	p, ok := v.(*Principal)
+	return p, ok && p != nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
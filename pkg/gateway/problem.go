@@ -0,0 +1,106 @@
+package gateway
+
+import (
+	"encoding/xml"
+	"net/http"
+
+	"github.com/idproxy/gateway/internal/json"
+	"github.com/idproxy/gateway/pkg/binding"
+)
+
+// Problem is an RFC 7807 problem details object, the body of error responses written by
+// the gateway.
+type Problem struct {
+	XMLName xml.Name `json:"-" xml:"urn:ietf:rfc:7807 problem"`
+	// Type is a URI reference identifying the problem type, "about:blank" by default.
+	Type string `json:"type,omitempty" xml:"type,omitempty"`
+	// Title is a short summary of the problem type, the status text by default.
+	Title string `json:"title,omitempty" xml:"title,omitempty"`
+	// Status is the HTTP status code.
+	Status int `json:"status,omitempty" xml:"status,omitempty"`
+	// Detail explains this occurrence of the problem.
+	Detail string `json:"detail,omitempty" xml:"detail,omitempty"`
+	// Instance is a URI reference identifying this occurrence of the problem.
+	Instance string `json:"instance,omitempty" xml:"instance,omitempty"`
+	// RequestID is the ID of the request, see RequestID.
+	RequestID string `json:"request_id,omitempty" xml:"request_id,omitempty"`
+	// Extensions are additional members of the problem object. Members named like the
+	// fields above are ignored. Extensions are only written in the JSON format.
+	Extensions map[string]any `json:"-" xml:"-"`
+}
+
+// NewProblem returns a problem for status with the default type and title.
+func NewProblem(status int) *Problem {
+	return &Problem{Type: "about:blank", Title: http.StatusText(status), Status: status}
+}
+
+// MarshalJSON implements json.Marshaler, merging the extensions into the object.
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	type problem Problem
+	if len(p.Extensions) == 0 {
+		return json.Marshal((*problem)(p))
+	}
+	b, err := json.Marshal((*problem)(p))
+	if err != nil {
+		return nil, err
+	}
+	members := make(map[string]any, len(p.Extensions)+6)
+	for k, v := range p.Extensions {
+		members[k] = v
+	}
+	if err := json.Unmarshal(b, &members); err != nil {
+		return nil, err
+	}
+	return json.Marshal(members)
+}
+
+// problemFormats are the media types accepted for problems, JSON first.
+var problemFormats = []string{
+	binding.MIMEProblemJSON, binding.MIMEJSON, binding.MIMEProblemXML, binding.MIMEXML, binding.MIMEXML2,
+}
+
+// wantsProblemXML reports whether an Accept header prefers XML over JSON.
+func wantsProblemXML(accept string) bool {
+	if accept == "" {
+		return false
+	}
+	q := parseQValues(accept)
+	best, bestQ := 0, 0.0
+	for i, format := range problemFormats {
+		weight, ok := q[format]
+		if !ok {
+			continue
+		}
+		if weight > bestQ {
+			best, bestQ = i, weight
+		}
+	}
+	if bestQ == 0 {
+		return false
+	}
+	return problemFormats[best] != binding.MIMEProblemJSON && problemFormats[best] != binding.MIMEJSON
+}
+
+// AbortWithProblem aborts the chain and writes p as application/problem+json, or as
+// application/problem+xml if the request prefers XML. The request ID of the context is
+// added if p has none.
+func (c *Context) AbortWithProblem(p *Problem) {
+	if p.RequestID == "" {
+		p.RequestID = c.RequestID()
+	}
+	contentType := binding.MIMEProblemJSON
+	var body []byte
+	var err error
+	if wantsProblemXML(c.GetHeader("Accept")) {
+		contentType = binding.MIMEProblemXML
+		body, err = xml.Marshal(p)
+	} else {
+		body, err = json.Marshal(p)
+	}
+	if err != nil {
+		_ = c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	c.Abort()
+	c.Data(p.Status, contentType, body)
+}
@@ -0,0 +1,287 @@
+package gateway
+
+import (
+	"errors"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is recorded when a request is rejected by RateLimit.
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// RateLimitAlgorithm selects how RateLimit counts requests.
+type RateLimitAlgorithm int
+
+const (
+	// TokenBucket refills Limit tokens per Window into a bucket of Burst tokens, which
+	// allows short bursts while enforcing the average rate.
+	TokenBucket RateLimitAlgorithm = iota
+	// SlidingWindow allows Limit requests in any Window, approximated by weighting the
+	// count of the previous fixed window.
+	SlidingWindow
+)
+
+// RateLimitRule is the quota a RateLimitStore enforces for a key.
+type RateLimitRule struct {
+	Algorithm RateLimitAlgorithm
+	Limit     int
+	Window    time.Duration
+	Burst     int
+}
+
+// RateLimitResult is the outcome of taking one request from a quota.
+type RateLimitResult struct {
+	// Allowed is true if the request is within the quota.
+	Allowed bool
+	// Remaining is the number of requests still allowed right now.
+	Remaining int
+	// Reset is the time until the quota is fully available again.
+	Reset time.Duration
+	// RetryAfter is the time until the next request will be allowed, 0 if allowed.
+	RetryAfter time.Duration
+}
+
+// RateLimitStore keeps the quota state of every key. Implementations must be safe for
+// concurrent use and apply Take atomically.
+type RateLimitStore interface {
+	Take(key string, rule RateLimitRule, now time.Time) (RateLimitResult, error)
+}
+
+// RateLimitConfig defines the config for RateLimit middleware.
+type RateLimitConfig struct {
+	// Limit is the number of requests allowed per Window.
+	Limit int
+	// Window is the period Limit applies to.
+	// Optional. Default value is one minute.
+	Window time.Duration
+	// Burst is the bucket size of TokenBucket.
+	// Optional. Default value is Limit.
+	Burst int
+	// Algorithm is TokenBucket or SlidingWindow.
+	// Optional. Default value is TokenBucket.
+	Algorithm RateLimitAlgorithm
+
+	// KeyFunc returns the key requests are counted by. Requests with an empty key are
+	// not limited.
+	// Optional. Default value is KeyByClientIP.
+	KeyFunc func(c *Context) string
+
+	// Store keeps the quota state. Stores shared between limiters must be given keys
+	// that do not collide, e.g. by prefixing them in KeyFunc.
+	// Optional. Default value is a new in-memory store.
+	Store RateLimitStore
+}
+
+// KeyByClientIP counts requests per client IP.
+func KeyByClientIP(c *Context) string {
+	return c.ClientIP()
+}
+
+// KeyByPrincipal counts requests per authenticated principal and falls back to the
+// client IP for unauthenticated requests.
+func KeyByPrincipal(c *Context) string {
+	if p, ok := c.Principal(); ok {
+		return "principal:" + p.Issuer + "|" + p.Subject
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// KeyByRoute counts requests per matched route template, e.g. "POST /login".
+func KeyByRoute(c *Context) string {
+	return c.Request.Method + " " + c.FullPath()
+}
+
+// CombineKeys counts requests per combination of the keys, e.g.
+// CombineKeys(KeyByRoute, KeyByClientIP) limits every client on every route.
+func CombineKeys(keyFuncs ...func(c *Context) string) func(c *Context) string {
+	return func(c *Context) string {
+		parts := make([]string, len(keyFuncs))
+		for i, fn := range keyFuncs {
+			parts[i] = fn(c)
+		}
+		return strings.Join(parts, "|")
+	}
+}
+
+// RateLimit returns a middleware limiting the request rate per key. Responses carry the
+// RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset and RateLimit-Policy headers,
+// rejected requests are aborted with 429 and a Retry-After header.
+func RateLimit(conf RateLimitConfig) HandlerFunc {
+	assert1(conf.Limit > 0, "rate limit: Limit must be positive")
+	if conf.Window <= 0 {
+		conf.Window = time.Minute
+	}
+	if conf.Burst <= 0 {
+		conf.Burst = conf.Limit
+	}
+	if conf.KeyFunc == nil {
+		conf.KeyFunc = KeyByClientIP
+	}
+	if conf.Store == nil {
+		conf.Store = NewMemoryRateLimitStore()
+	}
+	rule := RateLimitRule{Algorithm: conf.Algorithm, Limit: conf.Limit, Window: conf.Window, Burst: conf.Burst}
+	limit := strconv.Itoa(conf.Limit)
+	policy := limit + ";w=" + strconv.Itoa(int(math.Ceil(conf.Window.Seconds())))
+	if conf.Algorithm == TokenBucket && conf.Burst != conf.Limit {
+		policy += ";burst=" + strconv.Itoa(conf.Burst)
+	}
+
+	return func(c *Context) {
+		key := conf.KeyFunc(c)
+		if key == "" {
+			return
+		}
+		res, err := conf.Store.Take(key, rule, time.Now())
+		if err != nil {
+			// fail open, an unavailable store must not take the gateway down
+			_ = c.Error(err)
+			return
+		}
+
+		h := c.Writer.Header()
+		h.Set("RateLimit-Limit", limit)
+		h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+		h.Set("RateLimit-Policy", policy)
+		if !res.Allowed {
+			h.Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+			_ = c.AbortWithError(http.StatusTooManyRequests, &Error{Err: ErrRateLimited, Type: ErrorTypePublic})
+		}
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int(math.Ceil(d.Seconds()))
+}
+
+const rateLimitShards = 64
+
+type rateLimitEntry struct {
+	// token bucket
+	tokens float64
+	last   time.Time
+	// sliding window
+	windowStart time.Time
+	prev, curr  int
+
+	expires time.Time
+}
+
+type rateLimitShard struct {
+	mu      sync.Mutex
+	entries map[string]*rateLimitEntry
+	takes   int
+}
+
+// MemoryRateLimitStore is a RateLimitStore keeping quotas in process memory, sharded to
+// reduce lock contention. Idle keys are removed lazily.
+type MemoryRateLimitStore struct {
+	shards [rateLimitShards]rateLimitShard
+}
+
+var _ RateLimitStore = (*MemoryRateLimitStore)(nil)
+
+// NewMemoryRateLimitStore returns an empty in-memory rate limit store.
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	s := &MemoryRateLimitStore{}
+	for i := range s.shards {
+		s.shards[i].entries = make(map[string]*rateLimitEntry)
+	}
+	return s
+}
+
+// Take implements RateLimitStore.
+func (s *MemoryRateLimitStore) Take(key string, rule RateLimitRule, now time.Time) (RateLimitResult, error) {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	shard := &s.shards[h.Sum32()%rateLimitShards]
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if shard.takes++; shard.takes%1024 == 0 {
+		for k, e := range shard.entries {
+			if now.After(e.expires) {
+				delete(shard.entries, k)
+			}
+		}
+	}
+	e, ok := shard.entries[key]
+	if !ok {
+		e = &rateLimitEntry{tokens: float64(rule.Burst), last: now, windowStart: now}
+		shard.entries[key] = e
+	}
+	if rule.Algorithm == SlidingWindow {
+		return e.takeSlidingWindow(rule, now), nil
+	}
+	return e.takeTokenBucket(rule, now), nil
+}
+
+func (e *rateLimitEntry) takeTokenBucket(rule RateLimitRule, now time.Time) RateLimitResult {
+	rate := float64(rule.Limit) / rule.Window.Seconds() // tokens per second
+	capacity := float64(rule.Burst)
+	if elapsed := now.Sub(e.last).Seconds(); elapsed > 0 {
+		e.tokens = math.Min(capacity, e.tokens+elapsed*rate)
+		e.last = now
+	}
+
+	var res RateLimitResult
+	if e.tokens >= 1 {
+		e.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = secondsToDuration((1 - e.tokens) / rate)
+	}
+	res.Remaining = int(e.tokens)
+	res.Reset = secondsToDuration((capacity - e.tokens) / rate)
+	e.expires = now.Add(res.Reset)
+	return res
+}
+
+func (e *rateLimitEntry) takeSlidingWindow(rule RateLimitRule, now time.Time) RateLimitResult {
+	if elapsed := now.Sub(e.windowStart); elapsed >= rule.Window {
+		windows := elapsed / rule.Window
+		e.prev = e.curr
+		if windows > 1 {
+			e.prev = 0
+		}
+		e.curr = 0
+		e.windowStart = e.windowStart.Add(windows * rule.Window)
+	}
+	elapsed := now.Sub(e.windowStart)
+	weight := 1 - float64(elapsed)/float64(rule.Window)
+	count := float64(e.prev)*weight + float64(e.curr)
+
+	var res RateLimitResult
+	if count+1 <= float64(rule.Limit) {
+		e.curr++
+		count++
+		res.Allowed = true
+	} else {
+		res.RetryAfter = rule.Window - elapsed
+		if e.curr < rule.Limit && e.prev > 0 {
+			// the weighted previous window drops below the limit before the window ends
+			need := 1 - (float64(rule.Limit)-float64(e.curr)-1)/float64(e.prev)
+			res.RetryAfter = time.Duration(need*float64(rule.Window)) - elapsed
+		}
+	}
+	res.Remaining = int(math.Max(0, float64(rule.Limit)-count))
+	res.Reset = rule.Window - elapsed
+	if e.curr > 0 {
+		res.Reset += rule.Window
+	}
+	e.expires = e.windowStart.Add(2 * rule.Window)
+	return res
+}
+
+func secondsToDuration(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
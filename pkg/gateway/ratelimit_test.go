@@ -0,0 +1,77 @@
+package gateway
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryRateLimitStoreTokenBucket(t *testing.T) {
+	s := NewMemoryRateLimitStore()
+	rule := RateLimitRule{Algorithm: TokenBucket, Limit: 2, Window: time.Second, Burst: 3}
+	now := time.Unix(1000, 0)
+
+	for i := 0; i < 3; i++ {
+		res, _ := s.Take("k", rule, now)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, 2-i, res.Remaining)
+	}
+	res, _ := s.Take("k", rule, now)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 500*time.Millisecond, res.RetryAfter)
+	assert.Equal(t, 1500*time.Millisecond, res.Reset)
+
+	res, _ = s.Take("k", rule, now.Add(500*time.Millisecond))
+	assert.True(t, res.Allowed)
+
+	res, _ = s.Take("other", rule, now)
+	assert.True(t, res.Allowed)
+}
+
+func TestMemoryRateLimitStoreSlidingWindow(t *testing.T) {
+	s := NewMemoryRateLimitStore()
+	rule := RateLimitRule{Algorithm: SlidingWindow, Limit: 4, Window: time.Minute}
+	now := time.Unix(1000, 0)
+
+	for i := 0; i < 4; i++ {
+		res, _ := s.Take("k", rule, now)
+		assert.True(t, res.Allowed)
+	}
+	res, _ := s.Take("k", rule, now.Add(30*time.Second))
+	assert.False(t, res.Allowed)
+
+	// half way into the next window the previous window still counts for half
+	res, _ = s.Take("k", rule, now.Add(90*time.Second))
+	assert.True(t, res.Allowed)
+	res, _ = s.Take("k", rule, now.Add(90*time.Second))
+	assert.True(t, res.Allowed)
+	res, _ = s.Take("k", rule, now.Add(90*time.Second))
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 15*time.Second, res.RetryAfter)
+
+	res, _ = s.Take("k", rule, now.Add(5*time.Minute))
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 3, res.Remaining)
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	r := New()
+	r.Use(RateLimit(RateLimitConfig{Limit: 1, Window: time.Hour, KeyFunc: CombineKeys(KeyByRoute, KeyByClientIP)}))
+	r.POST("/login", func(c *Context) {})
+	r.POST("/other", func(c *Context) {})
+
+	w := performRequest(r, http.MethodPost, "/login")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "1;w=3600", w.Header().Get("RateLimit-Policy"))
+
+	w = performRequest(r, http.MethodPost, "/login")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "3600", w.Header().Get("Retry-After"))
+
+	w = performRequest(r, http.MethodPost, "/other")
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -25,6 +25,36 @@ var (
 // RecoveryFunc defines the function passable to CustomRecovery.
 type RecoveryFunc func(c *Context, err any)
 
+// PanicReporter receives every recovered panic with the stack of the panicking goroutine,
+// e.g. to send it to an error tracking service. It is called before the RecoveryFunc.
+type PanicReporter func(c *Context, err any, stack []byte)
+
+// DefaultRedactedHeaders are the request headers whose values are replaced in the panic
+// log by default.
+var DefaultRedactedHeaders = []string{
+	"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key",
+}
+
+// RecoveryConfig defines the config for Recovery middleware.
+type RecoveryConfig struct {
+	// Output is the writer panics are logged to, nil disables the log.
+	// Optional. Default value is nil.
+	Output io.Writer
+
+	// RedactHeaders are the request headers whose values are not logged.
+	// Optional. Default value is DefaultRedactedHeaders.
+	RedactHeaders []string
+
+	// Handler writes the response after a panic.
+	// Optional. Default value writes a 500 application/problem+json response.
+	Handler RecoveryFunc
+
+	// Reporter is notified of every panic, except for broken connections and
+	// http.ErrAbortHandler.
+	// Optional. Default value is nil.
+	Reporter PanicReporter
+}
+
 // Recovery returns a middleware that recovers from any panics and writes a 500 if there was one.
 func Recovery() HandlerFunc {
 	return RecoveryWithWriter(DefaultErrorWriter)
@@ -38,66 +68,113 @@ func RecoveryWithWriter(out io.Writer, recovery ...RecoveryFunc) HandlerFunc {
 	return CustomRecoveryWithWriter(out, defaultHandleRecovery)
 }
 
-func defaultHandleRecovery(gctx *Context, err any) {
-	gctx.AbortWithStatus(http.StatusInternalServerError)
+// defaultHandleRecovery responds with a 500 problem, unless the handler already started
+// the response.
+func defaultHandleRecovery(c *Context, err any) {
+	if c.Writer.Written() {
+		c.Abort()
+		return
+	}
+	c.AbortWithProblem(NewProblem(http.StatusInternalServerError))
 }
 
 // CustomRecoveryWithWriter returns a middleware for a given writer that recovers from any panics and calls the provided handle func to handle it.
 func CustomRecoveryWithWriter(out io.Writer, handle RecoveryFunc) HandlerFunc {
+	return RecoveryWithConfig(RecoveryConfig{Output: out, Handler: handle})
+}
+
+// RecoveryWithConfig returns a middleware that recovers from any panics, logs and reports
+// them and calls conf.Handler to respond.
+//
+// A panic with http.ErrAbortHandler is neither logged nor reported, the middleware
+// aborts the chain and panics again so that net/http aborts the response, as it would
+// without the middleware.
+func RecoveryWithConfig(conf RecoveryConfig) HandlerFunc {
 	var logger *log.Logger
-	if out != nil {
-		logger = log.New(out, "\n\n\x1b[31m", log.LstdFlags)
+	if conf.Output != nil {
+		logger = log.New(conf.Output, "\n\n\x1b[31m", log.LstdFlags)
+	}
+	if conf.RedactHeaders == nil {
+		conf.RedactHeaders = DefaultRedactedHeaders
+	}
+	handle := conf.Handler
+	if handle == nil {
+		handle = defaultHandleRecovery
 	}
 	return func(gctx *Context) {
 		defer func() {
-			if err := recover(); err != nil {
-				// Check for a broken connection, as it is not really a
-				// condition that warrants a panic stack trace.
-				var brokenPipe bool
-				if ne, ok := err.(*net.OpError); ok {
-					var se *os.SyscallError
-					if errors.As(ne, &se) {
-						seStr := strings.ToLower(se.Error())
-						if strings.Contains(seStr, "broken pipe") ||
-							strings.Contains(seStr, "connection reset by peer") {
-							brokenPipe = true
-						}
-					}
-				}
-				if logger != nil {
-					stack := stack(3)
-					httpRequest, _ := httputil.DumpRequest(gctx.Request, false)
-					headers := strings.Split(string(httpRequest), "\r\n")
-					for idx, header := range headers {
-						current := strings.Split(header, ":")
-						if current[0] == "Authorization" {
-							headers[idx] = current[0] + ": *"
-						}
-					}
-					headersToStr := strings.Join(headers, "\r\n")
-					if brokenPipe {
-						logger.Printf("%s\n%s%s", err, headersToStr, reset)
-					} else if IsDebugging() {
-						logger.Printf("[Recovery] %s panic recovered:\n%s\n%s\n%s%s",
-							timeFormat(time.Now()), headersToStr, err, stack, reset)
-					} else {
-						logger.Printf("[Recovery] %s panic recovered:\n%s\n%s%s",
-							timeFormat(time.Now()), err, stack, reset)
+			err := recover()
+			if err == nil {
+				return
+			}
+			if err == http.ErrAbortHandler {
+				gctx.Abort()
+				panic(err)
+			}
+			// Check for a broken connection, as it is not really a
+			// condition that warrants a panic stack trace.
+			var brokenPipe bool
+			if ne, ok := err.(*net.OpError); ok {
+				var se *os.SyscallError
+				if errors.As(ne, &se) {
+					seStr := strings.ToLower(se.Error())
+					if strings.Contains(seStr, "broken pipe") ||
+						strings.Contains(seStr, "connection reset by peer") {
+						brokenPipe = true
 					}
 				}
+			}
+			var stk []byte
+			if !brokenPipe && (logger != nil || conf.Reporter != nil) {
+				stk = stack(3)
+			}
+			if logger != nil {
+				headersToStr := dumpRequestHeaders(gctx.Request, conf.RedactHeaders)
 				if brokenPipe {
-					// If the connection is dead, we can't write a status to it.
-					gctx.Error(err.(error)) //nolint: errcheck
-					gctx.Abort()
+					logger.Printf("%s\n%s%s", err, headersToStr, reset)
+				} else if IsDebugging() {
+					logger.Printf("[Recovery] %s panic recovered:\n%s\n%s\n%s%s",
+						timeFormat(time.Now()), headersToStr, err, stk, reset)
 				} else {
-					handle(gctx, err)
+					logger.Printf("[Recovery] %s panic recovered:\n%s\n%s%s",
+						timeFormat(time.Now()), err, stk, reset)
 				}
 			}
+			if brokenPipe {
+				// If the connection is dead, we can't write a status to it.
+				gctx.Error(err.(error)) //nolint: errcheck
+				gctx.Abort()
+				return
+			}
+			if conf.Reporter != nil {
+				conf.Reporter(gctx, err, stk)
+			}
+			handle(gctx, err)
 		}()
 		gctx.Next()
 	}
 }
 
+// dumpRequestHeaders returns the request line and headers of req with the values of the
+// redacted headers replaced.
+func dumpRequestHeaders(req *http.Request, redact []string) string {
+	httpRequest, _ := httputil.DumpRequest(req, false)
+	headers := strings.Split(string(httpRequest), "\r\n")
+	for idx, header := range headers {
+		name, _, ok := strings.Cut(header, ":")
+		if !ok {
+			continue
+		}
+		for _, h := range redact {
+			if strings.EqualFold(name, h) {
+				headers[idx] = name + ": *"
+				break
+			}
+		}
+	}
+	return strings.Join(headers, "\r\n")
+}
+
 // stack returns a nicely formatted stack frame, skipping skip frames.
 func stack(skip int) []byte {
 	buf := new(bytes.Buffer) // the returned data
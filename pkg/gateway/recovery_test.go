@@ -0,0 +1,87 @@
+package gateway
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/idproxy/gateway/internal/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecoveryProblem(t *testing.T) {
+	var out bytes.Buffer
+	var reported any
+	var reportedStack []byte
+	r := New()
+	r.Use(RequestID(RequestIDConfig{}), RecoveryWithConfig(RecoveryConfig{
+		Output: &out,
+		Reporter: func(c *Context, err any, stack []byte) {
+			reported, reportedStack = err, stack
+		},
+	}))
+	r.GET("/panic", func(c *Context) {
+		panic("boom")
+	})
+
+	w := performRequestWithHeader(r, http.MethodGet, "/panic", http.Header{
+		"Authorization": {"Bearer secret-token"},
+		"Cookie":        {"session=secret-cookie"},
+		"X-Api-Key":     {"secret-key"},
+		"X-Tenant":      {"acme"},
+	})
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+
+	var problem map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Equal(t, "about:blank", problem["type"])
+	assert.Equal(t, "Internal Server Error", problem["title"])
+	assert.EqualValues(t, 500, problem["status"])
+	assert.Equal(t, w.Header().Get("X-Request-ID"), problem["request_id"])
+
+	assert.Equal(t, "boom", reported)
+	assert.Contains(t, string(reportedStack), "recovery_test.go")
+
+	SetMode(DebugMode)
+	defer SetMode(TestMode)
+	out.Reset()
+	performRequestWithHeader(r, http.MethodGet, "/panic", http.Header{"Cookie": {"session=secret-cookie"}, "X-Tenant": {"acme"}})
+	assert.Contains(t, out.String(), "Cookie: *")
+	assert.Contains(t, out.String(), "X-Tenant: acme")
+	assert.NotContains(t, out.String(), "Cookie: session=")
+}
+
+func TestRecoveryAbortHandler(t *testing.T) {
+	var out bytes.Buffer
+	reported := false
+	r := New()
+	r.Use(RecoveryWithConfig(RecoveryConfig{
+		Output:   &out,
+		Reporter: func(*Context, any, []byte) { reported = true },
+	}))
+	r.GET("/abort", func(c *Context) {
+		panic(http.ErrAbortHandler)
+	})
+
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		performRequest(r, http.MethodGet, "/abort")
+	})
+	assert.False(t, reported)
+	assert.Zero(t, out.Len())
+}
+
+func TestProblemExtensions(t *testing.T) {
+	p := NewProblem(http.StatusConflict)
+	p.Detail = "already exists"
+	p.Extensions = map[string]any{"resource": "user", "status": 200}
+	b, err := json.Marshal(p)
+	require.NoError(t, err)
+
+	var members map[string]any
+	require.NoError(t, json.Unmarshal(b, &members))
+	assert.Equal(t, "user", members["resource"])
+	assert.EqualValues(t, http.StatusConflict, members["status"])
+	assert.Equal(t, "already exists", members["detail"])
+}
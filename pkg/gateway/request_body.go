@@ -0,0 +1,221 @@
+package gateway
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+var (
+	// ErrBodyTooLarge is returned when reading a request body over its limit.
+	ErrBodyTooLarge = errors.New("request body too large")
+	// ErrUnsupportedEncoding is recorded when a request body uses an unknown Content-Encoding.
+	ErrUnsupportedEncoding = errors.New("unsupported content encoding")
+	// ErrMalformedBody is recorded when a compressed request body can not be decoded.
+	ErrMalformedBody = errors.New("malformed request body")
+)
+
+// bodyLimiter is implemented by request bodies enforcing a size limit.
+type bodyLimiter interface {
+	limitExceeded() (limit int64, exceeded bool)
+}
+
+// limitedBody limits the number of bytes read from a request body.
+type limitedBody struct {
+	io.ReadCloser
+	limit    int64
+	read     int64
+	exceeded bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.exceeded {
+		return 0, ErrBodyTooLarge
+	}
+	if rest := b.limit - b.read + 1; int64(len(p)) > rest {
+		p = p[:rest]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	if b.read > b.limit {
+		b.exceeded = true
+		return n - int(b.read-b.limit), ErrBodyTooLarge
+	}
+	return n, err
+}
+
+func (b *limitedBody) limitExceeded() (int64, bool) {
+	return b.limit, b.exceeded
+}
+
+// BodyLimit returns a middleware limiting request bodies to n bytes. Requests declaring a
+// larger Content-Length are aborted right away, otherwise reading past the limit fails
+// with ErrBodyTooLarge. Either way the client gets a 413 problem response unless a
+// handler already responded.
+//
+// BodyLimit replaces Gateway.MaxBodyBytes or the limit of an outer group, so a group can
+// allow larger uploads than the rest of the gateway.
+func BodyLimit(n int64) HandlerFunc {
+	assert1(n > 0, "body limit: limit must be positive")
+	return func(c *Context) {
+		if c.Request.ContentLength > n {
+			abortBodyTooLarge(c, n)
+			return
+		}
+		limitBody(c, n)
+		c.Next()
+		checkBodyLimit(c)
+	}
+}
+
+// limitBody installs a limit of n bytes on the request body, replacing an earlier limit
+// as long as nothing was read yet.
+func limitBody(c *Context, n int64) {
+	if c.Request.Body == nil || c.Request.Body == http.NoBody {
+		return
+	}
+	if b, ok := c.Request.Body.(*limitedBody); ok && b.read == 0 {
+		b.limit = n
+		return
+	}
+	c.Request.Body = &limitedBody{ReadCloser: c.Request.Body, limit: n}
+}
+
+// checkBodyLimit responds with 413 if the chain read past the limit of the body without
+// responding itself.
+func checkBodyLimit(c *Context) {
+	b, ok := c.Request.Body.(bodyLimiter)
+	if !ok {
+		return
+	}
+	if limit, exceeded := b.limitExceeded(); exceeded && !c.Writer.Written() {
+		abortBodyTooLarge(c, limit)
+	}
+}
+
+// bodyLimitHandler identifies the handlers returned by BodyLimit, which all share the
+// code of the same closure.
+var bodyLimitHandler = reflect.ValueOf(BodyLimit(1)).Pointer()
+
+// declaredBodyTooLarge reports whether the request declares a body over the limit of the
+// gateway that no BodyLimit in the chain may raise.
+func declaredBodyTooLarge(c *Context, limit int64) bool {
+	if c.Request.ContentLength <= limit {
+		return false
+	}
+	for _, h := range c.handlers {
+		if reflect.ValueOf(h).Pointer() == bodyLimitHandler {
+			return false
+		}
+	}
+	return true
+}
+
+// abortBodyTooLarge aborts with ErrBodyTooLarge, rendered as a problem the way
+// ErrorHandler does with DefaultProblemRegistry, since the limit may be enforced after
+// the chain or outside of it.
+func abortBodyTooLarge(c *Context, limit int64) {
+	c.Header("Connection", "close")
+	_ = c.AbortWithError(http.StatusRequestEntityTooLarge, &Error{Err: ErrBodyTooLarge, Type: ErrorTypePublic, Meta: map[string]any{"limit": limit}})
+	c.AbortWithProblem(problemFor(c, DefaultProblemRegistry))
+}
+
+// DecompressConfig defines the config for Decompress middleware.
+type DecompressConfig struct {
+	// MaxDecodedBytes limits the size of a decoded body, so that a small compressed body
+	// can not expand without bounds.
+	// Optional. Default value is 10 MiB.
+	MaxDecodedBytes int64
+}
+
+// Decompress returns a middleware decoding request bodies sent with a gzip or deflate
+// Content-Encoding. Handlers read the decoded body, Content-Encoding and Content-Length
+// are removed from the request. Reading more than MaxDecodedBytes fails with
+// ErrBodyTooLarge and results in a 413 like BodyLimit. Unknown encodings are rejected
+// with 415 and malformed bodies with 400.
+func Decompress(conf DecompressConfig) HandlerFunc {
+	if conf.MaxDecodedBytes <= 0 {
+		conf.MaxDecodedBytes = 10 << 20
+	}
+	return func(c *Context) {
+		encoding := strings.ToLower(strings.TrimSpace(c.GetHeader("Content-Encoding")))
+		if encoding == "" || encoding == "identity" {
+			return
+		}
+		if c.Request.Body == nil || c.Request.Body == http.NoBody {
+			c.Request.Header.Del("Content-Encoding")
+			return
+		}
+
+		var decoder io.ReadCloser
+		var err error
+		switch encoding {
+		case "gzip", "x-gzip":
+			decoder, err = gzip.NewReader(c.Request.Body)
+		case "deflate":
+			decoder, err = newDeflateReader(c.Request.Body)
+		default:
+			c.Header("Accept-Encoding", "gzip, deflate")
+			_ = c.AbortWithError(http.StatusUnsupportedMediaType, &Error{Err: ErrUnsupportedEncoding, Type: ErrorTypePublic, Meta: encoding})
+			return
+		}
+		if err != nil {
+			_ = c.Error(err)
+			_ = c.AbortWithError(http.StatusBadRequest, &Error{Err: ErrMalformedBody, Type: ErrorTypePublic})
+			return
+		}
+
+		c.Request.Body = &decodedBody{
+			limitedBody: limitedBody{ReadCloser: decoder, limit: conf.MaxDecodedBytes},
+			src:         c.Request.Body,
+		}
+		c.Request.Header.Del("Content-Encoding")
+		c.Request.Header.Del("Content-Length")
+		c.Request.ContentLength = -1
+		c.Next()
+		checkBodyLimit(c)
+	}
+}
+
+// newDeflateReader decodes the deflate content coding, which is zlib framed deflate but
+// sent as raw deflate by some clients.
+func newDeflateReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(2)
+	if err != nil {
+		return nil, err
+	}
+	if header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
+
+// decodedBody is a decompressed request body limited to its decoded size.
+type decodedBody struct {
+	limitedBody
+	src io.ReadCloser
+}
+
+func (b *decodedBody) Close() error {
+	err := b.limitedBody.Close()
+	if srcErr := b.src.Close(); err == nil {
+		err = srcErr
+	}
+	return err
+}
+
+func (b *decodedBody) limitExceeded() (int64, bool) {
+	if src, ok := b.src.(bodyLimiter); ok {
+		if limit, exceeded := src.limitExceeded(); exceeded {
+			return limit, true
+		}
+	}
+	return b.limitedBody.limitExceeded()
+}
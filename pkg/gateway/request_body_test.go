@@ -0,0 +1,115 @@
+package gateway
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func compressBody(t *testing.T, encoding string, body []byte) *bytes.Buffer {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	if encoding == "gzip" {
+		w = gzip.NewWriter(&buf)
+	} else {
+		w = zlib.NewWriter(&buf)
+	}
+	_, err := w.Write(body)
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	return &buf
+}
+
+func echoBody(c *Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.String(http.StatusOK, "%s", body)
+}
+
+func TestDecompress(t *testing.T) {
+	r := New()
+	r.Use(Decompress(DecompressConfig{MaxDecodedBytes: 1024}))
+	r.POST("/echo", echoBody)
+
+	for _, encoding := range []string{"gzip", "deflate"} {
+		req := httptest.NewRequest(http.MethodPost, "/echo", compressBody(t, encoding, []byte("hello")))
+		req.Header.Set("Content-Encoding", encoding)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code, encoding)
+		assert.Equal(t, "hello", w.Body.String(), encoding)
+	}
+
+	// a tiny body expanding past the limit
+	req := httptest.NewRequest(http.MethodPost, "/echo", compressBody(t, "gzip", make([]byte, 1<<20)))
+	req.Header.Set("Content-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"type":"about:blank","title":"Request Entity Too Large","status":413,"detail":"request body too large","limit":1024}`, w.Body.String())
+
+	req = httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader("hello"))
+	req.Header.Set("Content-Encoding", "br")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader("hello"))
+	req.Header.Set("Content-Encoding", "gzip")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestBodyLimit(t *testing.T) {
+	r := New()
+	r.MaxBodyBytes = 8
+	r.POST("/small", echoBody)
+	r.Group("/upload", BodyLimit(16)).POST("", echoBody)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/small", strings.NewReader("12345678")))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// the global limit applies while reading chunked bodies
+	req := httptest.NewRequest(http.MethodPost, "/small", strings.NewReader("123456789"))
+	req.ContentLength = -1
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Equal(t, "close", w.Header().Get("Connection"))
+
+	// the group raises the limit
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader("0123456789abcdef")))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0123456789abcdef", w.Body.String())
+
+	// a declared Content-Length is rejected before the handler runs
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader("0123456789abcdefg")))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.JSONEq(t, `{"type":"about:blank","title":"Request Entity Too Large","status":413,"detail":"request body too large","limit":16}`, w.Body.String())
+
+	// so is a Content-Length over the global limit
+	called := false
+	r.POST("/checked", func(c *Context) { called = true })
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/checked", strings.NewReader("123456789")))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Equal(t, "close", w.Header().Get("Connection"))
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"type":"about:blank","title":"Request Entity Too Large","status":413,"detail":"request body too large","limit":8}`, w.Body.String())
+	assert.False(t, called)
+}
@@ -0,0 +1,202 @@
+package gateway
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+const (
+	// RequestIDKey is the key the request ID is stored under in Context.Keys.
+	RequestIDKey = "gateway/request_id"
+	// TraceContextKey is the key the TraceContext is stored under in Context.Keys.
+	TraceContextKey = "gateway/trace_context"
+)
+
+// ErrInvalidTraceparent is returned when a traceparent header can not be parsed.
+var ErrInvalidTraceparent = errors.New("invalid traceparent")
+
+// TraceContext is a W3C Trace Context (https://www.w3.org/TR/trace-context/). SpanID
+// identifies the span of the gateway, ParentID the span of the caller, if any.
+type TraceContext struct {
+	TraceID  [16]byte
+	SpanID   [8]byte
+	ParentID [8]byte
+	Flags    byte
+	// State is the vendor specific tracestate header, passed on unchanged.
+	State string
+}
+
+// ParseTraceparent parses a traceparent header into a TraceContext whose ParentID is the
+// span of the caller. The SpanID of the result is not set.
+func ParseTraceparent(header string) (TraceContext, error) {
+	var tc TraceContext
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return tc, ErrInvalidTraceparent
+	}
+	// future versions may append fields, version 00 must have exactly four
+	if parts[0] == "00" && len(parts) != 4 {
+		return tc, ErrInvalidTraceparent
+	}
+	var version, flags [1]byte
+	if !decodeHexField(version[:], parts[0]) || !decodeHexField(tc.TraceID[:], parts[1]) ||
+		!decodeHexField(tc.ParentID[:], parts[2]) || !decodeHexField(flags[:], parts[3]) {
+		return tc, ErrInvalidTraceparent
+	}
+	if tc.TraceID == ([16]byte{}) || tc.ParentID == ([8]byte{}) {
+		return tc, ErrInvalidTraceparent
+	}
+	tc.Flags = flags[0]
+	return tc, nil
+}
+
+// decodeHexField decodes lower case hex of exactly the length of dst.
+func decodeHexField(dst []byte, s string) bool {
+	if len(s) != 2*len(dst) || strings.ToLower(s) != s {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
+
+// NewTraceContext starts a new sampled trace.
+func NewTraceContext() TraceContext {
+	tc := TraceContext{Flags: 1}
+	randomBytes(tc.TraceID[:])
+	randomBytes(tc.SpanID[:])
+	return tc
+}
+
+// Child returns the context of a new span below the span of tc.
+func (tc TraceContext) Child() TraceContext {
+	child := tc
+	child.ParentID = tc.SpanID
+	randomBytes(child.SpanID[:])
+	return child
+}
+
+// TraceIDString returns the trace ID as 32 hex characters.
+func (tc TraceContext) TraceIDString() string {
+	return hex.EncodeToString(tc.TraceID[:])
+}
+
+// SpanIDString returns the span ID as 16 hex characters.
+func (tc TraceContext) SpanIDString() string {
+	return hex.EncodeToString(tc.SpanID[:])
+}
+
+// ParentIDString returns the parent span ID as 16 hex characters, empty for a root span.
+func (tc TraceContext) ParentIDString() string {
+	if tc.ParentID == ([8]byte{}) {
+		return ""
+	}
+	return hex.EncodeToString(tc.ParentID[:])
+}
+
+// Sampled reports whether the caller may record the trace.
+func (tc TraceContext) Sampled() bool {
+	return tc.Flags&1 == 1
+}
+
+// Traceparent returns the traceparent header announcing the span of tc.
+func (tc TraceContext) Traceparent() string {
+	return "00-" + tc.TraceIDString() + "-" + tc.SpanIDString() + "-" + hex.EncodeToString([]byte{tc.Flags})
+}
+
+func randomBytes(b []byte) {
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+}
+
+// RequestIDConfig defines the config for RequestID middleware.
+type RequestIDConfig struct {
+	// Header is the request and response header carrying the request ID.
+	// Optional. Default value is "X-Request-ID".
+	Header string
+
+	// Generator returns new request IDs.
+	// Optional. Default value returns 32 random hex characters.
+	Generator func() string
+
+	// IgnoreIncoming always generates a new request ID instead of accepting the one sent
+	// by the client.
+	// Optional. Default value is false.
+	IgnoreIncoming bool
+}
+
+const maxRequestIDLength = 128
+
+// RequestID returns a middleware correlating requests across services. It accepts the
+// request ID sent by the client, if valid, or generates one, and joins the trace of the
+// traceparent and tracestate headers with a span of its own, or starts a new trace.
+// Both are stored in Context.Keys, echoed on the response and set on the request, so
+// that proxied requests carry them upstream.
+func RequestID(conf RequestIDConfig) HandlerFunc {
+	if conf.Header == "" {
+		conf.Header = "X-Request-ID"
+	}
+	if conf.Generator == nil {
+		conf.Generator = func() string {
+			var b [16]byte
+			randomBytes(b[:])
+			return hex.EncodeToString(b[:])
+		}
+	}
+
+	return func(c *Context) {
+		id := c.GetHeader(conf.Header)
+		if conf.IgnoreIncoming || !validRequestID(id) {
+			id = conf.Generator()
+			c.Request.Header.Set(conf.Header, id)
+		}
+		c.Set(RequestIDKey, id)
+		c.Header(conf.Header, id)
+
+		tc := c.TraceContext()
+		c.Request.Header.Set("traceparent", tc.Traceparent())
+		c.Header("traceparent", tc.Traceparent())
+		if tc.State != "" {
+			c.Header("tracestate", tc.State)
+		}
+	}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// RequestID returns the request ID set by the RequestID middleware.
+func (c *Context) RequestID() string {
+	return c.GetString(RequestIDKey)
+}
+
+// TraceContext returns the trace context of the request. On first use it is taken from
+// the traceparent and tracestate headers, with a new span for the gateway, or a new
+// trace is started, and stored in Context.Keys.
+func (c *Context) TraceContext() TraceContext {
+	if v, ok := c.Get(TraceContextKey); ok {
+		if tc, ok := v.(TraceContext); ok {
+			return tc
+		}
+	}
+	tc, err := ParseTraceparent(c.GetHeader("traceparent"))
+	if err == nil {
+		randomBytes(tc.SpanID[:])
+		tc.State = strings.Join(c.Request.Header.Values("tracestate"), ",")
+	} else {
+		tc = NewTraceContext()
+	}
+	c.Set(TraceContextKey, tc)
+	return tc
+}
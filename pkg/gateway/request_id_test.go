@@ -0,0 +1,71 @@
+package gateway
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tc, err := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	require.NoError(t, err)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", tc.TraceIDString())
+	assert.Equal(t, "00f067aa0ba902b7", tc.ParentIDString())
+	assert.True(t, tc.Sampled())
+
+	for _, header := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+	} {
+		_, err := ParseTraceparent(header)
+		assert.ErrorIs(t, err, ErrInvalidTraceparent, header)
+	}
+
+	// future versions may carry more fields
+	_, err = ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra")
+	assert.NoError(t, err)
+}
+
+func TestRequestID(t *testing.T) {
+	var out bytes.Buffer
+	var upstream http.Header
+	r := New()
+	r.Use(LoggerWithConfig(LoggerConfig{Output: &out}), RequestID(RequestIDConfig{}))
+	r.GET("/", func(c *Context) {
+		upstream = c.Request.Header.Clone()
+	})
+
+	w := performRequest(r, http.MethodGet, "/")
+	id := w.Header().Get("X-Request-ID")
+	assert.Len(t, id, 32)
+	assert.Equal(t, id, upstream.Get("X-Request-ID"))
+	assert.Contains(t, out.String(), id)
+	tc, err := ParseTraceparent(w.Header().Get("traceparent"))
+	require.NoError(t, err)
+	assert.Equal(t, w.Header().Get("traceparent"), upstream.Get("traceparent"))
+	assert.True(t, tc.Sampled())
+
+	w = performRequestWithHeader(r, http.MethodGet, "/", http.Header{
+		"X-Request-Id": {"req-1"},
+		"Traceparent":  {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"},
+		"Tracestate":   {"vendor=1"},
+	})
+	assert.Equal(t, "req-1", w.Header().Get("X-Request-ID"))
+	assert.Equal(t, "vendor=1", w.Header().Get("tracestate"))
+	tc, err = ParseTraceparent(w.Header().Get("traceparent"))
+	require.NoError(t, err)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", tc.TraceIDString())
+	assert.NotEqual(t, "00f067aa0ba902b7", tc.ParentIDString())
+	assert.False(t, tc.Sampled())
+
+	w = performRequestWithHeader(r, http.MethodGet, "/", http.Header{"X-Request-Id": {"bad id\n"}})
+	assert.Len(t, w.Header().Get("X-Request-ID"), 32)
+}
@@ -1,6 +1,12 @@
 package gateway
 
-import "net/http"
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+)
 
 const (
 	noWritten     = -1
@@ -9,6 +15,8 @@ const (
 
 type ResponseWriter interface {
 	http.ResponseWriter
+	http.Hijacker
+	http.Flusher
 
 	// Status returns the HTTP response status code of the current request.
 	Status() int
@@ -17,6 +25,9 @@ type ResponseWriter interface {
 	// See Written()
 	Size() int
 
+	// WriteString writes the string into the response body.
+	WriteString(string) (int, error)
+
 	// Written returns true if the response body was already written.
 	Written() bool
 
@@ -38,6 +49,30 @@ func (w *responseWriter) reset(writer http.ResponseWriter) {
 	w.status = defaultStatus
 }
 
+func (w *responseWriter) WriteHeader(code int) {
+	if code > 0 && w.status != code {
+		if w.Written() {
+			debugPrint("[WARNING] Headers were already written. Wanted to override status code %d with %d", w.status, code)
+			return
+		}
+		w.status = code
+	}
+}
+
+func (w *responseWriter) Write(data []byte) (n int, err error) {
+	w.WriteHeaderNow()
+	n, err = w.ResponseWriter.Write(data)
+	w.size += n
+	return
+}
+
+func (w *responseWriter) WriteString(s string) (n int, err error) {
+	w.WriteHeaderNow()
+	n, err = io.WriteString(w.ResponseWriter, s)
+	w.size += n
+	return
+}
+
 func (w *responseWriter) Status() int {
 	return w.status
 }
@@ -56,3 +91,23 @@ func (w *responseWriter) WriteHeaderNow() {
 		w.ResponseWriter.WriteHeader(w.status)
 	}
 }
+
+// Hijack implements the http.Hijacker interface.
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("the ResponseWriter doesn't support the Hijacker interface")
+	}
+	if w.size < 0 {
+		w.size = 0
+	}
+	return hijacker.Hijack()
+}
+
+// Flush implements the http.Flusher interface.
+func (w *responseWriter) Flush() {
+	w.WriteHeaderNow()
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -1,7 +1,6 @@
 package gateway
 
 import (
-	"fmt"
 	"net/http"
 )
 
@@ -41,6 +40,7 @@ type RouterGroup struct {
 	basePath string
 	gateway  *Gateway
 	root     bool
+	policies []Policy
 }
 
 func (r *RouterGroup) Use(middleware ...HandlerFunc) Routes {
@@ -55,6 +55,7 @@ func (r *RouterGroup) Group(relativePath string, handlers ...HandlerFunc) *Route
 		handlers: r.combineHandlers(handlers),
 		basePath: r.calculateAbsolutePath(relativePath),
 		gateway:  r.gateway,
+		policies: append([]Policy(nil), r.policies...),
 	}
 }
 
@@ -111,8 +112,14 @@ func (r *RouterGroup) Any(relativePath string, handlers ...HandlerFunc) Routes {
 func (r *RouterGroup) handle(httpMethod, relativePath string, handlers HandlersChain) Routes {
 	absolutePath := r.calculateAbsolutePath(relativePath)
 	handlers = r.combineHandlers(handlers)
-	fmt.Println(absolutePath)
 	r.gateway.addRoute(httpMethod, absolutePath, handlers)
+	if len(r.policies) > 0 {
+		r.gateway.routePolicies = append(r.gateway.routePolicies, RoutePolicy{
+			Method:   httpMethod,
+			Path:     absolutePath,
+			Policies: r.policies,
+		})
+	}
 	return r.returnObj()
 }
 
@@ -126,7 +133,6 @@ func (r *RouterGroup) combineHandlers(handlers HandlersChain) HandlersChain {
 }
 
 func (r *RouterGroup) calculateAbsolutePath(relativePath string) string {
-	fmt.Printf("basePath %s relativePath: %s\n", r.basePath, relativePath)
 	return joinPaths(r.basePath, relativePath)
 }
 
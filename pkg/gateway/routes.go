@@ -0,0 +1,82 @@
+package gateway
+
+import (
+	"io"
+	"sort"
+
+	"github.com/idproxy/gateway/internal/json"
+	"gopkg.in/yaml.v3"
+)
+
+// RouteInfo represents a request route's specification which contains method and path and its handler.
+type RouteInfo struct {
+	Method      string      `json:"method" yaml:"method"`
+	Path        string      `json:"path" yaml:"path"`
+	Handler     string      `json:"handler" yaml:"handler"`
+	HandlerFunc HandlerFunc `json:"-" yaml:"-"`
+}
+
+// RoutesInfo defines a RouteInfo slice.
+type RoutesInfo []RouteInfo
+
+// Routes returns a slice of registered routes, including some useful information, such as:
+// the http method, path and the handler name. Routes are ordered by path and method so
+// that route tables can be compared between releases.
+func (r *Gateway) Routes() RoutesInfo {
+	var routes RoutesInfo
+	r.walkRoutes(func(method, path string, handlers HandlersChain) {
+		handlerFunc := handlers.Last()
+		routes = append(routes, RouteInfo{
+			Method:      method,
+			Path:        path,
+			Handler:     nameOfFunction(handlerFunc),
+			HandlerFunc: handlerFunc,
+		})
+	})
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
+// WriteJSON writes the routes as an indented JSON array.
+func (routes RoutesInfo) WriteJSON(w io.Writer) error {
+	b, err := json.MarshalIndent(routes, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// WriteYAML writes the routes as a YAML sequence.
+func (routes RoutesInfo) WriteYAML(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode([]RouteInfo(routes)); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// walkRoutes calls fn for every registered route, in tree order.
+func (r *Gateway) walkRoutes(fn func(method, path string, handlers HandlersChain)) {
+	for _, tree := range r.trees {
+		walkNode(tree.method, tree.root, fn)
+	}
+}
+
+func walkNode(method string, n *node, fn func(method, path string, handlers HandlersChain)) {
+	if n == nil {
+		return
+	}
+	if len(n.handlers) > 0 {
+		fn(method, n.fullPath, n.handlers)
+	}
+	for _, child := range n.children {
+		walkNode(method, child, fn)
+	}
+}
@@ -0,0 +1,53 @@
+package gateway
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/idproxy/gateway/internal/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func handlerTest1(c *Context) {}
+func handlerTest2(c *Context) {}
+
+func TestRoutes(t *testing.T) {
+	r := New()
+	r.POST("/users", handlerTest2)
+	r.GET("/users/:id", handlerTest1)
+	r.GET("/users", handlerTest1)
+	r.DELETE("/users/:id", handlerTest2)
+	r.Group("/static").GET("/*filepath", handlerTest1)
+
+	routes := r.Routes()
+	expected := []struct{ method, path, handler string }{
+		{http.MethodGet, "/static/*filepath", "handlerTest1"},
+		{http.MethodGet, "/users", "handlerTest1"},
+		{http.MethodPost, "/users", "handlerTest2"},
+		{http.MethodDelete, "/users/:id", "handlerTest2"},
+		{http.MethodGet, "/users/:id", "handlerTest1"},
+	}
+	require.Len(t, routes, len(expected))
+	for i, e := range expected {
+		assert.Equal(t, e.method, routes[i].Method)
+		assert.Equal(t, e.path, routes[i].Path)
+		assert.Equal(t, "github.com/idproxy/gateway/pkg/gateway."+e.handler, routes[i].Handler)
+		assert.NotNil(t, routes[i].HandlerFunc)
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, routes.WriteJSON(&buf))
+	var dumped []map[string]string
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &dumped))
+	assert.Equal(t, map[string]string{
+		"method":  http.MethodGet,
+		"path":    "/static/*filepath",
+		"handler": "github.com/idproxy/gateway/pkg/gateway.handlerTest1",
+	}, dumped[0])
+
+	buf.Reset()
+	require.NoError(t, routes[:1].WriteYAML(&buf))
+	assert.Equal(t, "- method: GET\n  path: /static/*filepath\n  handler: github.com/idproxy/gateway/pkg/gateway.handlerTest1\n", buf.String())
+}
@@ -0,0 +1,380 @@
+package gateway
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/idproxy/gateway/internal/json"
+)
+
+// SessionKey is the Context.Keys key under which the Sessions middleware stores the *Session.
+const SessionKey = "gateway/session"
+
+var (
+	// ErrSessionNotFound is returned by a SessionStore when no session exists for an id.
+	ErrSessionNotFound = errors.New("sessions: session not found")
+	// ErrInvalidCookie is returned when a cookie can not be authenticated by any of the keys.
+	ErrInvalidCookie = errors.New("sessions: invalid cookie")
+	// ErrCookieExpired is returned when a cookie is older than its max age.
+	ErrCookieExpired = errors.New("sessions: cookie expired")
+)
+
+// CookieCodec encrypts and authenticates cookie values with AES-GCM. The first key is
+// used to encode, all keys are tried to decode, so keys can be rotated by prepending a
+// new key and dropping the oldest one once every cookie encoded with it has expired.
+type CookieCodec struct {
+	aeads  []cipher.AEAD
+	maxAge time.Duration
+}
+
+// NewCookieCodec returns a codec for the given keys. Each key must be 16, 24 or 32 bytes
+// long to select AES-128, AES-192 or AES-256. Values older than maxAge are rejected,
+// a maxAge of 0 disables the check.
+func NewCookieCodec(maxAge time.Duration, keys ...[]byte) (*CookieCodec, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("sessions: at least one key is required")
+	}
+	codec := &CookieCodec{maxAge: maxAge}
+	for _, key := range keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		codec.aeads = append(codec.aeads, aead)
+	}
+	return codec, nil
+}
+
+// Encode encrypts value for the cookie with the given name. The name is authenticated
+// so a value can not be replayed under another cookie name.
+func (cc *CookieCodec) Encode(name string, value []byte) (string, error) {
+	aead := cc.aeads[0]
+	plain := make([]byte, 8+len(value))
+	binary.BigEndian.PutUint64(plain, uint64(time.Now().Unix()))
+	copy(plain[8:], value)
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plain)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, plain, []byte(name))
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// Decode authenticates and decrypts a value produced by Encode.
+func (cc *CookieCodec) Decode(name, value string) ([]byte, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCookie
+	}
+	for _, aead := range cc.aeads {
+		if len(sealed) < aead.NonceSize() {
+			continue
+		}
+		plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(name))
+		if err != nil || len(plain) < 8 {
+			continue
+		}
+		issued := time.Unix(int64(binary.BigEndian.Uint64(plain)), 0)
+		if cc.maxAge > 0 && time.Since(issued) > cc.maxAge {
+			return nil, ErrCookieExpired
+		}
+		return plain[8:], nil
+	}
+	return nil, ErrInvalidCookie
+}
+
+// SessionStore keeps session values on the server side. The session cookie then only
+// carries the encrypted session id.
+type SessionStore interface {
+	// Get returns the values of the session or ErrSessionNotFound.
+	Get(ctx context.Context, id string) (map[string]any, error)
+	// Set stores the values of the session for ttl.
+	Set(ctx context.Context, id string, values map[string]any, ttl time.Duration) error
+	// Delete removes the session.
+	Delete(ctx context.Context, id string) error
+}
+
+// SessionsConfig defines the config for Sessions middleware.
+type SessionsConfig struct {
+	// Name of the session cookie.
+	// Optional. Default value is "gateway_sid".
+	Name string
+
+	// Keys used to encrypt the session cookie, newest first. See CookieCodec.
+	Keys [][]byte
+
+	// Store keeps the session values on the server side.
+	// Optional. When nil the values are kept in the encrypted cookie itself.
+	Store SessionStore
+
+	// MaxAge is the lifetime of a session.
+	// Optional. Default value is 24 hours.
+	MaxAge time.Duration
+
+	// Cookie attributes. HttpOnly is always set.
+	Path     string
+	Domain   string
+	Secure   bool
+	SameSite http.SameSite
+}
+
+// Session holds the values of the current session. Values go through a JSON round
+// trip, so numbers read back from a saved session are float64.
+type Session struct {
+	id      string
+	values  map[string]any
+	isNew   bool
+	manager *sessionManager
+	c       *Context
+}
+
+type sessionManager struct {
+	config SessionsConfig
+	codec  *CookieCodec
+}
+
+// Sessions returns a middleware that loads the session of the request and makes it
+// available through Context.Session. Changes must be persisted with Session.Save
+// before the response is written.
+func Sessions(conf SessionsConfig) HandlerFunc {
+	if conf.Name == "" {
+		conf.Name = "gateway_sid"
+	}
+	if conf.MaxAge <= 0 {
+		conf.MaxAge = 24 * time.Hour
+	}
+	if conf.SameSite == 0 {
+		conf.SameSite = http.SameSiteLaxMode
+	}
+	codec, err := NewCookieCodec(conf.MaxAge, conf.Keys...)
+	if err != nil {
+		panic(err)
+	}
+	m := &sessionManager{config: conf, codec: codec}
+
+	return func(c *Context) {
+		c.Set(SessionKey, m.load(c))
+	}
+}
+
+func (m *sessionManager) load(c *Context) *Session {
+	s := &Session{manager: m, c: c, isNew: true}
+	value, err := c.Cookie(m.config.Name)
+	if err != nil {
+		return s
+	}
+	raw, err := m.codec.Decode(m.config.Name, value)
+	if err != nil {
+		debugPrint("sessions: dropping cookie %s: %v", m.config.Name, err)
+		return s
+	}
+
+	if m.config.Store == nil {
+		if err := json.Unmarshal(raw, &s.values); err != nil {
+			return s
+		}
+		s.isNew = false
+		return s
+	}
+
+	values, err := m.config.Store.Get(c.Request.Context(), string(raw))
+	if err != nil {
+		if !errors.Is(err, ErrSessionNotFound) {
+			_ = c.Error(err)
+		}
+		return s
+	}
+	s.id, s.values, s.isNew = string(raw), values, false
+	return s
+}
+
+func (m *sessionManager) setCookie(c *Context, value string, maxAge int) {
+	c.SetCookieData(&http.Cookie{
+		Name:     m.config.Name,
+		Value:    value,
+		MaxAge:   maxAge,
+		Path:     m.config.Path,
+		Domain:   m.config.Domain,
+		SameSite: m.config.SameSite,
+		Secure:   m.config.Secure,
+		HttpOnly: true,
+	})
+}
+
+// Session returns the session loaded by the Sessions middleware. It panics when the
+// middleware is not installed.
+func (c *Context) Session() *Session {
+	v, ok := c.Get(SessionKey)
+	if !ok {
+		panic("sessions: Sessions middleware is not installed")
+	}
+	return v.(*Session)
+}
+
+// ID returns the server side id of the session. It is empty for cookie-only sessions
+// and for new sessions that were not saved yet.
+func (s *Session) ID() string {
+	return s.id
+}
+
+// IsNew returns true if the request did not carry a valid session.
+func (s *Session) IsNew() bool {
+	return s.isNew
+}
+
+// Get returns the value stored under key.
+func (s *Session) Get(key string) (value any, exists bool) {
+	value, exists = s.values[key]
+	return
+}
+
+// Set stores value under key. The change is persisted by Save.
+func (s *Session) Set(key string, value any) {
+	if s.values == nil {
+		s.values = make(map[string]any)
+	}
+	s.values[key] = value
+}
+
+// Delete removes the value stored under key. The change is persisted by Save.
+func (s *Session) Delete(key string) {
+	delete(s.values, key)
+}
+
+// Regenerate assigns a new id to the session, keeping its values. It should be called
+// when the privilege level changes, e.g. on login, to prevent session fixation.
+func (s *Session) Regenerate() error {
+	if s.manager.config.Store != nil && s.id != "" {
+		if err := s.manager.config.Store.Delete(s.c.Request.Context(), s.id); err != nil {
+			return err
+		}
+	}
+	s.id = ""
+	return nil
+}
+
+// Save persists the session and writes the session cookie.
+func (s *Session) Save() error {
+	m := s.manager
+	var raw []byte
+	if m.config.Store == nil {
+		b, err := json.Marshal(s.values)
+		if err != nil {
+			return err
+		}
+		raw = b
+	} else {
+		if s.id == "" {
+			s.id = randomString(32)
+		}
+		if err := m.config.Store.Set(s.c.Request.Context(), s.id, s.values, m.config.MaxAge); err != nil {
+			return err
+		}
+		raw = []byte(s.id)
+	}
+
+	value, err := m.codec.Encode(m.config.Name, raw)
+	if err != nil {
+		return err
+	}
+	m.setCookie(s.c, value, int(m.config.MaxAge/time.Second))
+	s.isNew = false
+	return nil
+}
+
+// Destroy removes the session from the store and expires the session cookie.
+func (s *Session) Destroy() error {
+	m := s.manager
+	if m.config.Store != nil && s.id != "" {
+		if err := m.config.Store.Delete(s.c.Request.Context(), s.id); err != nil {
+			return err
+		}
+	}
+	s.id, s.values, s.isNew = "", nil, true
+	m.setCookie(s.c, "", -1)
+	return nil
+}
+
+type memorySession struct {
+	values  []byte
+	expires time.Time
+}
+
+// MemorySessionStore is a SessionStore keeping sessions in process memory. Expired
+// sessions are removed lazily.
+type MemorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]memorySession
+	sets     int
+}
+
+var _ SessionStore = (*MemorySessionStore)(nil)
+
+// NewMemorySessionStore returns an empty in-memory session store.
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: make(map[string]memorySession)}
+}
+
+// Get implements SessionStore.
+func (s *MemorySessionStore) Get(_ context.Context, id string) (map[string]any, error) {
+	s.mu.Lock()
+	sess, ok := s.sessions[id]
+	s.mu.Unlock()
+	if !ok || time.Now().After(sess.expires) {
+		return nil, ErrSessionNotFound
+	}
+	var values map[string]any
+	if err := json.Unmarshal(sess.values, &values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// Set implements SessionStore. Values are serialized so that later changes to the map
+// do not leak into the store without Save.
+func (s *MemorySessionStore) Set(_ context.Context, id string, values map[string]any, ttl time.Duration) error {
+	b, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[id] = memorySession{values: b, expires: now.Add(ttl)}
+	if s.sets++; s.sets%1024 == 0 {
+		for k, v := range s.sessions {
+			if now.After(v.expires) {
+				delete(s.sessions, k)
+			}
+		}
+	}
+	return nil
+}
+
+// Delete implements SessionStore.
+func (s *MemorySessionStore) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	delete(s.sessions, id)
+	s.mu.Unlock()
+	return nil
+}
+
+// Len returns the number of sessions held, including expired ones not yet removed.
+func (s *MemorySessionStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sessions)
+}
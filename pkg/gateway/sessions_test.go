@@ -0,0 +1,141 @@
+package gateway
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testSessionKey    = []byte("0123456789abcdef0123456789abcdef")
+	testSessionOldKey = []byte("fedcba9876543210fedcba9876543210")
+)
+
+func TestCookieCodecKeyRotation(t *testing.T) {
+	old, err := NewCookieCodec(0, testSessionOldKey)
+	require.NoError(t, err)
+	rotated, err := NewCookieCodec(0, testSessionKey, testSessionOldKey)
+	require.NoError(t, err)
+	current, err := NewCookieCodec(0, testSessionKey)
+	require.NoError(t, err)
+
+	value, err := old.Encode("sid", []byte("hello"))
+	require.NoError(t, err)
+
+	plain, err := rotated.Decode("sid", value)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(plain))
+
+	_, err = current.Decode("sid", value)
+	assert.ErrorIs(t, err, ErrInvalidCookie)
+
+	_, err = rotated.Decode("other", value)
+	assert.ErrorIs(t, err, ErrInvalidCookie)
+}
+
+func TestCookieCodecRejectsTampering(t *testing.T) {
+	codec, err := NewCookieCodec(time.Hour, testSessionKey)
+	require.NoError(t, err)
+	value, err := codec.Encode("sid", []byte("hello"))
+	require.NoError(t, err)
+
+	b := []byte(value)
+	b[len(b)/2] ^= 1
+	_, err = codec.Decode("sid", string(b))
+	assert.ErrorIs(t, err, ErrInvalidCookie)
+}
+
+func newSessionsTestGateway(store SessionStore) *Gateway {
+	r := New()
+	r.Use(Sessions(SessionsConfig{Keys: [][]byte{testSessionKey}, Store: store}))
+	r.GET("/set", func(c *Context) {
+		s := c.Session()
+		s.Set("user", c.Query("user"))
+		if err := s.Save(); err != nil {
+			_ = c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		c.String(http.StatusOK, "saved")
+	})
+	r.GET("/get", func(c *Context) {
+		user, _ := c.Session().Get("user")
+		c.String(http.StatusOK, "%v", user)
+	})
+	r.GET("/destroy", func(c *Context) {
+		_ = c.Session().Destroy()
+		c.String(http.StatusOK, "destroyed")
+	})
+	return r
+}
+
+func TestSessionsCookieStore(t *testing.T) {
+	r := newSessionsTestGateway(nil)
+
+	w := performRequest(r, http.MethodGet, "/set?user=alice")
+	assert.Equal(t, http.StatusOK, w.Code)
+	cookie := findCookie(w, "gateway_sid")
+	require.NotNil(t, cookie)
+	assert.True(t, cookie.HttpOnly)
+	assert.NotContains(t, cookie.Value, "alice")
+
+	w = performRequest(r, http.MethodGet, "/get", cookie)
+	assert.Equal(t, "alice", w.Body.String())
+
+	w = performRequest(r, http.MethodGet, "/destroy", cookie)
+	assert.Equal(t, -1, findCookie(w, "gateway_sid").MaxAge)
+}
+
+func TestSessionsServerSideStore(t *testing.T) {
+	store := NewMemorySessionStore()
+	r := newSessionsTestGateway(store)
+
+	w := performRequest(r, http.MethodGet, "/set?user=bob")
+	cookie := findCookie(w, "gateway_sid")
+	require.NotNil(t, cookie)
+	assert.Equal(t, 1, store.Len())
+
+	w = performRequest(r, http.MethodGet, "/get", cookie)
+	assert.Equal(t, "bob", w.Body.String())
+
+	performRequest(r, http.MethodGet, "/destroy", cookie)
+	assert.Equal(t, 0, store.Len())
+
+	// the cookie still decrypts but the server side session is gone
+	w = performRequest(r, http.MethodGet, "/get", cookie)
+	assert.Equal(t, "<nil>", w.Body.String())
+}
+
+func TestSessionsCookieAttributes(t *testing.T) {
+	r := New()
+	r.Use(Sessions(SessionsConfig{Keys: [][]byte{testSessionKey}, SameSite: http.SameSiteStrictMode, Secure: true}))
+	// another middleware setting its own cookie after the session was saved
+	after := func(c *Context) {
+		c.Next()
+		c.SetCookie("other", "v", 60, "/", "", false, false)
+	}
+	r.GET("/save", after, func(c *Context) {
+		require.NoError(t, c.Session().Save())
+	})
+	r.GET("/destroy", after, func(c *Context) {
+		require.NoError(t, c.Session().Destroy())
+	})
+
+	w := performRequest(r, http.MethodGet, "/save")
+	cookie := findCookie(w, "gateway_sid")
+	require.NotNil(t, cookie)
+	assert.Equal(t, http.SameSiteStrictMode, cookie.SameSite)
+	assert.True(t, cookie.HttpOnly)
+	assert.True(t, cookie.Secure)
+	assert.Equal(t, http.SameSite(0), findCookie(w, "other").SameSite)
+
+	w = performRequest(r, http.MethodGet, "/destroy", cookie)
+	destroyed := findCookie(w, "gateway_sid")
+	require.NotNil(t, destroyed)
+	assert.Equal(t, -1, destroyed.MaxAge)
+	assert.Equal(t, http.SameSiteStrictMode, destroyed.SameSite)
+	assert.True(t, destroyed.HttpOnly)
+	assert.Equal(t, http.SameSite(0), findCookie(w, "other").SameSite)
+}
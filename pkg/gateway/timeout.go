@@ -0,0 +1,210 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrRequestTimeout is recorded when a request is aborted by Timeout.
+var ErrRequestTimeout = errors.New("request timed out")
+
+const (
+	timeoutRunning int32 = iota
+	timeoutFinished
+	timeoutExpired
+)
+
+// Timeout returns a middleware that aborts the request when the rest of the chain does
+// not finish within d. The chain runs in its own goroutine with a deadline on
+// Request.Context() and a buffered response, so a handler that keeps running after the
+// timeout can not write to the client anymore. onTimeout writes the timeout response,
+// by default a 503.
+//
+// The chain runs on a Context of its own taken from the gateway pool. It is only
+// returned to the pool once the handler goroutine finished, and the Context of the
+// request never reaches that goroutine, so neither is reused while still referenced.
+// Keys and Errors set by the chain are copied back when it finishes in time. When the
+// request is traced, the chain records into a child span of its own, which the goroutine
+// ends, so that a late handler does not change the span of the request once exported.
+//
+// A handler still running after the deadline must stop using Request.Body: the server
+// closes and reuses the connection once the timeout response was sent.
+func Timeout(d time.Duration, onTimeout HandlerFunc) HandlerFunc {
+	assert1(d > 0, "timeout: duration must be positive")
+	if onTimeout == nil {
+		onTimeout = defaultTimeoutHandler
+	}
+
+	return func(c *Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), d)
+		defer cancel()
+
+		tw := &timeoutWriter{header: c.Writer.Header().Clone(), status: c.Writer.Status()}
+		tc := c.forTimeout(c.Request.WithContext(ctx), tw)
+
+		var state int32
+		done := make(chan struct{})
+		panicked := make(chan any, 1)
+		go func() {
+			defer func() {
+				p := recover()
+				// before the state changes, tc may be reused once it did
+				tc.endTimeoutSpan(p != nil)
+				if atomic.CompareAndSwapInt32(&state, timeoutRunning, timeoutFinished) {
+					if p != nil {
+						panicked <- p
+					}
+					close(done)
+					return
+				}
+				// the request already timed out and nobody waits for this context
+				if p != nil {
+					debugPrint("[WARNING] timeout: panic after the request timed out: %v", p)
+				}
+				tc.gateway.releaseContext(tc)
+			}()
+			tc.Next()
+		}()
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			if atomic.CompareAndSwapInt32(&state, timeoutRunning, timeoutExpired) {
+				tw.timeout()
+				c.Abort()
+				onTimeout(c)
+				return
+			}
+			// finished while timing out
+			<-done
+		}
+
+		select {
+		case p := <-panicked:
+			tc.gateway.releaseContext(tc)
+			panic(p)
+		default:
+		}
+		c.finishTimeout(tc, tw)
+		tc.gateway.releaseContext(tc)
+	}
+}
+
+func defaultTimeoutHandler(c *Context) {
+	_ = c.AbortWithError(http.StatusServiceUnavailable, &Error{Err: ErrRequestTimeout, Type: ErrorTypePublic})
+}
+
+// forTimeout returns a pooled Context continuing the chain of c against req and w.
+func (c *Context) forTimeout(req *http.Request, w http.ResponseWriter) *Context {
+	tc := c.gateway.acquireContext()
+	tc.writermem.reset(w)
+	tc.Request = req
+	tc.reset()
+	tc.handlers = c.handlers
+	tc.index = c.index
+	tc.fullPath = c.fullPath
+	*tc.params = append((*tc.params)[:0], c.Params...)
+	tc.Params = *tc.params
+	tc.Accepted = c.Accepted
+	tc.sameSite = c.sameSite
+	if c.span != nil {
+		tc.span = &Span{
+			Name:         "timeout",
+			Kind:         SpanKindInternal,
+			TraceContext: c.span.TraceContext.Child(),
+			Start:        time.Now(),
+		}
+		tc.tracer = c.tracer
+	}
+	c.mu.RLock()
+	if c.Keys != nil {
+		tc.Keys = make(map[string]any, len(c.Keys))
+		for k, v := range c.Keys {
+			tc.Keys[k] = v
+		}
+	}
+	c.mu.RUnlock()
+	return tc
+}
+
+// endTimeoutSpan ends and exports the span of a chain run by Timeout.
+func (c *Context) endTimeoutSpan(panicked bool) {
+	span := c.span
+	if span == nil {
+		return
+	}
+	switch {
+	case panicked:
+		span.SetStatus(SpanStatusError, "panic")
+	case errors.Is(c.Request.Context().Err(), context.DeadlineExceeded):
+		span.SetStatus(SpanStatusError, ErrRequestTimeout.Error())
+	}
+	span.End = time.Now()
+	c.tracer.exporter.ExportSpan(span)
+}
+
+// finishTimeout copies the outcome of a chain that finished in time back to c.
+func (c *Context) finishTimeout(tc *Context, tw *timeoutWriter) {
+	c.mu.Lock()
+	c.Keys = tc.Keys
+	c.mu.Unlock()
+	c.Errors = append(c.Errors, tc.Errors...)
+	c.index = tc.index
+
+	dst := c.Writer.Header()
+	for k := range dst {
+		delete(dst, k)
+	}
+	for k, v := range tw.header {
+		dst[k] = v
+	}
+	c.Status(tw.status)
+	if tw.buf.Len() > 0 {
+		if _, err := c.Writer.Write(tw.buf.Bytes()); err != nil {
+			_ = c.Error(err)
+		}
+	} else if tc.writermem.Written() {
+		c.Writer.WriteHeaderNow()
+	}
+}
+
+// timeoutWriter buffers the response of a chain running under Timeout.
+type timeoutWriter struct {
+	mu       sync.Mutex
+	header   http.Header
+	buf      bytes.Buffer
+	status   int
+	timedOut bool
+}
+
+func (w *timeoutWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *timeoutWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	return w.buf.Write(b)
+}
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.timedOut {
+		w.status = code
+	}
+}
+
+func (w *timeoutWriter) timeout() {
+	w.mu.Lock()
+	w.timedOut = true
+	w.mu.Unlock()
+}
@@ -0,0 +1,93 @@
+package gateway
+
+import (
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeoutFinishesInTime(t *testing.T) {
+	r := New()
+	r.Use(func(c *Context) {
+		c.Header("X-Before", "1")
+		c.Set("before", true)
+		c.Next()
+		assert.Equal(t, "handler", c.GetString("user"))
+		assert.Len(t, c.Errors, 1)
+	})
+	r.Use(Timeout(time.Second, nil))
+	r.GET("/users/:id", func(c *Context) {
+		assert.Equal(t, true, c.Keys["before"])
+		c.Set("user", "handler")
+		_ = c.Error(ErrForbidden)
+		c.Header("X-After", c.Params.ByName("id"))
+		c.String(http.StatusCreated, "ok")
+	})
+
+	w := performRequest(r, http.MethodGet, "/users/42")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "ok", w.Body.String())
+	assert.Equal(t, "1", w.Header().Get("X-Before"))
+	assert.Equal(t, "42", w.Header().Get("X-After"))
+}
+
+func TestTimeoutExpires(t *testing.T) {
+	written := make(chan error, 1)
+	r := New()
+	r.Use(Timeout(20*time.Millisecond, nil))
+	r.GET("/slow", func(c *Context) {
+		<-c.Request.Context().Done()
+		time.Sleep(10 * time.Millisecond)
+		_, err := io.WriteString(c.Writer, "late")
+		written <- err
+	})
+
+	w := performRequest(r, http.MethodGet, "/slow")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Empty(t, w.Body.String())
+	assert.ErrorIs(t, <-written, http.ErrHandlerTimeout)
+	assert.Empty(t, w.Body.String())
+}
+
+func TestTimeoutPanicReachesRecovery(t *testing.T) {
+	r := New()
+	r.Use(RecoveryWithWriter(io.Discard))
+	r.Use(Timeout(time.Second, nil))
+	r.GET("/panic", func(c *Context) {
+		panic("boom")
+	})
+
+	w := performRequest(r, http.MethodGet, "/panic")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestTimeoutLateHandlerDoesNotTouchExportedSpan(t *testing.T) {
+	exporter := &InMemoryExporter{}
+	responded, finished := make(chan struct{}), make(chan struct{})
+	r := New()
+	r.Use(Tracing(TracingConfig{Exporter: exporter, AlwaysSample: true}))
+	r.Use(Timeout(20*time.Millisecond, nil))
+	r.GET("/slow", func(c *Context) {
+		defer close(finished)
+		<-responded
+		c.Span().SetAttribute("late", true)
+	})
+
+	w := performRequest(r, http.MethodGet, "/slow")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	close(responded)
+	<-finished
+	assert.Eventually(t, func() bool { return len(exporter.Spans()) == 2 }, time.Second, time.Millisecond)
+
+	spans := exporter.Spans()
+	server, chain := spans[0], spans[1]
+	assert.Equal(t, SpanKindServer, server.Kind)
+	assert.NotContains(t, server.Attributes, "late")
+	assert.Equal(t, "timeout", chain.Name)
+	assert.Equal(t, true, chain.Attributes["late"])
+	assert.Equal(t, SpanStatusError, chain.Status)
+	assert.Equal(t, server.TraceContext.SpanID, chain.TraceContext.ParentID)
+}
@@ -0,0 +1,237 @@
+package gateway
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// SpanKind is the role of a span in a trace.
+type SpanKind int
+
+const (
+	// SpanKindInternal spans cover work inside the gateway, e.g. a handler.
+	SpanKindInternal SpanKind = iota
+	// SpanKindServer spans cover the handling of a request.
+	SpanKindServer
+)
+
+// SpanStatus is the outcome of a span.
+type SpanStatus int
+
+const (
+	// SpanStatusUnset is the status of spans that did not fail.
+	SpanStatusUnset SpanStatus = iota
+	// SpanStatusError is the status of failed spans.
+	SpanStatusError
+)
+
+// SpanEvent is something that happened during a span, e.g. an error.
+type SpanEvent struct {
+	Name       string         `json:"name"`
+	Time       time.Time      `json:"time"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
+
+// Span is a timed operation of a trace, modeled after OpenTelemetry spans. The methods
+// of a nil Span do nothing, so handlers need not check whether a request is traced.
+type Span struct {
+	Name          string         `json:"name"`
+	Kind          SpanKind       `json:"kind"`
+	TraceContext  TraceContext   `json:"-"`
+	Start         time.Time      `json:"start"`
+	End           time.Time      `json:"end"`
+	Attributes    map[string]any `json:"attributes,omitempty"`
+	Events        []SpanEvent    `json:"events,omitempty"`
+	Status        SpanStatus     `json:"status"`
+	StatusMessage string         `json:"statusMessage,omitempty"`
+
+	mu sync.Mutex
+}
+
+// SetAttribute sets an attribute of the span.
+func (s *Span) SetAttribute(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Attributes == nil {
+		s.Attributes = make(map[string]any)
+	}
+	s.Attributes[key] = value
+}
+
+// AddEvent records an event at the current time.
+func (s *Span) AddEvent(name string, attributes map[string]any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Events = append(s.Events, SpanEvent{Name: name, Time: time.Now(), Attributes: attributes})
+}
+
+// RecordError records err as an exception event. It does not change the status.
+func (s *Span) RecordError(err error) {
+	s.AddEvent("exception", map[string]any{"exception.message": err.Error()})
+}
+
+// SetStatus sets the status of the span.
+func (s *Span) SetStatus(status SpanStatus, message string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Status = status
+	s.StatusMessage = message
+}
+
+// SpanExporter receives spans once they ended. Implementations must be safe for
+// concurrent use and should not block, e.g. by batching spans in the background.
+type SpanExporter interface {
+	ExportSpan(s *Span)
+}
+
+// InMemoryExporter is a SpanExporter keeping spans in memory, e.g. for tests.
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+var _ SpanExporter = (*InMemoryExporter)(nil)
+
+// ExportSpan implements SpanExporter.
+func (e *InMemoryExporter) ExportSpan(s *Span) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, s)
+}
+
+// Spans returns the spans exported so far, in the order they ended.
+func (e *InMemoryExporter) Spans() []*Span {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]*Span(nil), e.spans...)
+}
+
+// Reset drops the exported spans.
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}
+
+// TracingConfig defines the config for Tracing middleware.
+type TracingConfig struct {
+	// Exporter receives the finished spans.
+	Exporter SpanExporter
+
+	// HandlerSpans creates a child span for every handler run after Tracing, named after
+	// the handler function. Spans of handlers called from a middleware are nested below
+	// the span of the middleware.
+	// Optional. Default value is false.
+	HandlerSpans bool
+
+	// AlwaysSample records requests whose traceparent is not sampled.
+	// Optional. Default value is false, which follows the decision of the caller.
+	AlwaysSample bool
+}
+
+// tracer is the tracing state of a request.
+type tracer struct {
+	exporter     SpanExporter
+	handlerSpans bool
+}
+
+// Tracing returns a middleware recording a server span per request, named after the
+// method and matched route, e.g. "GET /users/:id", as part of the trace of
+// Context.TraceContext. The span records the status, response size and Context.Errors;
+// 5xx responses mark it as failed. Handlers add to it with Context.Span.
+func Tracing(conf TracingConfig) HandlerFunc {
+	assert1(conf.Exporter != nil, "tracing: Exporter can not be nil")
+	t := &tracer{exporter: conf.Exporter, handlerSpans: conf.HandlerSpans}
+
+	return func(c *Context) {
+		tc := c.TraceContext()
+		if !tc.Sampled() && !conf.AlwaysSample {
+			return
+		}
+		name := c.Request.Method
+		if c.FullPath() != "" {
+			name += " " + c.FullPath()
+		}
+		span := &Span{
+			Name:         name,
+			Kind:         SpanKindServer,
+			TraceContext: tc,
+			Start:        time.Now(),
+			Attributes: map[string]any{
+				"http.request.method": c.Request.Method,
+				"url.path":            c.Request.URL.Path,
+				"client.address":      c.ClientIP(),
+				"user_agent.original": c.Request.UserAgent(),
+			},
+		}
+		if c.FullPath() != "" {
+			span.Attributes["http.route"] = c.FullPath()
+		}
+
+		c.span, c.tracer = span, t
+		defer func() {
+			c.span, c.tracer = nil, nil
+			if p := recover(); p != nil {
+				span.SetStatus(SpanStatusError, "panic")
+				span.End = time.Now()
+				t.exporter.ExportSpan(span)
+				panic(p)
+			}
+		}()
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttribute("http.response.status_code", status)
+		if size := c.Writer.Size(); size > 0 {
+			span.SetAttribute("http.response.body.size", size)
+		}
+		for _, err := range c.Errors {
+			span.RecordError(err)
+		}
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(SpanStatusError, http.StatusText(status))
+		}
+		span.End = time.Now()
+		t.exporter.ExportSpan(span)
+	}
+}
+
+// Span returns the current span of a request traced by the Tracing middleware, the span
+// of the running handler if HandlerSpans is enabled, nil if the request is not traced.
+func (c *Context) Span() *Span {
+	return c.span
+}
+
+// runTraced runs the handler at the current index in a child span.
+func (c *Context) runTraced(handler HandlerFunc) {
+	parent, t := c.span, c.tracer
+	span := &Span{
+		Name:         nameOfFunction(handler),
+		Kind:         SpanKindInternal,
+		TraceContext: parent.TraceContext.Child(),
+		Start:        time.Now(),
+	}
+	c.span = span
+	defer func() {
+		c.span = parent
+		if p := recover(); p != nil {
+			span.SetStatus(SpanStatusError, "panic")
+			span.End = time.Now()
+			t.exporter.ExportSpan(span)
+			panic(p)
+		}
+		span.End = time.Now()
+		t.exporter.ExportSpan(span)
+	}()
+	handler(c)
+}
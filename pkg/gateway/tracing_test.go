@@ -0,0 +1,72 @@
+package gateway
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTracing(t *testing.T) {
+	exporter := &InMemoryExporter{}
+	r := New()
+	r.Use(Tracing(TracingConfig{Exporter: exporter}))
+	r.GET("/users/:id", func(c *Context) {
+		c.Span().SetAttribute("user.id", c.Params.ByName("id"))
+		_ = c.Error(errors.New("upstream failed"))
+		c.String(http.StatusBadGateway, "bad gateway")
+	})
+
+	performRequestWithHeader(r, http.MethodGet, "/users/42", http.Header{
+		"Traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+	})
+	spans := exporter.Spans()
+	require.Len(t, spans, 1)
+	span := spans[0]
+	assert.Equal(t, "GET /users/:id", span.Name)
+	assert.Equal(t, SpanKindServer, span.Kind)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.TraceContext.TraceIDString())
+	assert.Equal(t, "00f067aa0ba902b7", span.TraceContext.ParentIDString())
+	assert.Equal(t, "/users/:id", span.Attributes["http.route"])
+	assert.Equal(t, "42", span.Attributes["user.id"])
+	assert.Equal(t, http.StatusBadGateway, span.Attributes["http.response.status_code"])
+	assert.Equal(t, len("bad gateway"), span.Attributes["http.response.body.size"])
+	assert.Equal(t, SpanStatusError, span.Status)
+	require.Len(t, span.Events, 1)
+	assert.Equal(t, "upstream failed", span.Events[0].Attributes["exception.message"])
+	assert.False(t, span.End.Before(span.Start))
+
+	// the caller decided not to sample
+	exporter.Reset()
+	performRequestWithHeader(r, http.MethodGet, "/users/42", http.Header{
+		"Traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"},
+	})
+	assert.Empty(t, exporter.Spans())
+}
+
+func authenticateForTracing(c *Context) {
+	c.Next()
+}
+
+func TestTracingHandlerSpans(t *testing.T) {
+	exporter := &InMemoryExporter{}
+	r := New()
+	r.Use(Tracing(TracingConfig{Exporter: exporter, HandlerSpans: true}), authenticateForTracing)
+	r.GET("/", func(c *Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	performRequest(r, http.MethodGet, "/")
+	spans := exporter.Spans()
+	require.Len(t, spans, 3)
+	handler, middleware, server := spans[0], spans[1], spans[2]
+	assert.Equal(t, "GET /", server.Name)
+	assert.True(t, strings.HasSuffix(middleware.Name, ".authenticateForTracing"), middleware.Name)
+	assert.Equal(t, SpanKindInternal, middleware.Kind)
+	assert.Equal(t, server.TraceContext.SpanID, middleware.TraceContext.ParentID)
+	assert.Equal(t, middleware.TraceContext.SpanID, handler.TraceContext.ParentID)
+	assert.Equal(t, server.TraceContext.TraceID, handler.TraceContext.TraceID)
+}
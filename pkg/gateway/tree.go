@@ -59,7 +59,6 @@ type methodTrees []methodTree
 
 func (trees methodTrees) get(method string) *node {
 	for _, tree := range trees {
-		fmt.Println(tree.method)
 		if tree.method == method {
 			return tree.root
 		}
@@ -254,7 +253,6 @@ func findWildcard(path string) (wildcard string, i int, valid bool) {
 	// Find start
 	for start, c := range []byte(path) {
 		// A wildcard starts with ':' (param) or '*' (catch-all)
-		fmt.Println(start, string(c))
 		if c != ':' && c != '*' {
 			continue
 		}
@@ -277,7 +275,6 @@ func (n *node) insertChild(path string, fullPath string, handlers HandlersChain)
 	for {
 		// Find prefix until first wildcard
 		wildcard, i, valid := findWildcard(path)
-		fmt.Println(wildcard, i, valid)
 		if i < 0 { // No wildcard found
 			break
 		}
@@ -398,8 +395,6 @@ type nodeValue struct {
 func (n *node) getValue(path string, params *Params, skippedNodes *[]skippedNode, unescape bool) (value nodeValue) {
 	var globalParamsCount int16
 
-	fmt.Printf("getvalue -> path: %s, params: %v skippedNodes: %d unescape: %t\n", path, params, len(*skippedNodes), unescape)
-
 walk: // Outer loop for walking the tree
 	for {
 		prefix := n.path
@@ -1,12 +1,27 @@
 package gateway
 
 import (
+	"net/http"
 	"os"
 	"path"
 	"reflect"
 	"runtime"
 )
 
+// WrapF is a helper function for wrapping http.HandlerFunc and returns a gateway middleware.
+func WrapF(f http.HandlerFunc) HandlerFunc {
+	return func(c *Context) {
+		f(c.Writer, c.Request)
+	}
+}
+
+// WrapH is a helper function for wrapping http.Handler and returns a gateway middleware.
+func WrapH(h http.Handler) HandlerFunc {
+	return func(c *Context) {
+		h.ServeHTTP(c.Writer, c.Request)
+	}
+}
+
 func assert1(guard bool, text string) {
 	if !guard {
 		panic(text)
@@ -38,6 +38,11 @@ type Error struct {
 
 type errorMsgs []*Error
 
+// Error implements the error interface.
+func (msg Error) Error() string {
+	return msg.Err.Error()
+}
+
 // IsType judges one error.
 func (r *Error) IsType(flags ErrorType) bool {
 	return (r.Type & flags) > 0
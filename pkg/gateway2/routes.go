@@ -0,0 +1,99 @@
+package gateway2
+
+import (
+	"io"
+	"reflect"
+	"runtime"
+	"sort"
+
+	"github.com/idproxy/gateway/internal/json"
+	"gopkg.in/yaml.v3"
+)
+
+// RouteInfo represents a request route's specification which contains method and path and its handler.
+type RouteInfo struct {
+	Method      string      `json:"method" yaml:"method"`
+	Path        string      `json:"path" yaml:"path"`
+	Handler     string      `json:"handler" yaml:"handler"`
+	HandlerFunc HandlerFunc `json:"-" yaml:"-"`
+}
+
+// RoutesInfo defines a RouteInfo slice.
+type RoutesInfo []RouteInfo
+
+// Routes returns a slice of registered routes, including some useful information, such as:
+// the http method, path and the handler name. Routes are ordered by path and method so
+// that route tables can be compared between releases.
+func (r *Gateway) Routes() RoutesInfo {
+	return r.tree.Routes()
+}
+
+// WriteJSON writes the routes as an indented JSON array.
+func (routes RoutesInfo) WriteJSON(w io.Writer) error {
+	b, err := json.MarshalIndent(routes, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// WriteYAML writes the routes as a YAML sequence.
+func (routes RoutesInfo) WriteYAML(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode([]RouteInfo(routes)); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// Routes returns the routes of every method, ordered by path and method.
+func (r *methodTree) Routes() RoutesInfo {
+	r.m.RLock()
+	defer r.m.RUnlock()
+	var routes RoutesInfo
+	for method, n := range r.tree {
+		routes = n.routes(method, "/", routes)
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
+// routes appends the routes of the node and its children. path is the path of the node.
+func (r *node) routes(method, path string, routes RoutesInfo) RoutesInfo {
+	r.m.RLock()
+	defer r.m.RUnlock()
+	if len(r.handlers) > 0 {
+		handlerFunc := r.handlers.Last()
+		routes = append(routes, RouteInfo{
+			Method:      method,
+			Path:        path,
+			Handler:     nameOfFunction(handlerFunc),
+			HandlerFunc: handlerFunc,
+		})
+	}
+	for _, child := range r.children {
+		childPath := path
+		switch {
+		case child.value == "/":
+			// trailing slash segment
+			childPath += "/"
+		case path == "/":
+			childPath += child.value
+		default:
+			childPath += "/" + child.value
+		}
+		routes = child.routes(method, childPath, routes)
+	}
+	return routes
+}
+
+func nameOfFunction(f any) string {
+	return runtime.FuncForPC(reflect.ValueOf(f).Pointer()).Name()
+}
@@ -0,0 +1,59 @@
+package gateway2
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/idproxy/gateway/internal/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func handlerTest1(c *Context) {}
+func handlerTest2(c *Context) {}
+
+func TestRoutes(t *testing.T) {
+	r := New()
+	r.GET("/users/:id", handlerTest1)
+	r.POST("/users", handlerTest2)
+	r.GET("/", handlerTest1)
+	r.GET("/users/", handlerTest2)
+	r.GET("/users", handlerTest1)
+	r.Group("/static").GET("/*fp", handlerTest2)
+
+	routes := r.Routes()
+	expected := []struct{ method, path, handler string }{
+		{http.MethodGet, "/", "handlerTest1"},
+		{http.MethodGet, "/static/*fp", "handlerTest2"},
+		{http.MethodGet, "/users", "handlerTest1"},
+		{http.MethodPost, "/users", "handlerTest2"},
+		{http.MethodGet, "/users/", "handlerTest2"},
+		{http.MethodGet, "/users/:id", "handlerTest1"},
+	}
+	got := make([][3]string, len(routes))
+	for i, route := range routes {
+		got[i] = [3]string{route.Method, route.Path, route.Handler}
+		assert.NotNil(t, route.HandlerFunc)
+	}
+	want := make([][3]string, len(expected))
+	for i, e := range expected {
+		want[i] = [3]string{e.method, e.path, "github.com/idproxy/gateway/pkg/gateway2." + e.handler}
+	}
+	require.Equal(t, want, got)
+
+	var buf bytes.Buffer
+	require.NoError(t, routes.WriteJSON(&buf))
+	var dumped []map[string]string
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &dumped))
+	require.Len(t, dumped, len(expected))
+	assert.Equal(t, map[string]string{
+		"method":  http.MethodGet,
+		"path":    "/users/:id",
+		"handler": "github.com/idproxy/gateway/pkg/gateway2.handlerTest1",
+	}, dumped[5])
+
+	buf.Reset()
+	require.NoError(t, routes[1:2].WriteYAML(&buf))
+	assert.Equal(t, "- method: GET\n  path: /static/*fp\n  handler: github.com/idproxy/gateway/pkg/gateway2.handlerTest2\n", buf.String())
+}
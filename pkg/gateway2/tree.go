@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 	"path"
+	"sort"
 	"sync"
 )
 
@@ -13,6 +14,7 @@ const (
 
 type Tree interface {
 	Print()
+	Routes() RoutesInfo
 	AddRoute(httpMethod, absolutePath string, handlers HandlersChain)
 	GetSupportedmethods() []string
 	GetReqValue(reqCtx *requestContext) valueContext
@@ -90,12 +92,18 @@ func NewTree() Tree {
 func (r *methodTree) Print() {
 	r.m.RLock()
 	defer r.m.RUnlock()
-	for method, n := range r.tree {
-		if method == "GET" {
-			fmt.Println(method)
-			//fmt.Printf("pathSegment tree: %s, handlers: %d\n", n.pathSegment.value, len(n.handlers))
-			n.Print(0)
+	methods := make([]string, 0, len(r.tree))
+	for method := range r.tree {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	for _, method := range methods {
+		n := r.tree[method]
+		if len(n.handlers) == 0 && len(n.children) == 0 {
+			continue
 		}
+		fmt.Println(method)
+		n.Print(0)
 	}
 }
 